@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FailedScrapeSummary is one row of the failed-scrapes listing.
+type FailedScrapeSummary struct {
+	ID            primitive.ObjectID `json:"id"`
+	UserID        string             `json:"user_id"`
+	URL           string             `json:"url"`
+	ResolvedURL   string             `json:"resolved_url,omitempty"`
+	ScrapeError   string             `json:"scrape_error"`
+	ArtifactCount int                `json:"artifact_count"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// FailedScrapesResponse represents the paginated failed-scrapes listing
+type FailedScrapesResponse struct {
+	Items       []FailedScrapeSummary `json:"items"`
+	Total       int64                 `json:"total"`
+	CurrentPage int                   `json:"current_page"`
+	TotalPages  int                   `json:"total_pages"`
+}
+
+// FailedScrapeArtifact is a ScrapeAttempt with short-lived download links for
+// its stored HTML snapshot and screenshot.
+type FailedScrapeArtifact struct {
+	models.ScrapeAttempt
+	HTMLURL       string `json:"html_url,omitempty"`
+	ScreenshotURL string `json:"screenshot_url,omitempty"`
+}
+
+// AdminFailedScrapesHandler handles /admin/failed-scrapes and
+// /admin/failed-scrapes/{id}. Wrap with AdminMiddleware.
+func AdminFailedScrapesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /admin/failed-scrapes -> ["admin", "failed-scrapes"]
+	// /admin/failed-scrapes/{id} -> ["admin", "failed-scrapes", "id"]
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) > 2 && pathParts[2] != "" {
+		getFailedScrape(w, r, pathParts[2])
+		return
+	}
+	listFailedScrapes(w, r)
+}
+
+// listFailedScrapes returns failed scrapes newest first. ?host= narrows the
+// listing to one store (substring match on the resolved URL).
+func listFailedScrapes(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Admin List Failed Scrapes API]")
+
+	page := 1
+	limit := 20
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	filter := bson.M{"status": "failed"}
+	if host := strings.TrimSpace(r.URL.Query().Get("host")); host != "" {
+		filter["resolved_url"] = bson.M{"$regex": primitive.Regex{Pattern: regexp.QuoteMeta(host), Options: "i"}}
+	}
+
+	collection := utils.GetCollection(config.DBName, "products")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Failed to count documents", http.StatusInternalServerError)
+		return
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Database query failed", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Failed to decode data", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]FailedScrapeSummary, 0, len(products))
+	for _, p := range products {
+		items = append(items, FailedScrapeSummary{
+			ID:            p.ID,
+			UserID:        p.UserID,
+			URL:           p.URL,
+			ResolvedURL:   p.ResolvedURL,
+			ScrapeError:   p.ScrapeError,
+			ArtifactCount: len(p.FailureArtifacts),
+			CreatedAt:     p.CreatedAt,
+		})
+	}
+
+	totalPages := 0
+	if total > 0 {
+		totalPages = int((total + int64(limit) - 1) / int64(limit))
+	}
+
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Found %d failed scrapes", len(items)))
+	utils.RespondJSON(w, http.StatusOK, FailedScrapesResponse{
+		Items:       items,
+		Total:       total,
+		CurrentPage: page,
+		TotalPages:  totalPages,
+	})
+}
+
+// getFailedScrape returns a single failed scrape with presigned download
+// links for each stored artifact.
+func getFailedScrape(w http.ResponseWriter, r *http.Request, idHex string) {
+	productID, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		utils.RespondError(w, nil, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	collection := utils.GetCollection(config.DBName, "products")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var product models.Product
+	if err := collection.FindOne(ctx, bson.M{"_id": productID, "status": "failed"}).Decode(&product); err != nil {
+		utils.RespondError(w, nil, "Failed scrape not found", http.StatusNotFound)
+		return
+	}
+
+	artifacts := make([]FailedScrapeArtifact, 0, len(product.FailureArtifacts))
+	for _, a := range product.FailureArtifacts {
+		artifact := FailedScrapeArtifact{ScrapeAttempt: a}
+		if a.HTMLKey != "" {
+			artifact.HTMLURL, _ = utils.GetPresignedURL(r.Context(), a.HTMLKey)
+		}
+		if a.ScreenshotKey != "" {
+			artifact.ScreenshotURL, _ = utils.GetPresignedURL(r.Context(), a.ScreenshotKey)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":           product.ID,
+		"user_id":      product.UserID,
+		"url":          product.URL,
+		"resolved_url": product.ResolvedURL,
+		"scrape_error": product.ScrapeError,
+		"created_at":   product.CreatedAt,
+		"artifacts":    artifacts,
+	})
+}
+
+// AdminMetricsHandler returns in-process counters of this instance at
+// GET /admin/metrics. Wrap with AdminMiddleware.
+func AdminMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runs, failures := utils.PeopleDetectionStats()
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"instance": config.InstanceID,
+		"people_detection": map[string]int64{
+			"runs":     runs,
+			"failures": failures,
+		},
+	})
+}
@@ -2,15 +2,19 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 )
 
-// BillingStatusHandler returns the caller's current plan and today's try-on
-// quota usage. Powers the "X try-ons left today" pill on the mobile app.
-// Wrap with AuthMiddleware.
+// BillingStatusHandler returns the caller's current plan, what it
+// includes, today's try-on quota usage, credit balance, subscription and
+// the credit packs on sale. Powers the "X try-ons left today" pill on the mobile app.
+// Only the quota is required: credits or subscription that fail to load
+// are returned as null. Wrap with AuthMiddleware.
 func BillingStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
@@ -33,8 +37,27 @@ func BillingStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
-		"is_guest": IsGuestFromContext(r.Context()),
-		"quota":    status,
-	})
+	resp := map[string]interface{}{
+		"is_guest":     IsGuestFromContext(r.Context()),
+		"quota":        status,
+		"entitlements": models.EntitlementsForPlan(plan),
+	}
+	// Guests have no credits to spend or buy
+	if !IsGuestFromContext(r.Context()) {
+		resp["credits"] = nil
+		if credits, err := utils.GetCreditBalance(ctx, userID, plan); err == nil {
+			resp["credits"] = credits
+		} else {
+			fmt.Printf("[Billing] failed to load credits for %s: %v\n", userID, err)
+		}
+		resp["packs"] = models.CreditPacks
+
+		resp["subscription"] = nil
+		if sub, err := utils.CurrentSubscription(ctx, userID); err == nil {
+			resp["subscription"] = sub
+		} else {
+			fmt.Printf("[Billing] failed to load subscription for %s: %v\n", userID, err)
+		}
+	}
+	utils.RespondJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditGrantRequest is the body of POST /admin/credits/{user_id}.
+type CreditGrantRequest struct {
+	Units     int        `json:"units"`
+	Source    string     `json:"source"`     // promo (default) or pack
+	ExpiresAt *time.Time `json:"expires_at"` // optional; valid_days is used otherwise
+	ValidDays int        `json:"valid_days"` // optional; 0 with no expires_at never expires
+	Ref       string     `json:"ref"`        // optional; a grant is applied once per ref
+	Note      string     `json:"note"`
+}
+
+// CreditLedgerHandler returns the caller's recent credit ledger entries,
+// newest first (?limit=, default 50, max 200). Wrap with AuthMiddleware.
+func CreditLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, nil, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entries, err := utils.ListCreditLedger(ctx, userID, int64(limit))
+	if err != nil {
+		utils.RespondError(w, nil, "Failed to load ledger", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+// AdminCreditsHandler serves /admin/credits/{user_id}: GET returns the
+// balance and ledger, POST grants credits (e.g. a promotion or a manual
+// pack top-up). Wrap with AdminMiddleware.
+func AdminCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Admin Credits API]")
+
+	userID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/credits"), "/")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	plan, err := userPlan(ctx, userID)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "User not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		balance, err := utils.GetCreditBalance(ctx, userID, plan)
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to load credits: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries, err := utils.ListCreditLedger(ctx, userID, 50)
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to load ledger", http.StatusInternalServerError)
+			return
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+			"user_id": userID,
+			"plan":    plan,
+			"credits": balance,
+			"ledger":  entries,
+		})
+
+	case http.MethodPost:
+		var req CreditGrantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Units <= 0 {
+			utils.RespondError(w, &logMessageBuilder, "units must be positive", http.StatusBadRequest)
+			return
+		}
+		if req.Source == "" {
+			req.Source = models.CreditSourcePromo
+		}
+		if req.Source != models.CreditSourcePromo && req.Source != models.CreditSourcePack {
+			utils.RespondError(w, &logMessageBuilder, "source must be promo or pack", http.StatusBadRequest)
+			return
+		}
+		expiresAt := req.ExpiresAt
+		if expiresAt == nil && req.ValidDays > 0 {
+			t := time.Now().AddDate(0, 0, req.ValidDays)
+			expiresAt = &t
+		}
+
+		err := utils.GrantCredits(ctx, userID, plan, utils.CreditGrant{
+			Source:    req.Source,
+			Units:     req.Units,
+			ExpiresAt: expiresAt,
+			Ref:       req.Ref,
+			Note:      req.Note,
+		})
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to grant credits: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Granted %d %s credits to %s", req.Units, req.Source, userID))
+
+		balance, err := utils.GetCreditBalance(ctx, userID, plan)
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to load credits: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+			"user_id": userID,
+			"credits": balance,
+		})
+
+	default:
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// userPlan returns the plan of a registered, non-deleted user.
+func userPlan(ctx context.Context, userID string) (string, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", err
+	}
+	var user models.User
+	err = utils.GetCollection(config.DBName, "users").FindOne(ctx, bson.M{
+		"_id":    objID,
+		"status": bson.M{"$ne": "deleted"},
+	}).Decode(&user)
+	if err != nil {
+		return "", err
+	}
+	return user.PlanOrDefault(), nil
+}
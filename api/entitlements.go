@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EntitlementMiddleware rejects try-ons the caller's plan doesn't include:
+// the route's try-on type, a theme when the plan has no theme access, or
+// more people than the plan allows in one try-on. cost is the route's
+// QuotaCostFunc, which says whether a theme is used and for how many
+// people.
+// Wrap it inside AuthMiddleware and outside QuotaMiddleware, so nothing is
+// reserved for a request that isn't allowed.
+func EntitlementMiddleware(next http.Handler, tryOnType string, cost QuotaCostFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plan := GetUserPlanFromContext(r.Context())
+		ent := models.EntitlementsForPlan(plan)
+
+		var msg, feature string
+		c := cost(r)
+		switch {
+		case tryOnType == models.TryOnTypeGuest && !IsGuestFromContext(r.Context()) && !ent.AllowsTryOn(tryOnType):
+			utils.RespondError(w, nil, "Guest try-on is for guests only. Use /try-on instead.", http.StatusForbidden)
+			return
+		case !ent.AllowsTryOn(tryOnType):
+			feature = tryOnType
+			msg = fmt.Sprintf("%s try-on isn't included in the %s plan.", strings.ToUpper(tryOnType[:1])+tryOnType[1:], plan)
+		case c.Theme && !ent.Themes:
+			feature = "themes"
+			msg = fmt.Sprintf("Themes aren't included in the %s plan.", plan)
+		case ent.MaxPeoplePerTryOn > 0 && c.People > ent.MaxPeoplePerTryOn:
+			feature = "people"
+			msg = fmt.Sprintf("The %s plan allows up to %d people in one try-on.", plan, ent.MaxPeoplePerTryOn)
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if IsGuestFromContext(r.Context()) {
+			msg += " Sign up to unlock it."
+		} else {
+			msg += " Upgrade your plan to unlock it."
+		}
+		utils.RespondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error":   msg,
+			"plan":    plan,
+			"feature": feature,
+			"upsell":  true,
+		})
+	})
+}
+
+// planSlot is a saved person or wardrobe item counted against the plan's
+// cap by reservePlanSlot. Defer release, and call keep once the item is
+// saved.
+type planSlot struct {
+	userID   string
+	kind     string
+	reserved bool
+	kept     bool
+}
+
+// keep marks the slot's item as saved, so release leaves the count alone.
+func (s *planSlot) keep() { s.kept = true }
+
+// release gives the slot back unless its item was saved.
+func (s *planSlot) release() {
+	if !s.reserved || s.kept {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.ReleaseSavedItem(ctx, s.userID, s.kind); err != nil {
+		fmt.Printf("[Plan Limits] failed to release %s slot of %s: %v\n", s.kind, s.userID, err)
+	}
+}
+
+// reservePlanSlot takes one of the plan's slots for saved persons or
+// wardrobe items before one more is created, writing the error response
+// when the caller has none left. Guests can't save either.
+func reservePlanSlot(w http.ResponseWriter, r *http.Request, logMessageBuilder *strings.Builder, collection string) (*planSlot, bool) {
+	what := map[string]string{CollectionName: "person profiles", "wardrobe": "wardrobe items"}[collection]
+	if IsGuestFromContext(r.Context()) {
+		utils.RespondError(w, logMessageBuilder, "Sign up to save "+what, http.StatusForbidden)
+		return nil, false
+	}
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, logMessageBuilder, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	plan := GetUserPlanFromContext(r.Context())
+	ent := models.EntitlementsForPlan(plan)
+
+	var limit int
+	var filter bson.M
+	if collection == CollectionName {
+		// Person documents store the owner as an ObjectID and are soft-deleted
+		objID, _ := primitive.ObjectIDFromHex(userID)
+		limit = ent.MaxPersons
+		filter = bson.M{"user_id": objID, "is_deleted": bson.M{"$ne": true}}
+	} else {
+		limit = ent.MaxWardrobeItems
+		filter = bson.M{"user_id": userID}
+	}
+	countSaved := func(ctx context.Context) (int64, error) {
+		return utils.GetCollection(config.DBName, collection).CountDocuments(ctx, filter)
+	}
+
+	slot := &planSlot{userID: userID, kind: savedKind(collection)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reserved, used, err := utils.ReserveSavedItem(ctx, userID, slot.kind, limit, countSaved)
+	if err != nil {
+		// Fail open like QuotaMiddleware: a flaky count shouldn't block saving
+		utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Plan limit check failed: %v — allowing", err))
+		return slot, true
+	}
+	if !reserved {
+		utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Plan %s limit of %d %s reached", plan, limit, what))
+		utils.RespondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error":  fmt.Sprintf("The %s plan can save up to %d %s. Upgrade your plan to save more.", plan, limit, what),
+			"plan":   plan,
+			"limit":  limit,
+			"used":   used,
+			"upsell": true,
+		})
+		return nil, false
+	}
+	slot.reserved = true
+	return slot, true
+}
+
+// releaseSavedItem gives back the plan slot of a deleted person or
+// wardrobe item.
+func releaseSavedItem(userID, collection string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.ReleaseSavedItem(ctx, userID, savedKind(collection)); err != nil {
+		fmt.Printf("[Plan Limits] failed to release %s slot of %s: %v\n", savedKind(collection), userID, err)
+	}
+}
+
+// savedKind names collection's count in utils.ReserveSavedItem.
+func savedKind(collection string) string {
+	if collection == CollectionName {
+		return "persons"
+	}
+	return "wardrobe"
+}
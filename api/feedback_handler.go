@@ -1,10 +1,10 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -65,18 +65,19 @@ func FeedbackHandler(w http.ResponseWriter, r *http.Request) {
 	// Handle file uploads
 	var filePaths []string
 	files := r.MultipartForm.File["files"]
-	for _, file := range files {
-		f, err := file.Open()
+	normalized := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := utils.NormalizeUpload(file)
 		if err != nil {
-			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Error opening file %s", file.Filename), http.StatusInternalServerError)
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid image %s: %v", file.Filename, err), http.StatusUnsupportedMediaType)
 			return
 		}
+		normalized[i] = data
+	}
+	for i, file := range files {
+		objectKey := fmt.Sprintf("feedback/%s/%s.jpg", userIDStr, uuid.New().String())
 
-		ext := filepath.Ext(file.Filename)
-		objectKey := fmt.Sprintf("feedback/%s/%s%s", userIDStr, uuid.New().String(), ext)
-
-		path, err := utils.UploadFileToS3(context.TODO(), f, objectKey, file.Header.Get("Content-Type"))
-		f.Close()
+		path, err := utils.UploadFileToS3(context.TODO(), bytes.NewReader(normalized[i]), objectKey, "image/jpeg")
 		if err != nil {
 			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Error uploading file %s", file.Filename), http.StatusInternalServerError)
 			return
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 )
 
@@ -48,15 +49,17 @@ func GuestTryOnHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, &logMessageBuilder, "person_image is required", http.StatusBadRequest)
 		return
 	}
-	personFile, err := personFileHeader.Open()
-	if err != nil {
+	photos, ok := checkPersonPhotos(w, r, &logMessageBuilder, []*multipart.FileHeader{personFileHeader})
+	if !ok {
+		return
+	}
+	if len(photos) == 0 {
 		utils.RespondError(w, &logMessageBuilder, "Failed to read person_image", http.StatusBadRequest)
 		return
 	}
-	defer personFile.Close()
 
-	personKey := fmt.Sprintf("guest_uploads/person_%d_%s", time.Now().UnixNano(), sanitizeFilename(personFileHeader.Filename))
-	if _, err := utils.UploadFileToS3(r.Context(), personFile, personKey, personFileHeader.Header.Get("Content-Type"), utils.CacheControlMutable); err != nil {
+	personKey := fmt.Sprintf("guest_uploads/person_%d_%s", time.Now().UnixNano(), sanitizeFilename(photos[0].filename))
+	if _, err := utils.UploadFileToS3(r.Context(), bytes.NewReader(photos[0].data), personKey, "image/jpeg", utils.CacheControlMutable); err != nil {
 		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to upload person image: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -77,14 +80,13 @@ func GuestTryOnHandler(w http.ResponseWriter, r *http.Request) {
 	var productImageURLs []string
 
 	if productFileHeader != nil {
-		pf, err := productFileHeader.Open()
+		productData, err := utils.NormalizeUpload(productFileHeader)
 		if err != nil {
-			utils.RespondError(w, &logMessageBuilder, "Failed to read product_image", http.StatusBadRequest)
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid product_image: %v", err), http.StatusUnsupportedMediaType)
 			return
 		}
-		defer pf.Close()
-		productKey := fmt.Sprintf("guest_uploads/product_%d_%s", time.Now().UnixNano(), sanitizeFilename(productFileHeader.Filename))
-		if _, err := utils.UploadFileToS3(r.Context(), pf, productKey, productFileHeader.Header.Get("Content-Type"), utils.CacheControlImmutable); err != nil {
+		productKey := fmt.Sprintf("guest_uploads/product_%d_%s", time.Now().UnixNano(), sanitizeFilename(utils.JPEGFilename(productFileHeader.Filename)))
+		if _, err := utils.UploadFileToS3(r.Context(), bytes.NewReader(productData), productKey, "image/jpeg", utils.CacheControlImmutable); err != nil {
 			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to upload product image: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -111,7 +113,7 @@ func GuestTryOnHandler(w http.ResponseWriter, r *http.Request) {
 			} else {
 				productImageURLs = append(productImageURLs, product.Images...)
 			}
-		} else if scraper, resolvedURL, err := selectScraper(productURL); err != nil {
+		} else if scraper, resolvedURL, err := selectScraper(productURL, nil); err != nil {
 			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("scraper_not_found: %v", err))
 		} else if product, err := scraper.ScrapeProduct(resolvedURL); err != nil {
 			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("scrape_failed: %v", err))
@@ -147,14 +149,28 @@ func GuestTryOnHandler(w http.ResponseWriter, r *http.Request) {
 	//    image-gen safety classifier).
 	personDetails := strings.TrimSpace(r.FormValue("person_details"))
 
+	// Guests wait behind every signed-in plan for a generation slot
+	ticket, err := utils.Scheduler.Enqueue(GetUserPlanFromContext(r.Context()))
+	if err == nil {
+		err = ticket.Wait(r.Context())
+		defer ticket.Done()
+	}
+	if err != nil {
+		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Not scheduled: %v", err))
+		utils.RespondError(w, nil, "We're at capacity, please try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+
 	geminiCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	generated, err := utils.GenerateIndividualTryOnImage(geminiCtx, "", "", utils.PersonTryOnData{
+	generated, err := utils.Generator.GenerateIndividual(geminiCtx, "", "", utils.PersonTryOnData{
 		Details:        personDetails,
 		PersonImageURL: personImageURL,
 		TopURL:         productImageURLs,
 	})
+	// Free the slot before watermarking and uploading
+	ticket.Done()
 	if err != nil {
 		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Gemini failed: %v", err))
 		errLower := strings.ToLower(err.Error())
@@ -173,6 +189,12 @@ func GuestTryOnHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if models.EntitlementsForPlan(GetUserPlanFromContext(r.Context())).Watermark {
+		if generated, err = utils.WatermarkImage(generated); err != nil {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to watermark result: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// 4. Upload result + return presigned URL. Don't write to the tryons
 	//    collection — guests don't have a gallery to come back to.
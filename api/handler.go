@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/raushankrgupta/web-product-scraper/config"
 	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -54,7 +56,23 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 
 	collection := utils.GetCollection(config.DBName, "products")
 
-	saveFailedScrape := func(resolvedURL, scrapeErr string) {
+	// Debug mode: callers presenting the admin or internal secret get a
+	// structured trace of the scrape (redirect chain, every strategy tried,
+	// validator and block-detection verdicts) in the response. The trace is
+	// also persisted on the product record for later support lookups.
+	var trace *models.ScrapeTrace
+	if hasPrivilegedSecret(r) {
+		trace = &models.ScrapeTrace{StartedAt: time.Now()}
+		// The trace is for admins only; keep it out of shared caches
+		// (ImageCacheMiddleware marks this route public)
+		w.Header().Set("Cache-Control", "private, no-store")
+		utils.AddToLogMessage(&logMessageBuilder, "Scrape trace enabled")
+	}
+
+	// saveFailedScrape records the failure for debugging. When the scraper
+	// returned a *models.ScrapeFailure, each strategy's HTML / screenshot is
+	// uploaded to S3 and referenced from the failed Product document.
+	saveFailedScrape := func(resolvedURL, scrapeErr string, cause error) {
 		failedProduct := models.Product{
 			ID:          primitive.NewObjectID(),
 			UserID:      userID,
@@ -65,6 +83,19 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 			Source:      "link",
 			CreatedAt:   time.Now(),
 		}
+		var failure *models.ScrapeFailure
+		if errors.As(cause, &failure) && len(failure.Attempts) > 0 {
+			failedProduct.FailureArtifacts = uploadScrapeArtifacts(r.Context(), &logMessageBuilder, failedProduct.ID, failure.Attempts)
+		}
+		if trace != nil {
+			trace.Finish(cause)
+			// Every traced attempt failed, so the trace and the artifacts
+			// line up one-to-one; reuse the artifacts to pick up S3 keys.
+			if len(trace.Attempts) == len(failedProduct.FailureArtifacts) {
+				trace.Attempts = failedProduct.FailureArtifacts
+			}
+			failedProduct.ScrapeTrace = trace
+		}
 		if _, dbErr := collection.InsertOne(r.Context(), failedProduct); dbErr != nil {
 			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to save failed scrape record: %v", dbErr))
 		} else {
@@ -75,10 +106,10 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 	// selectScraper resolves short links and routes Myntra URLs to the
 	// isolated myntra_scraper package; everything else still goes through
 	// the standard scrapers.GetScraper factory.
-	scraper, resolvedURL, err := selectScraper(productURL)
+	scraper, resolvedURL, err := selectScraper(productURL, trace)
 	if err != nil {
-		saveFailedScrape("", fmt.Sprintf("scraper_not_found: %v", err))
-		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Error finding scraper: %v", err), http.StatusBadRequest)
+		saveFailedScrape("", fmt.Sprintf("scraper_not_found: %v", err), err)
+		respondScrapeError(w, &logMessageBuilder, fmt.Sprintf("Error finding scraper: %v", err), http.StatusBadRequest, trace)
 		return
 	}
 
@@ -86,8 +117,8 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 
 	product, err := scraper.ScrapeProduct(resolvedURL)
 	if err != nil {
-		saveFailedScrape(resolvedURL, fmt.Sprintf("scrape_failed: %v", err))
-		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Scraping failed: %v", err), http.StatusInternalServerError)
+		saveFailedScrape(resolvedURL, fmt.Sprintf("scrape_failed: %v", err), err)
+		respondScrapeError(w, &logMessageBuilder, fmt.Sprintf("Scraping failed: %v", err), http.StatusInternalServerError, trace)
 		return
 	}
 
@@ -149,6 +180,12 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 	product.ResolvedURL = resolvedURL
 	product.Status = "success"
 	product.CreatedAt = time.Now()
+	product.Slot = scrapers.ClassifyProduct(product)
+	product.Attributes = scrapers.NormalizeAttributes(product)
+	if trace != nil {
+		trace.Finish(nil)
+		product.ScrapeTrace = trace
+	}
 
 	_, err = collection.InsertOne(r.Context(), product)
 	if err != nil {
@@ -165,3 +202,17 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 
 	utils.RespondJSON(w, http.StatusOK, product)
 }
+
+// respondScrapeError is utils.RespondError plus, in debug mode, the scrape
+// trace alongside the error message.
+func respondScrapeError(w http.ResponseWriter, logger *strings.Builder, message string, status int, trace *models.ScrapeTrace) {
+	if trace == nil {
+		utils.RespondError(w, logger, message, status)
+		return
+	}
+	utils.AddToLogMessage(logger, message)
+	utils.RespondJSON(w, status, map[string]interface{}{
+		"error":        message,
+		"scrape_trace": trace,
+	})
+}
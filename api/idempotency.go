@@ -0,0 +1,340 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idempotencyCollection = "idempotency_keys"
+	// idempotencyTTL is how long a key's response is replayed.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTimeout is how long an in-progress key blocks retries.
+	// It outlasts the slowest try-on (queue wait plus generation), so an
+	// older one was left behind by a crash.
+	idempotencyLockTimeout = 10 * time.Minute
+	// maxIdempotencyKeyLength bounds the header; clients send UUIDs.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBody bounds the body buffered for hashing; it fits a
+	// guest try-on's two photos.
+	maxIdempotentBody = 32 << 20
+)
+
+// idempotentJobKey is the context key of the *idempotentJob a try-on
+// handler fills in, so the stored response can be rebuilt from the job.
+type idempotentJobKey struct{}
+
+type idempotentJob struct {
+	id string
+}
+
+// noteIdempotentJob records the try-on job the request's response
+// describes, when the request carries an Idempotency-Key.
+func noteIdempotentJob(ctx context.Context, jobID string) {
+	if j, ok := ctx.Value(idempotentJobKey{}).(*idempotentJob); ok {
+		j.id = jobID
+	}
+}
+
+// EnsureIdempotencyIndexes creates the unique (user_id, key) index and the
+// TTL index that expires stored responses.
+func EnsureIdempotencyIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := utils.GetCollection(config.DBName, idempotencyCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// IdempotencyMiddleware makes POSTs carrying an Idempotency-Key header safe
+// to retry. The first request with a key runs and its response is stored;
+// a retry within 24h gets the stored response without reaching the
+// handler, so nothing is generated or charged twice. Wrap it inside
+// AuthMiddleware (keys are per user) and outside QuotaMiddleware.
+//
+// Replays carry fresh presigned URLs: a try-on's response is rebuilt from
+// its job, and other responses have their S3 URLs presigned again.
+//
+// Reusing a key for a different request is a 422; retrying while the first
+// request is still running is a 409. Server errors, 409s, 429s and 503s
+// aren't stored, so those can be retried with the same key.
+func IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.RespondError(w, nil, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+		userID, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			utils.RespondError(w, nil, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.RespondError(w, nil, "Request body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			utils.RespondError(w, nil, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := requestFingerprint(r, body)
+
+		coll := utils.GetCollection(config.DBName, idempotencyCollection)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		_, err = coll.InsertOne(ctx, models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			State:       models.IdempotencyInProgress,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyTTL),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			replayIdempotent(ctx, w, coll, userID, key, requestHash)
+			return
+		}
+		if err != nil {
+			// Fail open like QuotaMiddleware: the request runs without
+			// replay protection rather than not at all.
+			fmt.Printf("[Idempotency] failed to store key for %s: %v — running without it\n", userID, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		job := &idempotentJob{}
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), idempotentJobKey{}, job)))
+
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer saveCancel()
+		filter := bson.M{"user_id": userID, "key": key}
+		if !recorder.wroteHeader || !storableStatus(recorder.status) {
+			_, err = coll.DeleteOne(saveCtx, filter)
+		} else {
+			_, err = coll.UpdateOne(saveCtx, filter, bson.M{"$set": bson.M{
+				"state":        models.IdempotencyCompleted,
+				"status":       recorder.status,
+				"content_type": recorder.Header().Get("Content-Type"),
+				"location":     recorder.Header().Get("Location"),
+				"body":         recorder.body.Bytes(),
+				"job_id":       job.id,
+			}})
+		}
+		if err != nil {
+			fmt.Printf("[Idempotency] failed to save response for %s: %v\n", userID, err)
+		}
+	})
+}
+
+// replayIdempotent answers a request whose key was already used.
+func replayIdempotent(ctx context.Context, w http.ResponseWriter, coll *mongo.Collection, userID, key, requestHash string) {
+	var rec models.IdempotencyRecord
+	if err := coll.FindOne(ctx, bson.M{"user_id": userID, "key": key}).Decode(&rec); err != nil {
+		utils.RespondError(w, nil, "Request with this Idempotency-Key is in progress, retry shortly", http.StatusConflict)
+		return
+	}
+	switch {
+	case rec.RequestHash != requestHash:
+		utils.RespondError(w, nil, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+	case rec.State != models.IdempotencyCompleted:
+		retryAfter := "5"
+		if time.Since(rec.CreatedAt) > idempotencyLockTimeout {
+			// Free the key so the next retry runs the request again
+			coll.DeleteOne(ctx, bson.M{"user_id": userID, "key": key, "state": models.IdempotencyInProgress})
+			retryAfter = "1"
+		}
+		w.Header().Set("Retry-After", retryAfter)
+		utils.RespondError(w, nil, "Request with this Idempotency-Key is in progress, retry shortly", http.StatusConflict)
+	default:
+		if rec.Location != "" {
+			w.Header().Set("Location", rec.Location)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		// A replay is the caller's own response, possibly with a debug
+		// trace, so it never goes into a shared cache
+		w.Header().Set("Cache-Control", "private, no-store")
+		if rec.JobID != "" && replayTryOnJob(ctx, w, userID, rec) {
+			return
+		}
+		body := rec.Body
+		if strings.HasPrefix(rec.ContentType, "application/json") {
+			body = represignJSON(ctx, body)
+		}
+		if rec.ContentType != "" {
+			w.Header().Set("Content-Type", rec.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(rec.Status)
+		w.Write(body)
+	}
+}
+
+// replayTryOnJob answers a replay from the job's current record, the way
+// submitTryOnJob would have, so the result URL is freshly presigned. It
+// reports false if the job can't be loaded.
+func replayTryOnJob(ctx context.Context, w http.ResponseWriter, userID string, rec models.IdempotencyRecord) bool {
+	jobID, err := primitive.ObjectIDFromHex(rec.JobID)
+	if err != nil {
+		return false
+	}
+	job, err := findTryOnJob(ctx, jobID, userID)
+	if err != nil {
+		return false
+	}
+	resp := tryOnJobResponse(ctx, *job)
+	if rec.Status == http.StatusAccepted {
+		utils.RespondJSON(w, http.StatusAccepted, resp)
+		return true
+	}
+	utils.RespondJSON(w, rec.Status, map[string]interface{}{
+		"result":        resp.Result,
+		"tryon_details": resp.TryOn,
+	})
+	return true
+}
+
+// represignJSON presigns every S3 URL in a stored JSON body again, as
+// the stored ones may have expired. The body is returned as is if it
+// isn't JSON.
+func represignJSON(ctx context.Context, body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, e := range t {
+				t[k] = walk(e)
+			}
+		case []interface{}:
+			for i, e := range t {
+				t[i] = walk(e)
+			}
+		case string:
+			if strings.Contains(t, "amazonaws.com/") && strings.Contains(t, "X-Amz-Signature=") {
+				if urls := utils.PresignImageURLs(ctx, []string{t}); len(urls) == 1 {
+					return urls[0]
+				}
+			}
+		}
+		return v
+	}
+	out, err := json.Marshal(walk(v))
+	if err != nil {
+		return body
+	}
+	return append(out, '\n')
+}
+
+// requestFingerprint hashes what makes two requests the same: method,
+// path, query and body. Multipart bodies are hashed by their fields and
+// file digests, since the boundary differs on every retry.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	if fields, ok := multipartFields(r.Header.Get("Content-Type"), body); ok {
+		for _, f := range fields {
+			fmt.Fprintln(hash, f)
+		}
+	} else {
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// multipartFields lists a multipart body's parts as "name filename
+// sha256", sorted. ok is false if the body isn't valid multipart.
+func multipartFields(contentType string, body []byte) ([]string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, false
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	var fields []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		digest := sha256.New()
+		if _, err := io.Copy(digest, part); err != nil {
+			return nil, false
+		}
+		fields = append(fields, fmt.Sprintf("%q %q %x", part.FormName(), part.FileName(), digest.Sum(nil)))
+	}
+	sort.Strings(fields)
+	return fields, true
+}
+
+// storableStatus reports whether a response is final for its key. Errors
+// the client is expected to retry aren't.
+func storableStatus(status int) bool {
+	switch status {
+	case http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return status < 500
+}
+
+// responseRecorder passes the response through while keeping a copy of
+// the status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.status = code
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
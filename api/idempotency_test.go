@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+// fingerprintRequest is a request as requestFingerprint sees it.
+type fingerprintRequest struct {
+	method, target, contentType string
+	body                        []byte
+}
+
+// multipartBody encodes fields (name, filename, content triples) with
+// the given boundary.
+func multipartBody(t *testing.T, boundary string, fields ...[3]string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fields {
+		var err error
+		if f[1] == "" {
+			err = mw.WriteField(f[0], f[2])
+		} else {
+			var w io.Writer
+			if w, err = mw.CreateFormFile(f[0], f[1]); err == nil {
+				_, err = w.Write([]byte(f[2]))
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	jsonBody := []byte(`{"product_id":"p1","person_id":"x"}`)
+	form := func(boundary string, fields ...[3]string) fingerprintRequest {
+		contentType, body := multipartBody(t, boundary, fields...)
+		return fingerprintRequest{"POST", "/try-on", contentType, body}
+	}
+	name := [3]string{"name", "", "Asha"}
+	photo := [3]string{"images", "me.jpg", "jpeg bytes"}
+	otherPhoto := [3]string{"images", "me.jpg", "other bytes"}
+
+	tests := []struct {
+		name     string
+		a, b     fingerprintRequest
+		wantSame bool
+	}{
+		{
+			name:     "same JSON request",
+			a:        fingerprintRequest{"POST", "/try-on", "application/json", jsonBody},
+			b:        fingerprintRequest{"POST", "/try-on", "application/json", jsonBody},
+			wantSame: true,
+		},
+		{
+			name: "different body",
+			a:    fingerprintRequest{"POST", "/try-on", "application/json", jsonBody},
+			b:    fingerprintRequest{"POST", "/try-on", "application/json", []byte(`{"product_id":"p2","person_id":"x"}`)},
+		},
+		{
+			name: "different method",
+			a:    fingerprintRequest{"POST", "/try-on", "application/json", jsonBody},
+			b:    fingerprintRequest{"PUT", "/try-on", "application/json", jsonBody},
+		},
+		{
+			name: "different path",
+			a:    fingerprintRequest{"POST", "/try-on", "application/json", jsonBody},
+			b:    fingerprintRequest{"POST", "/try-on/group", "application/json", jsonBody},
+		},
+		{
+			name: "different query",
+			a:    fingerprintRequest{"POST", "/try-on?theme=beach", "application/json", jsonBody},
+			b:    fingerprintRequest{"POST", "/try-on?theme=city", "application/json", jsonBody},
+		},
+		{
+			name:     "multipart retry with a new boundary",
+			a:        form("boundary-one", name, photo),
+			b:        form("boundary-two", name, photo),
+			wantSame: true,
+		},
+		{
+			name:     "multipart parts in another order",
+			a:        form("boundary-one", name, photo),
+			b:        form("boundary-two", photo, name),
+			wantSame: true,
+		},
+		{
+			name: "multipart with a different file",
+			a:    form("boundary-one", name, photo),
+			b:    form("boundary-one", name, otherPhoto),
+		},
+		{
+			name: "malformed multipart is hashed as bytes",
+			a:    fingerprintRequest{"POST", "/profile", "multipart/form-data; boundary=x", []byte("not multipart")},
+			b:    fingerprintRequest{"POST", "/profile", "multipart/form-data; boundary=x", []byte("not multipart either")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fingerprint := func(fr fingerprintRequest) string {
+				r := httptest.NewRequest(fr.method, fr.target, bytes.NewReader(fr.body))
+				r.Header.Set("Content-Type", fr.contentType)
+				return requestFingerprint(r, fr.body)
+			}
+			a, b := fingerprint(tt.a), fingerprint(tt.b)
+			if (a == b) != tt.wantSame {
+				t.Errorf("fingerprints %s and %s: same = %v, want %v", a, b, a == b, tt.wantSame)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -131,10 +133,80 @@ func IsGuestFromContext(ctx context.Context) bool {
 	return v
 }
 
-// QuotaMiddleware enforces the daily try-on cap before the handler runs and
-// increments the counter after a successful (2xx) response. Wrap it inside
-// AuthMiddleware so user_id / plan are already in context.
-func QuotaMiddleware(next http.Handler) http.Handler {
+// AdminMiddleware gates internal tooling endpoints behind ADMIN_API_SECRET,
+// sent in the X-Admin-Secret header. When the secret isn't configured the
+// endpoints 404 rather than being left open.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminAPISecret == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !secretMatches(r.Header.Get("X-Admin-Secret"), config.AdminAPISecret) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasPrivilegedSecret reports whether the request carries a valid admin
+// (X-Admin-Secret) or internal (X-Internal-Secret) secret. Used to unlock
+// debug output on otherwise user-facing endpoints.
+func hasPrivilegedSecret(r *http.Request) bool {
+	return secretMatches(r.Header.Get("X-Admin-Secret"), config.AdminAPISecret) ||
+		secretMatches(r.Header.Get("X-Internal-Secret"), config.InternalAPISecret)
+}
+
+// secretMatches compares in constant time. An unconfigured (empty) secret
+// never matches.
+func secretMatches(provided, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
+// quotaTicket carries the request's quota reservation so a handler behind
+// QuotaMiddleware can take it over, for work that finishes after the
+// response (see deferQuotaCharge).
+type quotaTicket struct {
+	reservation *utils.QuotaReservation
+	deferred    bool
+}
+
+const quotaTicketKey contextKey = "quota_ticket"
+
+// deferQuotaCharge hands the request's quota reservation to the caller,
+// who must Commit or Release it once the try-on job finishes. It returns
+// nil when the request isn't quota-limited at all.
+func deferQuotaCharge(ctx context.Context) *utils.QuotaReservation {
+	ticket, ok := ctx.Value(quotaTicketKey).(*quotaTicket)
+	if !ok {
+		return nil
+	}
+	ticket.deferred = true
+	return ticket.reservation
+}
+
+// quotaCredits returns the credits the request's quota reservation took,
+// to save on a try-on job's record, or nil.
+func quotaCredits(ctx context.Context) *models.TryOnCredits {
+	ticket, ok := ctx.Value(quotaTicketKey).(*quotaTicket)
+	if !ok || ticket.reservation.Credits == nil {
+		return nil
+	}
+	return ticket.reservation.Credits.TryOnCredits(ticket.reservation.Plan)
+}
+
+// QuotaMiddleware reserves the request's units (see QuotaCostFunc) of the
+// daily cap before the handler runs, so parallel requests can't all slip
+// under it. The reservation is committed after a successful (2xx) response
+// and released otherwise, unless the handler deferred it to a try-on job.
+// A request costing more than the daily limit that credits don't cover
+// gets 403 rather than 429.
+// Wrap it inside AuthMiddleware so user_id / plan are already in context.
+func QuotaMiddleware(next http.Handler, cost QuotaCostFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, err := GetUserIDFromContext(r.Context())
 		if err != nil {
@@ -142,42 +214,86 @@ func QuotaMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		plan := GetUserPlanFromContext(r.Context())
+		units := cost(r).Units()
 
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		status, err := utils.GetTryOnQuotaStatus(ctx, userID, plan)
-		if err != nil {
-			// Fail-open on quota lookup errors so a flaky DB doesn't block paying users.
-			fmt.Printf("[Quota] lookup failed for %s: %v — allowing\n", userID, err)
-		} else if status.Limit > 0 && status.Remaining <= 0 {
-			utils.RespondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
-				"error":      "Daily try-on limit reached. Upgrade your plan for more.",
-				"plan":       status.Plan,
-				"limit":      status.Limit,
-				"used":       status.Used,
-				"remaining":  0,
-				"reset_date": status.Date,
-				"upsell":     true,
+		reservation, err := utils.ReserveTryOnQuota(ctx, userID, plan, units)
+		if limit := models.DailyLimitForPlan(plan); errors.Is(err, utils.ErrQuotaExceeded) && limit > 0 && units > limit {
+			// Waiting for tomorrow won't help: say so instead of a 429
+			msg := fmt.Sprintf("This try-on costs %d units, more than the %s plan's daily limit of %d. Try fewer people or no theme", units, plan, limit)
+			if IsGuestFromContext(r.Context()) {
+				msg += ", or sign up for more."
+			} else {
+				msg += ", or buy credits or upgrade your plan for more."
+			}
+			utils.RespondJSON(w, http.StatusForbidden, map[string]interface{}{
+				"error":        msg,
+				"plan":         plan,
+				"limit":        limit,
+				"units_needed": units,
+				"upsell":       true,
 			})
 			return
 		}
+		if errors.Is(err, utils.ErrQuotaExceeded) {
+			status, _ := utils.GetTryOnQuotaStatus(ctx, userID, plan)
+			resp := map[string]interface{}{
+				"error":        "Daily try-on limit reached. Upgrade your plan for more.",
+				"plan":         plan,
+				"limit":        models.DailyLimitForPlan(plan),
+				"used":         status.Used,
+				"reserved":     status.Reserved,
+				"remaining":    status.Remaining,
+				"units_needed": units,
+				"reset_date":   status.Date,
+				"upsell":       true,
+			}
+			if !IsGuestFromContext(r.Context()) {
+				if credits, err := utils.GetCreditBalance(ctx, userID, plan); err == nil {
+					resp["error"] = "Daily try-on limit reached. Buy credits or upgrade your plan for more."
+					resp["credits"] = credits.Available
+				}
+			}
+			utils.RespondJSON(w, http.StatusTooManyRequests, resp)
+			return
+		}
+		if err != nil {
+			// Fail-open on quota lookup errors so a flaky DB doesn't block paying
+			// users. The unbacked reservation still counts the try-on on commit.
+			fmt.Printf("[Quota] reservation failed for %s: %v — allowing\n", userID, err)
+			reservation = &utils.QuotaReservation{UserKey: userID, Units: units}
+		}
 
 		// Run the actual try-on handler. Wrap the writer so we can detect a
-		// successful response and only then bump the counter.
+		// successful response and only then commit the reservation.
 		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(recorder, r)
+		ticket := &quotaTicket{reservation: reservation}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), quotaTicketKey, ticket)))
 
-		if recorder.status >= 200 && recorder.status < 300 {
-			bumpCtx, bumpCancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer bumpCancel()
-			if bumpErr := utils.IncrementTryOnQuota(bumpCtx, userID); bumpErr != nil {
-				fmt.Printf("[Quota] increment failed for %s: %v\n", userID, bumpErr)
-			}
+		if !ticket.deferred {
+			settleQuota(reservation, recorder.status >= 200 && recorder.status < 300)
 		}
 	})
 }
 
+// settleQuota commits a reservation for a try-on that succeeded and
+// releases it otherwise.
+func settleQuota(reservation *utils.QuotaReservation, succeeded bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var err error
+	if succeeded {
+		err = reservation.Commit(ctx)
+	} else {
+		err = reservation.Release(ctx)
+	}
+	if err != nil {
+		fmt.Printf("[Quota] %v for %s\n", err, reservation.UserKey)
+	}
+}
+
 // statusRecorder lets QuotaMiddleware see the response status without touching
 // the body. We only need WriteHeader interception; Write() implicitly calls
 // WriteHeader(200) which we capture via the default `status` field.
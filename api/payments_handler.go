@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxWebhookBody bounds a provider webhook payload.
+const maxWebhookBody = 1 << 20
+
+// CheckoutRequest is the body of POST /billing/checkout: a plan to
+// subscribe to, or a credit pack to buy.
+type CheckoutRequest struct {
+	Plan   string `json:"plan"`
+	PackID string `json:"pack_id"`
+}
+
+// CheckoutHandler starts a checkout with the configured payment provider
+// and returns the URL to send the user to. The purchase takes effect when
+// the provider's webhook arrives. Wrap with AuthMiddleware.
+func CheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Checkout API]")
+
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if IsGuestFromContext(r.Context()) {
+		utils.RespondError(w, &logMessageBuilder, "Sign up to buy a plan or credits", http.StatusForbidden)
+		return
+	}
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if utils.Payments == nil {
+		utils.RespondError(w, &logMessageBuilder, "Billing is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if (req.Plan == "") == (req.PackID == "") {
+		utils.RespondError(w, &logMessageBuilder, "Provide either plan or pack_id", http.StatusBadRequest)
+		return
+	}
+	if req.Plan != "" && req.Plan != models.PlanPlus && req.Plan != models.PlanPro {
+		utils.RespondError(w, &logMessageBuilder, "plan must be plus or pro", http.StatusBadRequest)
+		return
+	}
+	if req.PackID != "" && models.FindCreditPack(req.PackID) == nil {
+		utils.RespondError(w, &logMessageBuilder, "Unknown pack_id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if req.Plan != "" {
+		current, err := utils.CurrentSubscription(ctx, userID)
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to load subscription", http.StatusInternalServerError)
+			return
+		}
+		// An upgrade is allowed; the old subscription is cancelled once
+		// the new one is active
+		if current != nil && !current.CancelAtPeriodEnd && models.PlanRank(req.Plan) <= models.PlanRank(current.Plan) {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("You already have an active %s subscription", current.Plan), http.StatusConflict)
+			return
+		}
+	}
+
+	var user models.User
+	objID, _ := primitive.ObjectIDFromHex(userID)
+	if err := utils.GetCollection(config.DBName, "users").FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "User not found", http.StatusNotFound)
+		return
+	}
+
+	session, err := utils.Payments.CreateCheckout(ctx, utils.CheckoutRequest{
+		UserID:     userID,
+		Email:      user.Email,
+		Plan:       req.Plan,
+		PackID:     req.PackID,
+		SuccessURL: config.BillingSuccessURL,
+		CancelURL:  config.BillingCancelURL,
+	})
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to start checkout: %v", err), http.StatusBadGateway)
+		return
+	}
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Started %s checkout %s for %s (plan=%q pack=%q)", session.Provider, session.ID, userID, req.Plan, req.PackID))
+	utils.RespondJSON(w, http.StatusOK, session)
+}
+
+// CancelSubscriptionHandler stops the caller's subscription from renewing.
+// The plan stays until the period ends, when the provider's cancellation
+// webhook moves the user back to free. Wrap with AuthMiddleware.
+func CancelSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Cancel Subscription API]")
+
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	sub, err := utils.CurrentSubscription(ctx, userID)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Failed to load subscription", http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		utils.RespondError(w, &logMessageBuilder, "No active subscription", http.StatusNotFound)
+		return
+	}
+	if !sub.CancelAtPeriodEnd {
+		provider, err := utils.NewPaymentProvider(sub.Provider)
+		if err == nil {
+			err = provider.CancelSubscription(ctx, sub.ProviderSubscriptionID)
+		}
+		if err != nil {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to cancel subscription: %v", err), http.StatusBadGateway)
+			return
+		}
+		if err := utils.MarkSubscriptionCanceling(ctx, sub.ID); err != nil {
+			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to mark subscription canceling: %v", err))
+		}
+		sub.CancelAtPeriodEnd = true
+	}
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Subscription %s of %s set to cancel at period end", sub.ProviderSubscriptionID, userID))
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"subscription": sub,
+	})
+}
+
+// BillingWebhookHandler receives payment provider webhooks at
+// /billing/webhook/{provider}. Only signed payloads are applied. Errors
+// worth retrying are 5xx so the provider retries; redeliveries are
+// ignored. Public route.
+func BillingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Billing Webhook API]")
+
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/billing/webhook"), "/")
+	// The fake provider is for local use only
+	if name == utils.PaymentProviderFake && config.BillingProvider != utils.PaymentProviderFake {
+		http.NotFound(w, r)
+		return
+	}
+	provider, err := utils.NewPaymentProvider(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	event, err := provider.VerifyWebhook(payload, r.Header)
+	if errors.Is(err, utils.ErrInvalidSignature) {
+		utils.RespondError(w, &logMessageBuilder, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	if event == nil {
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	err = utils.ApplyBillingEvent(ctx, name, event)
+	if errors.Is(err, utils.ErrBadBillingEvent) {
+		// Acknowledge it: a retry would fail the same way
+		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Ignored %s event: %v", name, err))
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to apply %s event %s: %v", name, event.ID, err), http.StatusInternalServerError)
+		return
+	}
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Applied %s %s event %s for %s", name, event.Type, event.ID, event.UserID))
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+}
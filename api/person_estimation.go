@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+)
+
+// formBool reads a boolean form field ("true", "1", ...); absent or
+// unparseable values are false.
+func formBool(r *http.Request, key string) bool {
+	v, _ := strconv.ParseBool(r.FormValue(key))
+	return v
+}
+
+// estimateMeasurements fills the person's chest, waist and hips from their
+// primary photo and height via utils.Estimator. Only fields that are unset or
+// still hold an unconfirmed estimate are written, except those in skip (the
+// ones the user just entered). Filled fields are added to EstimatedFields
+// and returned.
+func estimateMeasurements(ctx context.Context, person *models.Person, skip map[string]bool) ([]string, error) {
+	photos, err := person.TryOnPhotos("", nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("a full-body photo is required to estimate measurements")
+	}
+	if person.Height <= 0 {
+		return nil, fmt.Errorf("height is required to estimate measurements")
+	}
+
+	imageURL, err := utils.GetPresignedURL(ctx, photos[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presigned URL for person image: %v", err)
+	}
+
+	estimateCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	// Estimation calls the image model, so it shares the generation slots
+	ticket, err := utils.Scheduler.Acquire(estimateCtx, GetUserPlanFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("measurement estimation is busy, try again shortly: %w", err)
+	}
+	defer ticket.Done()
+	est, err := utils.Estimator.EstimateMeasurements(estimateCtx, utils.MeasurementEstimateRequest{
+		ImageURL: imageURL,
+		HeightCM: person.Height,
+		Gender:   person.Gender,
+		Age:      person.Age,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[string]struct {
+		current *float64
+		value   float64
+	}{
+		models.MeasureChest: {&person.Chest, est.Chest},
+		models.MeasureWaist: {&person.Waist, est.Waist},
+		models.MeasureHips:  {&person.Hips, est.Hips},
+	}
+	var filled []string
+	for _, field := range models.EstimableMeasurements {
+		t := targets[field]
+		if skip[field] || t.value <= 0 || (*t.current > 0 && !person.IsEstimated(field)) {
+			continue
+		}
+		*t.current = t.value
+		if !person.IsEstimated(field) {
+			person.EstimatedFields = append(person.EstimatedFields, field)
+		}
+		filled = append(filled, field)
+	}
+	return filled, nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+)
+
+// stubEstimator swaps utils.Estimator for estimate for the test, and
+// presigns with dummy credentials so no AWS setup is needed.
+func stubEstimator(t *testing.T, estimate utils.MeasurementEstimatorFunc) {
+	t.Helper()
+	estimator, presign := utils.Estimator, utils.PresignClient
+	t.Cleanup(func() { utils.Estimator, utils.PresignClient = estimator, presign })
+
+	utils.Estimator = estimate
+	utils.PresignClient = s3.NewPresignClient(s3.New(s3.Options{
+		Region: "ap-south-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	}))
+}
+
+func TestEstimateMeasurements(t *testing.T) {
+	estimate := &utils.MeasurementEstimate{Chest: 100, Waist: 84, Hips: 0}
+	errModel := errors.New("model unavailable")
+
+	tests := []struct {
+		name       string
+		person     models.Person
+		skip       map[string]bool
+		estErr     error
+		wantErr    bool
+		wantFilled []string
+		wantChest  float64
+		wantWaist  float64
+	}{
+		{
+			name:       "fills unset measurements",
+			person:     models.Person{Height: 175, ImagePaths: []string{"persons/a.jpg"}},
+			wantFilled: []string{models.MeasureChest, models.MeasureWaist},
+			wantChest:  100,
+			wantWaist:  84,
+		},
+		{
+			name:       "keeps measurements the user entered",
+			person:     models.Person{Height: 175, ImagePaths: []string{"persons/a.jpg"}, Chest: 96},
+			wantFilled: []string{models.MeasureWaist},
+			wantChest:  96,
+			wantWaist:  84,
+		},
+		{
+			name:       "replaces an earlier estimate",
+			person:     models.Person{Height: 175, ImagePaths: []string{"persons/a.jpg"}, Chest: 90, EstimatedFields: []string{models.MeasureChest}},
+			wantFilled: []string{models.MeasureChest, models.MeasureWaist},
+			wantChest:  100,
+			wantWaist:  84,
+		},
+		{
+			name:       "skips fields just entered",
+			person:     models.Person{Height: 175, ImagePaths: []string{"persons/a.jpg"}, Chest: 90, EstimatedFields: []string{models.MeasureChest}},
+			skip:       map[string]bool{models.MeasureChest: true},
+			wantFilled: []string{models.MeasureWaist},
+			wantChest:  90,
+			wantWaist:  84,
+		},
+		{
+			name:    "needs a photo",
+			person:  models.Person{Height: 175},
+			wantErr: true,
+		},
+		{
+			name:    "needs a height",
+			person:  models.Person{ImagePaths: []string{"persons/a.jpg"}},
+			wantErr: true,
+		},
+		{
+			name:    "estimator failure",
+			person:  models.Person{Height: 175, ImagePaths: []string{"persons/a.jpg"}},
+			estErr:  errModel,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got utils.MeasurementEstimateRequest
+			stubEstimator(t, func(ctx context.Context, req utils.MeasurementEstimateRequest) (*utils.MeasurementEstimate, error) {
+				got = req
+				if tt.estErr != nil {
+					return nil, tt.estErr
+				}
+				e := *estimate
+				return &e, nil
+			})
+
+			person := tt.person
+			filled, err := estimateMeasurements(context.Background(), &person, tt.skip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.estErr != nil && !errors.Is(err, tt.estErr) {
+				t.Errorf("err = %v, want the estimator's", err)
+			}
+			if err != nil {
+				return
+			}
+			if got.HeightCM != person.Height || got.ImageURL == "" {
+				t.Errorf("estimator got %+v, want the height and a presigned photo URL", got)
+			}
+			if !slices.Equal(filled, tt.wantFilled) {
+				t.Errorf("filled = %v, want %v", filled, tt.wantFilled)
+			}
+			if person.Chest != tt.wantChest || person.Waist != tt.wantWaist || person.Hips != 0 {
+				t.Errorf("chest %v, waist %v, hips %v; want %v, %v, 0", person.Chest, person.Waist, person.Hips, tt.wantChest, tt.wantWaist)
+			}
+			for _, f := range tt.wantFilled {
+				if !person.IsEstimated(f) {
+					t.Errorf("%s not marked as estimated", f)
+				}
+			}
+			if person.IsEstimated(models.MeasureHips) {
+				t.Error("hips marked as estimated without a value")
+			}
+		})
+	}
+}
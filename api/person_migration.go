@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// legacyGirthsInInches decides the unit of one legacy person's chest,
+// waist and hips: from their units preference when one was saved, else
+// inches, as the model documented before unit handling.
+func legacyGirthsInInches(p *models.Person) bool {
+	if models.IsValidUnits(p.Units) {
+		return p.Units != models.UnitsMetric
+	}
+	return true
+}
+
+// MigratePersonMeasurements converts person documents saved before unit
+// handling to canonical cm / kg and marks them with
+// models.MeasurementUnitCM, so running it again is a no-op. Height and
+// weight were always cm / kg; chest, waist and hips are converted from
+// inches when legacyGirthsInInches says so. Persons without a preference
+// get models.UnitsLegacy, so their responses keep the old units.
+func MigratePersonMeasurements() (int, error) {
+	collection := utils.GetCollection(config.DBName, CollectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"measurement_unit": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var person models.Person
+		if err := cursor.Decode(&person); err != nil {
+			return migrated, err
+		}
+
+		set := bson.M{"measurement_unit": models.MeasurementUnitCM}
+		if !models.IsValidUnits(person.Units) {
+			set["units"] = models.UnitsLegacy
+		}
+		if legacyGirthsInInches(&person) {
+			for field, value := range map[string]float64{"chest": person.Chest, "waist": person.Waist, "hips": person.Hips} {
+				if value > 0 {
+					set[field] = models.LengthToCM(value, models.UnitsImperial)
+				}
+			}
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": person.ID, "measurement_unit": bson.M{"$exists": false}}, bson.M{"$set": set}); err != nil {
+			return migrated, fmt.Errorf("person %s: %w", person.ID.Hex(), err)
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/utils"
+)
+
+// personPhoto is a normalized (JPEG) person image that passed the quality
+// gate.
+type personPhoto struct {
+	filename string
+	data     []byte
+}
+
+// photoRejection lists the quality issues of one rejected upload.
+type photoRejection struct {
+	File   string             `json:"file"`
+	Issues []utils.PhotoIssue `json:"issues"`
+}
+
+// checkPersonPhotos normalizes every uploaded person photo and runs the
+// quality gate on it, so nothing is uploaded unless all of them pass. On
+// failure it responds 422 with the issues per file (400 for a file that
+// can't be read at all, 503 when no generation slot frees up for the
+// check) and returns false.
+func checkPersonPhotos(w http.ResponseWriter, r *http.Request, logMessageBuilder *strings.Builder, files []*multipart.FileHeader) ([]personPhoto, bool) {
+	var photos []personPhoto
+	var rejected []photoRejection
+	for _, fileHeader := range files {
+		data, err := utils.NormalizeUpload(fileHeader)
+		if errors.Is(err, utils.ErrNotAnImage) || errors.Is(err, utils.ErrImageTooLarge) {
+			rejected = append(rejected, photoRejection{File: fileHeader.Filename, Issues: []utils.PhotoIssue{{Code: utils.PhotoIssueUnreadable, Message: err.Error()}}})
+			continue
+		}
+		if err != nil {
+			utils.RespondError(w, logMessageBuilder, fmt.Sprintf("Failed to read photo %s: %v", fileHeader.Filename, err), http.StatusBadRequest)
+			return nil, false
+		}
+
+		// People detection calls the image model, so the check shares the
+		// generation slots
+		ticket, err := utils.Scheduler.Acquire(r.Context(), GetUserPlanFromContext(r.Context()))
+		if err != nil {
+			utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Photo check not scheduled: %v", err))
+			utils.RespondError(w, nil, "We're at capacity, please try again in a moment.", http.StatusServiceUnavailable)
+			return nil, false
+		}
+		issues, err := utils.CheckPersonPhoto(r.Context(), data)
+		ticket.Done()
+		if err != nil {
+			utils.RespondError(w, logMessageBuilder, fmt.Sprintf("Failed to check photo %s: %v", fileHeader.Filename, err), http.StatusInternalServerError)
+			return nil, false
+		}
+		if len(issues) > 0 {
+			rejected = append(rejected, photoRejection{File: fileHeader.Filename, Issues: issues})
+			continue
+		}
+		photos = append(photos, personPhoto{filename: utils.JPEGFilename(fileHeader.Filename), data: data})
+	}
+
+	if len(rejected) > 0 {
+		utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Rejected %d person photo(s)", len(rejected)))
+		utils.RespondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "Photo quality check failed",
+			"photos": rejected,
+		})
+		return nil, false
+	}
+	return photos, true
+}
+
+// uploadPersonPhotos uploads checked photos under person_images/ and
+// returns their S3 keys. If one fails it responds 500 naming the file and
+// returns false.
+func uploadPersonPhotos(w http.ResponseWriter, r *http.Request, logMessageBuilder *strings.Builder, photos []personPhoto) ([]string, bool) {
+	var imagePaths []string
+	for _, photo := range photos {
+		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), photo.filename)
+		objectKey := fmt.Sprintf("person_images/%s", filename)
+
+		if _, err := utils.UploadFileToS3(r.Context(), bytes.NewReader(photo.data), objectKey, "image/jpeg", utils.CacheControlMutable); err != nil {
+			utils.RespondError(w, logMessageBuilder, fmt.Sprintf("Failed to upload photo %s: %v", photo.filename, err), http.StatusInternalServerError)
+			return nil, false
+		}
+		imagePaths = append(imagePaths, objectKey)
+	}
+	return imagePaths, true
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+)
+
+// AdminPlansHandler serves the plan entitlements: GET /admin/plans lists
+// every plan, GET /admin/plans/{plan} returns one, and PUT
+// /admin/plans/{plan} updates it: fields missing from the body keep
+// their current values. Edits apply on this instance at once
+// and on the others within a minute. Wrap with AdminMiddleware.
+func AdminPlansHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Admin Plans API]")
+
+	plan := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/plans"), "/")
+	if plan != "" && !slices.Contains(models.Plans, plan) {
+		utils.RespondError(w, &logMessageBuilder, "Unknown plan", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if plan == "" {
+			utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+				"plans": models.AllPlanEntitlements(),
+			})
+			return
+		}
+		utils.RespondJSON(w, http.StatusOK, models.EntitlementsForPlan(plan))
+
+	case http.MethodPut:
+		if plan == "" {
+			utils.RespondError(w, &logMessageBuilder, "Plan is required", http.StatusMethodNotAllowed)
+			return
+		}
+		// Decode over the current plan so omitted fields aren't zeroed
+		ent := models.EntitlementsForPlan(plan)
+		ent.TryOnTypes = slices.Clone(ent.TryOnTypes)
+		if err := json.NewDecoder(r.Body).Decode(&ent); err != nil {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		ent.Plan = plan
+		if err := ent.Validate(); err != nil {
+			utils.RespondError(w, &logMessageBuilder, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := utils.SavePlanEntitlements(ctx, ent); err != nil {
+			utils.RespondError(w, &logMessageBuilder, "Failed to save plan: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Updated plan %s: %+v", plan, ent))
+		utils.RespondJSON(w, http.StatusOK, models.EntitlementsForPlan(plan))
+
+	default:
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
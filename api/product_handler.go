@@ -0,0 +1,367 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PatchProductRequest represents the owner's corrections to a scraped
+// product. Omitted fields are left unchanged. Image entries may be the
+// presigned URLs returned by the API; they are matched by S3 key.
+type PatchProductRequest struct {
+	Title           *string   `json:"title"`
+	Category        *string   `json:"category"`
+	MRP             *string   `json:"mrp"`
+	DiscountedPrice *string   `json:"discounted_price"`
+	Material        *string   `json:"material"`
+	Slot            *string   `json:"slot"`            // One of models.GarmentSlots; re-derived from category/title when omitted
+	Images          []string  `json:"image_paths"`     // New order; must contain every existing image exactly once
+	ExcludedImages  *[]string `json:"excluded_images"` // Replaces the current exclusion list
+	PreferredImage  *string   `json:"preferred_image"` // "" clears the preference
+}
+
+// SizeRecommendationResponse is the response of
+// GET /product/{id}/size-recommendation.
+type SizeRecommendationResponse struct {
+	ProductID string `json:"product_id"`
+	PersonID  string `json:"person_id"`
+	*models.SizeRecommendation
+}
+
+// ProductHandler handles requests to /product/{id} and
+// /product/{id}/size-recommendation
+func ProductHandler(w http.ResponseWriter, r *http.Request) {
+	// /product/{id} -> ["product", "id"]
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) < 2 || len(pathParts) > 3 || pathParts[1] == "" {
+		utils.RespondError(w, nil, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if len(pathParts) == 3 {
+		if pathParts[2] != "size-recommendation" {
+			utils.RespondError(w, nil, "Not found", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sizeRecommendation(w, r, pathParts[1])
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		patchProduct(w, r, pathParts[1])
+		return
+	}
+
+	utils.RespondError(w, nil, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// patchProduct applies the owner's corrections and image curation to a
+// product. The curated images are what VirtualTryOnHandler sends to Gemini.
+func patchProduct(w http.ResponseWriter, r *http.Request, productIDHex string) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Patch Product API]")
+
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := primitive.ObjectIDFromHex(productIDHex)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req PatchProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	collection := utils.GetCollection(config.DBName, "products")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": productID, "user_id": userID, "status": bson.M{"$ne": "failed"}}
+	var product models.Product
+	if err := collection.FindOne(ctx, filter).Decode(&product); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Product not found or unauthorized", http.StatusNotFound)
+		return
+	}
+
+	// Product has no bson tags on most scalar fields, so these are the
+	// driver's default lower-cased field names.
+	set := bson.M{}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			utils.RespondError(w, &logMessageBuilder, "title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		product.Title = title
+		set["title"] = title
+	}
+	if req.Category != nil {
+		product.Category = strings.TrimSpace(*req.Category)
+		set["category"] = product.Category
+	}
+	if req.MRP != nil {
+		product.MRP = strings.TrimSpace(*req.MRP)
+		set["mrp"] = product.MRP
+	}
+	if req.DiscountedPrice != nil {
+		product.DiscountedPrice = strings.TrimSpace(*req.DiscountedPrice)
+		set["discountedprice"] = product.DiscountedPrice
+	}
+	if req.Material != nil {
+		product.Material = strings.TrimSpace(*req.Material)
+		set["material"] = product.Material
+	}
+
+	if req.Slot != nil {
+		if !models.IsValidSlot(*req.Slot) {
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("slot must be one of: %s", strings.Join(models.GarmentSlots, ", ")), http.StatusBadRequest)
+			return
+		}
+		product.Slot = *req.Slot
+		set["slot"] = product.Slot
+	} else if req.Category != nil || req.Title != nil {
+		if slot := scrapers.ClassifyProduct(&product); slot != "" && slot != product.Slot {
+			product.Slot = slot
+			set["slot"] = slot
+		}
+	}
+
+	if req.Material != nil || req.Title != nil {
+		product.Attributes = scrapers.NormalizeAttributes(&product)
+		set["attributes"] = product.Attributes
+	}
+
+	// Image curation
+	existing := make(map[string]bool, len(product.Images))
+	for _, img := range product.Images {
+		existing[img] = true
+	}
+
+	if req.Images != nil {
+		ordered := make([]string, 0, len(req.Images))
+		seen := make(map[string]bool, len(req.Images))
+		for _, img := range req.Images {
+			key := extractS3Key(img)
+			if !existing[key] || seen[key] {
+				utils.RespondError(w, &logMessageBuilder, "image_paths must list each existing image exactly once", http.StatusBadRequest)
+				return
+			}
+			seen[key] = true
+			ordered = append(ordered, key)
+		}
+		if len(ordered) != len(product.Images) {
+			utils.RespondError(w, &logMessageBuilder, "image_paths must list each existing image exactly once", http.StatusBadRequest)
+			return
+		}
+		product.Images = ordered
+		set["images"] = ordered
+	}
+
+	if req.ExcludedImages != nil {
+		excluded := make([]string, 0, len(*req.ExcludedImages))
+		for _, img := range *req.ExcludedImages {
+			key := extractS3Key(img)
+			if !existing[key] {
+				utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Unknown image in excluded_images: %s", img), http.StatusBadRequest)
+				return
+			}
+			excluded = append(excluded, key)
+		}
+		product.ExcludedImages = excluded
+		set["excluded_images"] = excluded
+	}
+
+	if req.PreferredImage != nil {
+		preferred := ""
+		if *req.PreferredImage != "" {
+			preferred = extractS3Key(*req.PreferredImage)
+			if !existing[preferred] {
+				utils.RespondError(w, &logMessageBuilder, "preferred_image must be one of the product's images", http.StatusBadRequest)
+				return
+			}
+		}
+		product.PreferredImage = preferred
+		set["preferred_image"] = preferred
+	}
+
+	for _, img := range product.ExcludedImages {
+		if img == product.PreferredImage {
+			utils.RespondError(w, &logMessageBuilder, "preferred_image cannot also be excluded", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(product.Images) > 0 && len(product.TryOnImages()) == 0 {
+		utils.RespondError(w, &logMessageBuilder, "At least one image must remain for try-on", http.StatusBadRequest)
+		return
+	}
+
+	if len(set) == 0 {
+		utils.RespondError(w, &logMessageBuilder, "No changes provided", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	product.EditedAt = &now
+	set["edited_at"] = now
+
+	if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set}); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Failed to update product", http.StatusInternalServerError)
+		return
+	}
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Updated product %s (%d fields)", productIDHex, len(set)))
+
+	// Generate Presigned URLs for response
+	product.Images = utils.PresignImageURLs(r.Context(), product.Images)
+	product.ExcludedImages = utils.PresignImageURLs(r.Context(), product.ExcludedImages)
+	if product.PreferredImage != "" {
+		product.PreferredImage = utils.PresignImageURLs(r.Context(), []string{product.PreferredImage})[0]
+	}
+	for i := range product.Variants {
+		product.Variants[i].Images = utils.PresignImageURLs(r.Context(), product.Variants[i].Images)
+	}
+	product.ScrapeTrace = nil
+
+	utils.RespondJSON(w, http.StatusOK, product)
+}
+
+// sizeRecommendation recommends a size of the product for one of the
+// user's persons, from the product's scraped size chart or, failing that,
+// a brand / generic default chart.
+func sizeRecommendation(w http.ResponseWriter, r *http.Request, productIDHex string) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Size Recommendation API]")
+
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := primitive.ObjectIDFromHex(productIDHex)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	personIDHex := r.URL.Query().Get("person_id")
+	personID, err := primitive.ObjectIDFromHex(personIDHex)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Invalid or missing person_id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var product models.Product
+	productFilter := bson.M{"_id": productID, "user_id": userID, "status": bson.M{"$ne": "failed"}}
+	if err := utils.GetCollection(config.DBName, "products").FindOne(ctx, productFilter).Decode(&product); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Product not found or unauthorized", http.StatusNotFound)
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var person models.Person
+	personFilter := bson.M{"_id": personID, "user_id": userObjID, "is_deleted": bson.M{"$ne": true}}
+	if err := utils.GetCollection(config.DBName, CollectionName).FindOne(ctx, personFilter).Decode(&person); err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Person not found", http.StatusNotFound)
+		return
+	}
+
+	body := person.BodyMeasurementsCM()
+	if len(body) == 0 {
+		utils.RespondError(w, &logMessageBuilder, "Person has no chest, waist or hips measurements", http.StatusUnprocessableEntity)
+		return
+	}
+
+	slot := product.Slot
+	if slot == "" {
+		slot = scrapers.ClassifyProduct(&product)
+	}
+	chart := productSizeChart(&product, slot, person.Gender)
+	if chart == nil {
+		utils.RespondError(w, &logMessageBuilder, "No size chart available for this product", http.StatusUnprocessableEntity)
+		return
+	}
+
+	rec := models.RecommendSize(chart, body, slot)
+	if rec == nil {
+		utils.RespondError(w, &logMessageBuilder, "Size chart has none of the person's measurements", http.StatusUnprocessableEntity)
+		return
+	}
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Product %s, person %s: %s (%s, %s chart)", productIDHex, personIDHex, rec.Size, rec.Confidence, rec.ChartSource))
+
+	utils.RespondJSON(w, http.StatusOK, SizeRecommendationResponse{
+		ProductID:          productIDHex,
+		PersonID:           personIDHex,
+		SizeRecommendation: rec,
+	})
+}
+
+// productSizeChart returns the scraped chart when it has measurements.
+// Otherwise it falls back to models.DefaultSizeChart, narrowed to the
+// sizes the product is sold in (with their stock) when the scraper found
+// size variants.
+func productSizeChart(product *models.Product, slot, gender string) *models.SizeChart {
+	if product.SizeChart != nil {
+		for _, entry := range product.SizeChart.Sizes {
+			if len(entry.Measurements) > 0 {
+				return product.SizeChart
+			}
+		}
+	}
+
+	chart := models.DefaultSizeChart(product.Brand, slot, gender)
+	if chart == nil {
+		return nil
+	}
+
+	offered := make(map[string]*bool)
+	for _, v := range product.Variants {
+		if size := strings.ToUpper(strings.TrimSpace(v.Size)); size != "" {
+			offered[size] = v.Available
+		}
+	}
+	var sizes []models.SizeChartEntry
+	for _, entry := range chart.Sizes {
+		if available, ok := offered[strings.ToUpper(entry.Label)]; ok {
+			entry.Available = available
+			sizes = append(sizes, entry)
+		}
+	}
+	if len(sizes) > 0 {
+		chart.Sizes = sizes
+	}
+	return chart
+}
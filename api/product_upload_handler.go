@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -46,18 +47,23 @@ func UploadProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var imagePaths []string
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
+	// Normalize everything first so a non-image rejects the whole request
+	normalized := make([][]byte, len(files))
+	for i, fileHeader := range files {
+		data, err := utils.NormalizeUpload(fileHeader)
 		if err != nil {
-			continue
+			utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Invalid image %s: %v", fileHeader.Filename, err), http.StatusUnsupportedMediaType)
+			return
 		}
-		defer file.Close()
+		normalized[i] = data
+	}
 
-		filename := fmt.Sprintf("prod_%d_%s", time.Now().UnixNano(), fileHeader.Filename)
+	var imagePaths []string
+	for i, fileHeader := range files {
+		filename := fmt.Sprintf("prod_%d_%s", time.Now().UnixNano(), utils.JPEGFilename(fileHeader.Filename))
 		objectKey := fmt.Sprintf("product_uploads/%s", filename)
 
-		_, err = utils.UploadFileToS3(r.Context(), file, objectKey, fileHeader.Header.Get("Content-Type"))
+		_, err = utils.UploadFileToS3(r.Context(), bytes.NewReader(normalized[i]), objectKey, "image/jpeg")
 		if err != nil {
 			fmt.Printf("Failed to upload %s: %v\n", filename, err)
 			continue
@@ -50,6 +50,12 @@ func createPerson(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := primitive.ObjectIDFromHex(userIdStr)
 
+	slot, ok := reservePlanSlot(w, r, &logMessageBuilder, CollectionName)
+	if !ok {
+		return
+	}
+	defer slot.release()
+
 	// Parse multipart form (max 10MB)
 	err = r.ParseMultipartForm(10 << 20)
 	if err != nil {
@@ -72,6 +78,12 @@ func createPerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	units, ok := formUnits(r, models.UnitsLegacy)
+	if !ok {
+		utils.RespondError(w, &logMessageBuilder, "units must be 'metric', 'imperial' or 'legacy'", http.StatusBadRequest)
+		return
+	}
+
 	// Parse numeric values
 	age, _ := strconv.Atoi(ageStr)
 	height, _ := strconv.ParseFloat(heightStr, 64)
@@ -80,45 +92,60 @@ func createPerson(w http.ResponseWriter, r *http.Request) {
 	waist, _ := strconv.ParseFloat(waistStr, 64)
 	hips, _ := strconv.ParseFloat(hipsStr, 64)
 
-	// Handle file uploads
-	files := r.MultipartForm.File["images"]
-	var imagePaths []string
+	// Store in cm / kg whatever the input unit
+	height = models.LengthToCM(height, units)
+	weight = models.WeightToKG(weight, units)
+	chest = models.GirthToCM(chest, units)
+	waist = models.GirthToCM(waist, units)
+	hips = models.GirthToCM(hips, units)
 
-	if len(files) > 0 {
-		for _, fileHeader := range files {
-			file, err := fileHeader.Open()
-			if err != nil {
-				continue
-			}
-
-			filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), fileHeader.Filename)
-			objectKey := fmt.Sprintf("person_images/%s", filename)
-
-			_, err = utils.UploadFileToS3(r.Context(), file, objectKey, fileHeader.Header.Get("Content-Type"), utils.CacheControlMutable)
-			file.Close()
-			if err != nil {
-				fmt.Printf("Failed to upload %s: %v\n", filename, err)
-				continue
-			}
+	// Handle file uploads (quality-checked before anything is stored)
+	photos, ok := checkPersonPhotos(w, r, &logMessageBuilder, r.MultipartForm.File["images"])
+	if !ok {
+		return
+	}
+	imagePaths, ok := uploadPersonPhotos(w, r, &logMessageBuilder, photos)
+	if !ok {
+		return
+	}
 
-			imagePaths = append(imagePaths, objectKey)
+	primaryImage := ""
+	if v := r.FormValue("primary_image"); v != "" {
+		var ok bool
+		if primaryImage, ok = resolvePersonImage(v, imagePaths); !ok {
+			utils.RespondError(w, &logMessageBuilder, "primary_image must be the index of an uploaded image", http.StatusBadRequest)
+			return
 		}
 	}
 
 	person := models.Person{
-		UserID:     userID,
-		Name:       name,
-		Age:        age,
-		Gender:     gender,
-		Height:     height,
-		Weight:     weight,
-		Chest:      chest,
-		Waist:      waist,
-		Hips:       hips,
-		ImagePaths: imagePaths,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-		IsDeleted:  false,
+		UserID:          userID,
+		Name:            name,
+		Age:             age,
+		Gender:          gender,
+		Height:          height,
+		Weight:          weight,
+		Chest:           chest,
+		Waist:           waist,
+		Hips:            hips,
+		Units:           units,
+		MeasurementUnit: models.MeasurementUnitCM,
+		ImagePaths:      imagePaths,
+		PrimaryImage:    primaryImage,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		IsDeleted:       false,
+	}
+
+	// Optional: estimate the measurements left empty from the photo
+	if formBool(r, "estimate_measurements") {
+		filled, err := estimateMeasurements(r.Context(), &person, nil)
+		if err != nil {
+			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Measurement estimation failed: %v", err))
+			person.EstimationError = err.Error()
+		} else {
+			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Estimated %v", filled))
+		}
 	}
 
 	collection := utils.GetCollection(config.DBName, CollectionName)
@@ -131,8 +158,9 @@ func createPerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	person.ID = result.InsertedID.(primitive.ObjectID)
+	slot.keep()
 
-	utils.RespondJSON(w, http.StatusCreated, person)
+	utils.RespondJSON(w, http.StatusCreated, person.InUnits(responseUnits(r, &person)))
 }
 
 func getPersons(w http.ResponseWriter, r *http.Request) {
@@ -177,7 +205,8 @@ func getPersons(w http.ResponseWriter, r *http.Request) {
 
 	// Generate Presigned URLs
 	for i := range persons {
-		persons[i].ImagePaths = utils.PresignImageURLs(r.Context(), persons[i].ImagePaths)
+		presignPersonImages(r, &persons[i])
+		persons[i] = persons[i].InUnits(responseUnits(r, &persons[i]))
 	}
 
 	utils.RespondJSONWithETag(w, r, http.StatusOK, persons)
@@ -202,9 +231,9 @@ func getPersonByID(w http.ResponseWriter, r *http.Request, idStr string, userID
 	}
 
 	// Generate Presigned URLs
-	person.ImagePaths = utils.PresignImageURLs(r.Context(), person.ImagePaths)
+	presignPersonImages(r, &person)
 
-	utils.RespondJSONWithETag(w, r, http.StatusOK, person)
+	utils.RespondJSONWithETag(w, r, http.StatusOK, person.InUnits(responseUnits(r, &person)))
 }
 
 func deletePerson(w http.ResponseWriter, r *http.Request) {
@@ -239,7 +268,7 @@ func deletePerson(w http.ResponseWriter, r *http.Request) {
 
 	// Soft delete: set is_deleted = true
 	update := bson.M{"$set": bson.M{"is_deleted": true, "updated_at": time.Now()}}
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": personID, "user_id": userID}, update)
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": personID, "user_id": userID, "is_deleted": bson.M{"$ne": true}}, update)
 	if err != nil {
 		http.Error(w, "Error deleting person", http.StatusInternalServerError)
 		return
@@ -249,6 +278,7 @@ func deletePerson(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Person not found or unauthorized", http.StatusNotFound)
 		return
 	}
+	releaseSavedItem(userIdStr, CollectionName)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -301,6 +331,18 @@ func updatePerson(w http.ResponseWriter, r *http.Request) {
 	updateFields := bson.M{}
 	updateFields["updated_at"] = time.Now()
 
+	// Values are read in the units sent with this request, else the
+	// person's saved preference. Sending units also changes the preference.
+	units, ok := formUnits(r, storedUnits(&person))
+	if !ok {
+		utils.RespondError(w, &logMessageBuilder, "units must be 'metric', 'imperial' or 'legacy'", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("units") != "" {
+		updateFields["units"] = units
+		person.Units = units
+	}
+
 	if name := r.FormValue("name"); name != "" {
 		updateFields["name"] = name
 		person.Name = name
@@ -318,61 +360,99 @@ func updatePerson(w http.ResponseWriter, r *http.Request) {
 	// For floats, checks if parseable. If 0 is sent as string "0", it updates.
 	if str := r.FormValue("height"); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
+			val = models.LengthToCM(val, units)
 			updateFields["height"] = val
 			person.Height = val
 		}
 	}
 	if str := r.FormValue("weight"); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
+			val = models.WeightToKG(val, units)
 			updateFields["weight"] = val
 			person.Weight = val
 		}
 	}
 	if str := r.FormValue("chest"); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
+			val = models.GirthToCM(val, units)
 			updateFields["chest"] = val
 			person.Chest = val
 		}
 	}
 	if str := r.FormValue("waist"); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
+			val = models.GirthToCM(val, units)
 			updateFields["waist"] = val
 			person.Waist = val
 		}
 	}
 	if str := r.FormValue("hips"); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
+			val = models.GirthToCM(val, units)
 			updateFields["hips"] = val
 			person.Hips = val
 		}
 	}
 
-	// 3. Handle File Uploads
-	files := r.MultipartForm.File["images"]
-	if len(files) > 0 {
-		var imagePaths []string
-		for _, fileHeader := range files {
-			file, err := fileHeader.Open()
-			if err != nil {
-				continue
-			}
-
-			filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), fileHeader.Filename)
-			objectKey := fmt.Sprintf("person_images/%s", filename)
+	// Measurements the user entered themselves are no longer estimates;
+	// confirm_measurements accepts the remaining estimates as they are.
+	entered := make(map[string]bool)
+	for _, field := range models.EstimableMeasurements {
+		if _, ok := updateFields[field]; ok {
+			entered[field] = true
+			person.ClearEstimated(field)
+		}
+	}
+	if formBool(r, "confirm_measurements") {
+		person.EstimatedFields = nil
+	}
 
-			_, err = utils.UploadFileToS3(r.Context(), file, objectKey, fileHeader.Header.Get("Content-Type"), utils.CacheControlMutable)
-			file.Close()
-			if err != nil {
-				fmt.Printf("Failed to upload %s: %v\n", filename, err)
-				continue
-			}
-			imagePaths = append(imagePaths, objectKey)
+	// 3. Handle File Uploads (quality-checked before anything is stored)
+	photos, ok := checkPersonPhotos(w, r, &logMessageBuilder, r.MultipartForm.File["images"])
+	if !ok {
+		return
+	}
+	if len(photos) > 0 {
+		imagePaths, ok := uploadPersonPhotos(w, r, &logMessageBuilder, photos)
+		if !ok {
+			return
 		}
 		if len(imagePaths) > 0 {
 			updateFields["image_paths"] = imagePaths
 			person.ImagePaths = imagePaths
+			if _, ok := resolvePersonImage(person.PrimaryImage, imagePaths); !ok && person.PrimaryImage != "" {
+				updateFields["primary_image"] = ""
+				person.PrimaryImage = ""
+			}
+		}
+	}
+
+	// Primary photo: index into, or key / URL of, the (possibly new) images
+	if v := r.FormValue("primary_image"); v != "" {
+		primary, ok := resolvePersonImage(v, person.ImagePaths)
+		if !ok {
+			utils.RespondError(w, &logMessageBuilder, "primary_image must be an index, key or URL of one of the person's images", http.StatusBadRequest)
+			return
+		}
+		updateFields["primary_image"] = primary
+		person.PrimaryImage = primary
+	}
+
+	// Optional: estimate unset or still-estimated measurements from the
+	// (possibly new) first photo
+	if formBool(r, "estimate_measurements") {
+		filled, err := estimateMeasurements(r.Context(), &person, entered)
+		if err != nil {
+			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Measurement estimation failed: %v", err))
+			person.EstimationError = err.Error()
+		} else {
+			utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Estimated %v", filled))
 		}
+		updateFields["chest"] = person.Chest
+		updateFields["waist"] = person.Waist
+		updateFields["hips"] = person.Hips
 	}
+	updateFields["estimated_fields"] = person.EstimatedFields
 
 	// 4. Perform Update
 	_, err = collection.UpdateOne(ctx, bson.M{"_id": personID}, bson.M{"$set": updateFields})
@@ -382,7 +462,65 @@ func updatePerson(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 5. Return Updated Person (with presigned URLs for current images)
+	presignPersonImages(r, &person)
+
+	utils.RespondJSONWithETag(w, r, http.StatusOK, person.InUnits(responseUnits(r, &person)))
+}
+
+// resolvePersonImage maps a primary_image value (an index, S3 key or
+// presigned URL) to one of paths.
+func resolvePersonImage(value string, paths []string) (string, bool) {
+	if i, err := strconv.Atoi(value); err == nil {
+		if i < 0 || i >= len(paths) {
+			return "", false
+		}
+		return paths[i], true
+	}
+	key := extractS3Key(value)
+	for _, p := range paths {
+		if p == key {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// presignPersonImages swaps the person's image keys for presigned URLs.
+// A key that can't be presigned is left as is, like PresignImageURLs does.
+func presignPersonImages(r *http.Request, person *models.Person) {
+	if person.PrimaryImage != "" {
+		if url, err := utils.GetPresignedURL(r.Context(), person.PrimaryImage); err == nil {
+			person.PrimaryImage = url
+		} else {
+			fmt.Printf("[Profile] failed to presign primary image %s: %v\n", person.PrimaryImage, err)
+		}
+	}
 	person.ImagePaths = utils.PresignImageURLs(r.Context(), person.ImagePaths)
+}
 
-	utils.RespondJSONWithETag(w, r, http.StatusOK, person)
+// formUnits reads the "units" form field, defaulting to fallback. ok is
+// false for an unsupported unit system.
+func formUnits(r *http.Request, fallback string) (string, bool) {
+	units := strings.ToLower(strings.TrimSpace(r.FormValue("units")))
+	if units == "" {
+		return fallback, true
+	}
+	return units, models.IsValidUnits(units)
+}
+
+// storedUnits is the person's unit preference, legacy if never set.
+func storedUnits(person *models.Person) string {
+	if models.IsValidUnits(person.Units) {
+		return person.Units
+	}
+	return models.UnitsLegacy
+}
+
+// responseUnits picks the unit system for a person response: the ?units=
+// query parameter when valid, else the person's preference.
+func responseUnits(r *http.Request, person *models.Person) string {
+	if units := strings.ToLower(r.URL.Query().Get("units")); models.IsValidUnits(units) {
+		return units
+	}
+	return storedUnits(person)
 }
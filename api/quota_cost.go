@@ -0,0 +1,44 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+// maxTryOnBody bounds the JSON body of an individual, couple or group
+// try-on.
+const maxTryOnBody = 1 << 20
+
+// QuotaCostFunc tells QuotaMiddleware what a request costs before the
+// handler runs. Each quota-limited route declares its own.
+type QuotaCostFunc func(r *http.Request) models.TryOnCost
+
+// SingleTryOnCost is the cost of endpoints that always render one person
+// with no theme (/try-on, /try-on/guest).
+func SingleTryOnCost(r *http.Request) models.TryOnCost {
+	return models.TryOnCost{People: 1}
+}
+
+// AdvancedTryOnCost prices an individual, couple or group request from its
+// body: one unit per person, plus the theme. The body is put back for the
+// handler. A body that doesn't parse, or is over maxTryOnBody, is priced as
+// a single try-on; the handler rejects it and the reservation is released.
+func AdvancedTryOnCost(r *http.Request) models.TryOnCost {
+	cost := models.TryOnCost{People: 1}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxTryOnBody))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return cost
+	}
+	var req AdvancedTryOnRequest
+	if json.Unmarshal(body, &req) != nil {
+		return cost
+	}
+	cost.People = len(req.People)
+	cost.Theme = req.UseTheme && req.ThemeID != "" && req.ThemeID != "null"
+	return cost
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/raushankrgupta/web-product-scraper/config"
 	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/raushankrgupta/web-product-scraper/myntra_scraper"
+	"github.com/raushankrgupta/web-product-scraper/scrapers/abfrl"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 )
 
@@ -29,7 +30,7 @@ func looksLikeKnownNonMyntraStore(rawURL string) bool {
 	return strings.Contains(u, "amazon") || strings.Contains(u, "amzn") ||
 		strings.Contains(u, "flipkart.com") ||
 		strings.Contains(u, "tatacliq.com") ||
-		strings.Contains(u, "peterengland")
+		abfrl.IsBrandURL(u)
 }
 
 // delegateToServerB reports whether productURL should be scraped on server B.
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failedScrapesPrefix is the S3 folder that holds HTML snapshots and
+// screenshots from failed scrapes, one sub-folder per failed Product.
+const failedScrapesPrefix = "failed_scrapes"
+
+// maxArtifactHTMLBytes caps each stored HTML snapshot. Real PDPs are well
+// under this; anything larger is truncated rather than dropped so the head of
+// the document (where block pages put their markers) is still kept.
+const maxArtifactHTMLBytes = 5 << 20
+
+// uploadScrapeArtifacts uploads the HTML body and screenshot captured by each
+// failed fetch strategy to failed_scrapes/<productID>/ and fills in the
+// object keys. Upload errors are logged and skipped so the failed Product
+// document is still saved with whatever did make it to S3.
+func uploadScrapeArtifacts(ctx context.Context, logger *strings.Builder, productID primitive.ObjectID, attempts []models.ScrapeAttempt) []models.ScrapeAttempt {
+	for i := range attempts {
+		a := &attempts[i]
+		base := fmt.Sprintf("%s/%s/%d_%s", failedScrapesPrefix, productID.Hex(), i+1, a.Strategy)
+
+		if len(a.HTML) > 0 {
+			html := a.HTML
+			if len(html) > maxArtifactHTMLBytes {
+				html = html[:maxArtifactHTMLBytes]
+			}
+			key := base + ".html"
+			if _, err := utils.UploadFileToS3(ctx, bytes.NewReader(html), key, "text/html; charset=utf-8", utils.CacheControlMutable); err != nil {
+				utils.AddToLogMessage(logger, fmt.Sprintf("Failed to upload %s HTML artifact: %v", a.Strategy, err))
+			} else {
+				a.HTMLKey = key
+			}
+		}
+
+		if len(a.Screenshot) > 0 {
+			key := base + ".png"
+			if _, err := utils.UploadFileToS3(ctx, bytes.NewReader(a.Screenshot), key, "image/png", utils.CacheControlMutable); err != nil {
+				utils.AddToLogMessage(logger, fmt.Sprintf("Failed to upload %s screenshot artifact: %v", a.Strategy, err))
+			} else {
+				a.ScreenshotKey = key
+			}
+		}
+	}
+	return attempts
+}
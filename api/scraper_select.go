@@ -1,6 +1,9 @@
 package api
 
 import (
+	"fmt"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/raushankrgupta/web-product-scraper/myntra_scraper"
 	"github.com/raushankrgupta/web-product-scraper/scrapers"
 	"github.com/raushankrgupta/web-product-scraper/utils"
@@ -19,13 +22,34 @@ import (
 //
 // The URL is resolved once here. The factory's own ResolveShortenedURL
 // call then becomes a no-op redirect chain for the non-Myntra path.
-func selectScraper(productURL string) (scrapers.Scraper, string, error) {
-	resolvedURL, err := utils.ResolveShortenedURL(productURL)
+//
+// When trace is non-nil the redirect chain and the chosen scraper are
+// recorded on it, and the scraper is told to record its fetch attempts too.
+func selectScraper(productURL string, trace *models.ScrapeTrace) (scrapers.Scraper, string, error) {
+	chain, err := utils.ResolveURLChain(productURL)
+	if trace != nil {
+		trace.URLChain = chain
+	}
 	if err != nil {
 		return nil, productURL, err
 	}
+	resolvedURL := chain[len(chain)-1]
+
+	var scraper scrapers.Scraper
 	if myntra_scraper.IsMyntraURL(resolvedURL) {
-		return myntra_scraper.NewMyntraScraper(), resolvedURL, nil
+		scraper = myntra_scraper.NewMyntraScraper()
+	} else {
+		scraper, resolvedURL, err = scrapers.GetScraper(resolvedURL)
+		if err != nil {
+			return nil, resolvedURL, err
+		}
+	}
+
+	if trace != nil {
+		trace.Scraper = fmt.Sprintf("%T", scraper)
+		if t, ok := scraper.(scrapers.Traceable); ok {
+			t.SetTrace(trace)
+		}
 	}
-	return scrapers.GetScraper(resolvedURL)
+	return scraper, resolvedURL, nil
 }
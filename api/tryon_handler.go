@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -20,6 +19,11 @@ import (
 type TryOnRequest struct {
 	ProductID string `json:"product_id"`
 	PersonID  string `json:"person_id"`
+
+	// Person photo selection (see models.Person.TryOnPhotos)
+	ImageKey       string `json:"image_key,omitempty"` // S3 key or presigned URL of one of the person's images
+	ImageIndex     *int   `json:"image_index,omitempty"`
+	MultiReference bool   `json:"multi_reference,omitempty"` // Also send a second photo of the person
 }
 
 // AdvancedTryOnRequest handles the unified payload mapping for all try-on variants
@@ -109,86 +113,58 @@ func VirtualTryOnHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	utils.AddToLogMessage(&logMessageBuilder, "Product fetched from database")
 
-	// Pre-process Product Images: Ensure they are accessible URLs
-	// We use our helper which handles checking if it's already a URL or needs presigning
-	product.Images = utils.PresignImageURLs(r.Context(), product.Images)
-
-	// 3. Call Gemini API
-	// Construct person details string
-	personDetails := fmt.Sprintf("Gender: %s, Height: %.2f cm, Weight: %.2f kg, Chest: %.2f, Waist: %.2f, Hips: %.2f",
-		person.Gender, person.Height, person.Weight, person.Chest, person.Waist, person.Hips)
-
-	// Use the first image of the person
-	personImageKey := person.ImagePaths[0]
-	personImageURL, err := utils.GetPresignedURL(r.Context(), personImageKey)
-	if err != nil {
-		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to get presigned URL for person image: %v", err), http.StatusInternalServerError)
+	// Only send the owner's curated images (preferred first, exclusions
+	// dropped) so logos and model-heavy shots don't confuse the model.
+	productImages := product.TryOnImages()
+	if len(productImages) == 0 {
+		utils.RespondError(w, &logMessageBuilder, "Product has no images", http.StatusBadRequest)
 		return
 	}
 
-	// Use a background context with timeout for the heavy Gemini call
-	geminiCtx, cancelGemini := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancelGemini()
+	// 3. Person details and photos
+	personDetails := person.MeasurementDetails()
 
-	generatedContent, err := utils.GenerateTryOnImage(geminiCtx, personImageURL, product.Images, product.Dimensions, personDetails)
+	// Requested photo (else the primary one), plus an identity reference
+	personPhotos, err := person.TryOnPhotos(extractS3Key(req.ImageKey), req.ImageIndex, req.MultiReference)
 	if err != nil {
-		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to generate try-on image: %v", err))
-		if strings.Contains(err.Error(), "429") || strings.Contains(strings.ToLower(err.Error()), "quota") {
-			utils.RespondError(w, nil, "Quota exceeded. Please try again later.", http.StatusTooManyRequests)
-		} else {
-			utils.RespondError(w, nil, "Failed to generate try-on image: "+err.Error(), http.StatusInternalServerError)
-		}
+		utils.RespondError(w, &logMessageBuilder, err.Error(), http.StatusBadRequest)
 		return
 	}
+	personImageKey := personPhotos[0]
 
-	// 4. Save Try-On Record
-	// Upload generated image to S3
-	fileName := fmt.Sprintf("generated_tryon_%d.jpg", time.Now().UnixNano())
-	objectKey := fmt.Sprintf("generated_images/%s", fileName)
-
-	// generatedContent is []byte
-	_, err = utils.UploadFileToS3(r.Context(), bytes.NewReader(generatedContent), objectKey, "image/jpeg")
-	if err != nil {
-		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to upload generated image: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Capture UserID
-	userID, err := GetUserIDFromContext(r.Context())
-	if err != nil {
-		utils.AddToLogMessage(&logMessageBuilder, "Warning: UserID not found in context")
-	}
-
-	tryOnRecord := models.TryOn{
-		ID:                primitive.NewObjectID(),
-		UserID:            userID,
-		PersonID:          req.PersonID,
-		ProductURL:        product.URL,
-		ProductID:         req.ProductID,
-		PersonImageURL:    personImageKey, // Store Key
-		GeneratedImageURL: objectKey,      // Store Key
-		Status:            "completed",
-		CreatedAt:         time.Now(),
+	// Normalized attributes give the model consistent garment details
+	// regardless of which store the product came from.
+	productDetails := product.Dimensions
+	if summary := product.Attributes.Summary(); summary != "" {
+		productDetails = strings.TrimSpace(productDetails + "\nGarment: " + summary)
 	}
 
-	tryOnCollection := utils.GetCollection(config.DBName, "tryons")
-	_, err = tryOnCollection.InsertOne(context.Background(), tryOnRecord)
-	if err != nil {
-		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to save try-on record: %v", err))
-		// We proceed to return the response even if DB save fails
-	}
-
-	// Generate Presigned URL for response
-	presignedGeneratedURL, _ := utils.GetPresignedURL(r.Context(), objectKey)
-	tryOnRecord.GeneratedImageURL = presignedGeneratedURL
-
-	// 5. Return Response
-	response := map[string]interface{}{
-		"result":        tryOnRecord.GeneratedImageURL,
-		"tryon_details": tryOnRecord,
-	}
-
-	utils.RespondJSON(w, http.StatusOK, response)
+	// 4. Queue the generation; the job saves the try-on record
+	submitTryOnJob(w, r, &logMessageBuilder, &tryOnJob{
+		record: models.TryOn{
+			ID:             primitive.NewObjectID(),
+			UserID:         userIdStr,
+			PersonID:       req.PersonID,
+			ProductURL:     product.URL,
+			ProductID:      req.ProductID,
+			PersonImageURL: personImageKey, // Store Key
+		},
+		keyPrefix: "generated_tryon",
+		generate: func(ctx context.Context) ([]byte, error) {
+			// Presign when the job runs, so a long queue wait can't
+			// outlive the URLs
+			personImageURLs := make([]string, 0, len(personPhotos))
+			for _, key := range personPhotos {
+				url, err := utils.GetPresignedURL(ctx, key)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get presigned URL for person image: %v", err)
+				}
+				personImageURLs = append(personImageURLs, url)
+			}
+			productImageURLs := utils.PresignImageURLs(ctx, productImages)
+			return utils.Generator.GenerateProductTryOn(ctx, personImageURLs, productImageURLs, productDetails, personDetails)
+		},
+	})
 }
 
 // IndividualTryOnHandler handles individual try-on using the unified optimized payload
@@ -241,7 +217,7 @@ func processMultiPersonTryOn(w http.ResponseWriter, r *http.Request, requiredPeo
 
 	// 1. Process Theme
 
-	var themeReferenceURL string
+	var themeImageKey string
 	var themeDescription string
 
 	if req.UseTheme && req.ThemeID != "" && req.ThemeID != "null" {
@@ -259,12 +235,11 @@ func processMultiPersonTryOn(w http.ResponseWriter, r *http.Request, requiredPeo
 
 		themeDescription = theme.Description
 
-		if theme.ThemeBlankImageURL != "" {
-			themeReferenceURL, _ = utils.GetPresignedURL(r.Context(), theme.ThemeBlankImageURL)
-		}
+		themeImageKey = theme.ThemeBlankImageURL
 	}
 
-	// 2. Process People
+	// 2. Process People. Images are kept as S3 keys and presigned when
+	// the job runs.
 	var peopleData []utils.PersonTryOnData
 	personCollection := utils.GetCollection(config.DBName, "person")
 	wardrobeCollection := utils.GetCollection(config.DBName, "wardrobe")
@@ -285,31 +260,19 @@ func processMultiPersonTryOn(w http.ResponseWriter, r *http.Request, requiredPeo
 			return
 		}
 
-		personImgURL := ""
+		personImgKey := ""
+		var referenceKeys []string
 		if len(person.ImagePaths) > 0 {
-			personImgURL, _ = utils.GetPresignedURL(r.Context(), person.ImagePaths[0])
+			personPhotos, err := person.TryOnPhotos(extractS3Key(p.ImageKey), p.ImageIndex, p.MultiReference)
+			if err != nil {
+				utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Person %s: %v", p.PersonID, err), http.StatusBadRequest)
+				return
+			}
+			personImgKey = personPhotos[0]
+			referenceKeys = personPhotos[1:]
 		}
 
-		var detailsParts []string
-		if person.Gender != "" {
-			detailsParts = append(detailsParts, fmt.Sprintf("Gender: %s", person.Gender))
-		}
-		if person.Height > 0 {
-			detailsParts = append(detailsParts, fmt.Sprintf("Height: %.2f cm", person.Height))
-		}
-		if person.Weight > 0 {
-			detailsParts = append(detailsParts, fmt.Sprintf("Weight: %.2f kg", person.Weight))
-		}
-		if person.Chest > 0 {
-			detailsParts = append(detailsParts, fmt.Sprintf("Chest: %.2f cm", person.Chest))
-		}
-		if person.Waist > 0 {
-			detailsParts = append(detailsParts, fmt.Sprintf("Waist: %.2f cm", person.Waist))
-		}
-		if person.Hips > 0 {
-			detailsParts = append(detailsParts, fmt.Sprintf("Hips: %.2f cm", person.Hips))
-		}
-		details := strings.Join(detailsParts, ", ")
+		details := person.MeasurementDetails()
 
 		getWardrobeImages := func(itemID string) []string {
 			if itemID != "" && itemID != "null" {
@@ -317,7 +280,6 @@ func processMultiPersonTryOn(w http.ResponseWriter, r *http.Request, requiredPeo
 				if err == nil {
 					var item models.WardrobeItem
 					if err := wardrobeCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&item); err == nil && len(item.Images) > 0 {
-						item.Images = utils.PresignImageURLs(r.Context(), item.Images)
 						return item.Images
 					}
 				}
@@ -334,71 +296,37 @@ func processMultiPersonTryOn(w http.ResponseWriter, r *http.Request, requiredPeo
 			p.PersonID, p.TopID, len(topURLs) != 0, p.BottomID, len(bottomURLs) != 0, p.AccessoryID, len(accessoryURLs) != 0, p.DressID, len(dressURLs) != 0))
 
 		peopleData = append(peopleData, utils.PersonTryOnData{
-			Details:        details,
-			PersonImageURL: personImgURL,
-			TopURL:         topURLs,
-			BottomURL:      bottomURLs,
-			AccessoryURL:   accessoryURLs,
-			DressURL:       dressURLs,
+			Details:            details,
+			PersonImageURL:     personImgKey,
+			ReferenceImageURLs: referenceKeys,
+			TopURL:             topURLs,
+			BottomURL:          bottomURLs,
+			AccessoryURL:       accessoryURLs,
+			DressURL:           dressURLs,
 		})
 	}
 
-	// 3. Call Gemini API
-	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Calling Gemini for %s try-on with %d people", tryOnType, len(peopleData)))
-
-	geminiCtx, cancelGemini := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancelGemini()
-
-	var generatedContent []byte
-	var genErr error
-
-	if tryOnType == "couple" && len(peopleData) == 2 {
-		generatedContent, genErr = utils.GenerateCoupleTryOnImage(geminiCtx, themeReferenceURL, themeDescription, peopleData)
-	} else if tryOnType == "individual" && len(peopleData) == 1 {
-		generatedContent, genErr = utils.GenerateIndividualTryOnImage(geminiCtx, themeReferenceURL, themeDescription, peopleData[0])
-	} else {
-		generatedContent, genErr = utils.GenerateMultiPersonTryOnImage(geminiCtx, tryOnType, themeReferenceURL, themeReferenceURL, themeDescription, peopleData)
-	}
-	if genErr != nil {
-		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to generate multi-person try-on image: %v", genErr))
-		utils.RespondError(w, nil, "Failed to generate try-on image: "+genErr.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// 4. Save Try-On Record
-	fileName := fmt.Sprintf("generated_tryon_%s_%d.jpg", tryOnType, time.Now().UnixNano())
-	objectKey := fmt.Sprintf("generated_images/%s", fileName)
-
-	_, err = utils.UploadFileToS3(r.Context(), bytes.NewReader(generatedContent), objectKey, "image/jpeg")
-	if err != nil {
-		utils.RespondError(w, &logMessageBuilder, fmt.Sprintf("Failed to upload generated image: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	tryOnRecord := models.TryOn{
-		ID:                primitive.NewObjectID(),
-		UserID:            userIDStr,
-		Type:              tryOnType,
-		ThemeID:           req.ThemeID,
-		People:            req.People,
-		GeneratedImageURL: objectKey, // Store S3 Key
-		Status:            "completed",
-		CreatedAt:         time.Now(),
-	}
-
-	tryOnCollection := utils.GetCollection(config.DBName, "tryons")
-	_, err = tryOnCollection.InsertOne(context.Background(), tryOnRecord)
-	if err != nil {
-		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Failed to save %s try-on record: %v", tryOnType, err))
-	}
-
-	presignedGeneratedURL, _ := utils.GetPresignedURL(r.Context(), objectKey)
-	tryOnRecord.GeneratedImageURL = presignedGeneratedURL
-
-	response := map[string]interface{}{
-		"result":        tryOnRecord.GeneratedImageURL,
-		"tryon_details": tryOnRecord,
-	}
-
-	utils.RespondJSON(w, http.StatusOK, response)
+	// 3. Queue the generation; the job saves the try-on record
+	utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Queueing %s try-on with %d people", tryOnType, len(peopleData)))
+
+	submitTryOnJob(w, r, &logMessageBuilder, &tryOnJob{
+		record: models.TryOn{
+			ID:      primitive.NewObjectID(),
+			UserID:  userIDStr,
+			Type:    tryOnType,
+			ThemeID: req.ThemeID,
+			People:  req.People,
+		},
+		keyPrefix: "generated_tryon_" + tryOnType,
+		generate: func(ctx context.Context) ([]byte, error) {
+			themeReferenceURL, people, err := presignTryOnImages(ctx, themeImageKey, peopleData)
+			if err != nil {
+				return nil, err
+			}
+			if tryOnType == "individual" && len(people) == 1 {
+				return utils.Generator.GenerateIndividual(ctx, themeReferenceURL, themeDescription, people[0])
+			}
+			return utils.Generator.GenerateGroup(ctx, tryOnType, themeReferenceURL, themeDescription, people)
+		},
+	})
 }
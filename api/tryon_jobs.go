@@ -0,0 +1,498 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// tryOnJobTimeout bounds one job's generation, retries included.
+	tryOnJobTimeout = 5 * time.Minute
+	// jobHeartbeat is how often the SSE stream re-reads the record (for
+	// jobs run by another instance) and keeps the connection alive.
+	jobHeartbeat = 5 * time.Second
+)
+
+// tryOnJob is a queued generation. record is inserted pending and updated
+// as the job runs; generate produces the image once the job's ticket gets
+// a generation slot.
+type tryOnJob struct {
+	record    models.TryOn
+	keyPrefix string // generated image file name prefix
+	generate  func(ctx context.Context) ([]byte, error)
+	quota     *utils.QuotaReservation // committed on completion, released on failure; nil if not quota-limited
+	watermark bool                    // the caller's plan watermarks generated images
+	ticket    *utils.Ticket
+}
+
+// TryOnJobResponse is the job view returned by the try-on endpoints and
+// GET /try-on/jobs/{id}. Status is queued, running, failed or completed.
+type TryOnJobResponse struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	// QueuePosition is the 1-based place among waiting generations while
+	// queued (on the instance running the job)
+	QueuePosition int          `json:"queue_position,omitempty"`
+	Result        string       `json:"result,omitempty"` // presigned URL of the generated image
+	Error         string       `json:"error,omitempty"`
+	Attempts      int          `json:"attempts"`
+	TryOn         models.TryOn `json:"tryon_details"`
+}
+
+// bootID identifies this process. Jobs are stamped with it and
+// config.InstanceID, so a restart can tell its own leftovers from jobs
+// other instances are still running.
+var bootID = primitive.NewObjectID().Hex()
+
+// queuedTickets maps the ids of jobs waiting for a generation slot to
+// their tickets, for queue positions.
+var queuedTickets sync.Map
+
+// InitTryOnJobs fails the try-on records a previous run of this instance
+// left unfinished, and any unfinished record from before jobs were
+// stamped with their process, refunding the credits they took. Their
+// daily units come back on their own once the reservation expires.
+func InitTryOnJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	coll := utils.GetCollection(config.DBName, "tryons")
+	unfinished := bson.M{
+		"status": bson.M{"$in": []string{models.TryOnStatusPending, models.TryOnStatusRunning}},
+		"$or": []bson.M{
+			{"instance": config.InstanceID, "boot_id": bson.M{"$ne": bootID}},
+			{"boot_id": bson.M{"$exists": false}},
+		},
+	}
+	failed := bson.M{"$set": bson.M{"status": models.TryOnStatusFailed, "error": "interrupted by a server restart"}}
+
+	// Fail the ones with credits one by one, so each is refunded once
+	// even if two instances share an id
+	withCredits := bson.M{"credits": bson.M{"$exists": true}}
+	for k, v := range unfinished {
+		withCredits[k] = v
+	}
+	var jobs []models.TryOn
+	cursor, err := coll.Find(ctx, withCredits)
+	if err == nil {
+		err = cursor.All(ctx, &jobs)
+	}
+	if err != nil {
+		fmt.Printf("[TryOnJobs] failed to load unfinished jobs with credits: %v\n", err)
+	}
+	var refunded int64
+	for _, job := range jobs {
+		res, err := coll.UpdateOne(ctx, bson.M{"_id": job.ID, "status": job.Status}, failed)
+		if err != nil || res.ModifiedCount == 0 {
+			continue
+		}
+		refunded++
+		if err := utils.RefundTryOnCredits(ctx, job.UserID, job.Credits); err != nil {
+			fmt.Printf("[TryOnJobs] failed to refund %d credits of job %s: %v\n", job.Credits.Units, job.ID.Hex(), err)
+		}
+	}
+
+	res, err := coll.UpdateMany(ctx, unfinished, failed)
+	if err != nil {
+		fmt.Printf("[TryOnJobs] failed to clean up unfinished jobs: %v\n", err)
+	} else if n := refunded + res.ModifiedCount; n > 0 {
+		fmt.Printf("[TryOnJobs] marked %d unfinished jobs failed\n", n)
+	}
+}
+
+// wantsAsync reports whether the client asked for a job id instead of
+// waiting for the result (Prefer: respond-async, or ?async=true).
+func wantsAsync(r *http.Request) bool {
+	for _, v := range r.Header.Values("Prefer") {
+		if strings.Contains(strings.ToLower(v), "respond-async") {
+			return true
+		}
+	}
+	return formBool(r, "async")
+}
+
+// submitTryOnJob saves the job's pending record and queues it. Async
+// clients get 202 with the job; others wait for it and get the result as
+// before. A client that disconnects while waiting can still fetch the job.
+func submitTryOnJob(w http.ResponseWriter, r *http.Request, logMessageBuilder *strings.Builder, job *tryOnJob) {
+	plan := GetUserPlanFromContext(r.Context())
+	ticket, err := utils.Scheduler.Enqueue(plan)
+	if err != nil {
+		utils.RespondError(w, logMessageBuilder, "Too many try-ons in progress. Please try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+	job.ticket = ticket
+	job.watermark = models.EntitlementsForPlan(plan).Watermark
+	job.record.Status = models.TryOnStatusPending
+	job.record.CreatedAt = time.Now()
+	job.record.Instance = config.InstanceID
+	job.record.BootID = bootID
+	job.record.Credits = quotaCredits(r.Context())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := utils.GetCollection(config.DBName, "tryons").InsertOne(ctx, job.record); err != nil {
+		ticket.Done()
+		utils.RespondError(w, logMessageBuilder, fmt.Sprintf("Failed to save try-on job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	noteIdempotentJob(r.Context(), job.record.ID.Hex())
+
+	// Subscribe before queueing so a fast job can't finish unseen
+	events, unsubscribe := tryOnEvents.subscribe(job.record.ID.Hex())
+	defer unsubscribe()
+
+	// Charged by the job once it completes
+	job.quota = deferQuotaCharge(r.Context())
+	queuedTickets.Store(job.record.ID.Hex(), ticket)
+	go runTryOnJob(job)
+	utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Queued try-on job %s at position %d", job.record.ID.Hex(), ticket.Position()))
+
+	if wantsAsync(r) {
+		w.Header().Set("Location", "/try-on/jobs/"+job.record.ID.Hex())
+		utils.RespondJSON(w, http.StatusAccepted, tryOnJobResponse(r.Context(), job.record))
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// The client won't see this, but IdempotencyMiddleware stores
+			// it, so a retry with the same key gets the job to poll.
+			utils.AddToLogMessage(logMessageBuilder, "Client went away; job continues")
+			w.Header().Set("Location", "/try-on/jobs/"+job.record.ID.Hex())
+			utils.RespondJSON(w, http.StatusAccepted, tryOnJobResponse(context.Background(), job.record))
+			return
+		case rec := <-events:
+			if !rec.IsFinished() {
+				continue
+			}
+			if rec.Status == models.TryOnStatusFailed {
+				utils.AddToLogMessage(logMessageBuilder, fmt.Sprintf("Try-on job failed: %s", rec.Error))
+				respondGenerationError(w, rec.Error)
+				return
+			}
+			resp := tryOnJobResponse(r.Context(), rec)
+			utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+				"result":        resp.Result,
+				"tryon_details": resp.TryOn,
+			})
+			return
+		}
+	}
+}
+
+// respondGenerationError maps a generation failure to the responses the
+// synchronous try-on endpoints have always returned.
+func respondGenerationError(w http.ResponseWriter, errMsg string) {
+	if errMsg == utils.ErrQueueTimeout.Error() {
+		utils.RespondError(w, nil, "Too many try-ons in progress. Please try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+	if strings.Contains(errMsg, "429") || strings.Contains(strings.ToLower(errMsg), "quota") {
+		utils.RespondError(w, nil, "Quota exceeded. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+	utils.RespondError(w, nil, "Failed to generate try-on image: "+errMsg, http.StatusInternalServerError)
+}
+
+// runTryOnJob waits for a generation slot, then generates, uploads and
+// records one job.
+func runTryOnJob(job *tryOnJob) {
+	rec := &job.record
+	defer job.ticket.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			rec.Status = models.TryOnStatusFailed
+			rec.Error = fmt.Sprintf("internal error: %v", p)
+			saveTryOnStatus(rec)
+		}
+		if job.quota != nil {
+			settleQuota(job.quota, rec.Status == models.TryOnStatusCompleted)
+		}
+	}()
+
+	err := job.ticket.Wait(context.Background())
+	queuedTickets.Delete(rec.ID.Hex())
+	if err != nil {
+		fmt.Printf("[TryOnJobs] job %s dropped: %v\n", rec.ID.Hex(), err)
+		rec.Status = models.TryOnStatusFailed
+		rec.Error = err.Error()
+		saveTryOnStatus(rec)
+		return
+	}
+
+	started := time.Now()
+	rec.Status = models.TryOnStatusRunning
+	rec.StartedAt = &started
+	saveTryOnStatus(rec)
+
+	ctx, cancel := context.WithTimeout(context.Background(), tryOnJobTimeout)
+	defer cancel()
+	ctx, attempts := utils.WithAttemptRecorder(ctx)
+
+	generated, err := job.generate(ctx)
+	// Free the slot before watermarking and uploading
+	job.ticket.Done()
+	rec.Attempts = attempts.Attempts()
+	if err == nil && job.watermark {
+		generated, err = utils.WatermarkImage(generated)
+	}
+	if err == nil {
+		uploadCtx, uploadCancel := context.WithTimeout(context.Background(), time.Minute)
+		defer uploadCancel()
+		objectKey := fmt.Sprintf("generated_images/%s_%d.jpg", job.keyPrefix, time.Now().UnixNano())
+		if _, err = utils.UploadFileToS3(uploadCtx, bytes.NewReader(generated), objectKey, "image/jpeg"); err == nil {
+			rec.GeneratedImageURL = objectKey
+		} else {
+			err = fmt.Errorf("failed to upload generated image: %v", err)
+		}
+	}
+
+	finished := time.Now()
+	rec.CompletedAt = &finished
+	if err != nil {
+		fmt.Printf("[TryOnJobs] job %s failed after %d attempt(s): %v\n", rec.ID.Hex(), len(rec.Attempts), err)
+		rec.Status = models.TryOnStatusFailed
+		rec.Error = err.Error()
+		saveTryOnStatus(rec)
+		return
+	}
+
+	rec.Status = models.TryOnStatusCompleted
+	saveTryOnStatus(rec)
+}
+
+// presignTryOnImages presigns a multi-person job's theme image and people's
+// image keys. Jobs hold keys and call this when they start, so the URLs
+// are fresh however long the job waited in the queue.
+func presignTryOnImages(ctx context.Context, themeKey string, people []utils.PersonTryOnData) (string, []utils.PersonTryOnData, error) {
+	themeURL := ""
+	if themeKey != "" {
+		url, err := utils.GetPresignedURL(ctx, themeKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get presigned URL for theme image: %v", err)
+		}
+		themeURL = url
+	}
+	out := make([]utils.PersonTryOnData, len(people))
+	for i, p := range people {
+		if p.PersonImageURL != "" {
+			url, err := utils.GetPresignedURL(ctx, p.PersonImageURL)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to get presigned URL for person %d image: %v", i+1, err)
+			}
+			p.PersonImageURL = url
+		}
+		p.ReferenceImageURLs = utils.PresignImageURLs(ctx, p.ReferenceImageURLs)
+		p.TopURL = utils.PresignImageURLs(ctx, p.TopURL)
+		p.BottomURL = utils.PresignImageURLs(ctx, p.BottomURL)
+		p.AccessoryURL = utils.PresignImageURLs(ctx, p.AccessoryURL)
+		p.DressURL = utils.PresignImageURLs(ctx, p.DressURL)
+		out[i] = p
+	}
+	return themeURL, out, nil
+}
+
+// saveTryOnStatus writes the job fields of rec and notifies subscribers.
+func saveTryOnStatus(rec *models.TryOn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := utils.GetCollection(config.DBName, "tryons").UpdateOne(ctx, bson.M{"_id": rec.ID}, bson.M{"$set": bson.M{
+		"status":              rec.Status,
+		"error":               rec.Error,
+		"started_at":          rec.StartedAt,
+		"completed_at":        rec.CompletedAt,
+		"attempts":            rec.Attempts,
+		"generated_image_url": rec.GeneratedImageURL,
+	}})
+	if err != nil {
+		fmt.Printf("[TryOnJobs] failed to save job %s: %v\n", rec.ID.Hex(), err)
+	}
+	tryOnEvents.publish(*rec)
+}
+
+// tryOnJobResponse builds the job view, presigning the generated image.
+func tryOnJobResponse(ctx context.Context, rec models.TryOn) TryOnJobResponse {
+	status := rec.Status
+	if status == models.TryOnStatusPending {
+		status = "queued"
+	}
+	if rec.GeneratedImageURL != "" {
+		rec.GeneratedImageURL, _ = utils.GetPresignedURL(ctx, rec.GeneratedImageURL)
+	}
+	position := 0
+	if t, ok := queuedTickets.Load(rec.ID.Hex()); ok {
+		position = t.(*utils.Ticket).Position()
+	}
+	return TryOnJobResponse{
+		JobID:         rec.ID.Hex(),
+		Status:        status,
+		QueuePosition: position,
+		Result:        rec.GeneratedImageURL,
+		Error:         rec.Error,
+		Attempts:      len(rec.Attempts),
+		TryOn:         rec,
+	}
+}
+
+// TryOnJobHandler serves GET /try-on/jobs/{id} and the SSE stream at
+// GET /try-on/jobs/{id}/events.
+func TryOnJobHandler(w http.ResponseWriter, r *http.Request) {
+	var logMessageBuilder strings.Builder
+	defer func() {
+		fmt.Println(logMessageBuilder.String())
+	}()
+	utils.AddToLogMessage(&logMessageBuilder, "[Try-On Job API]")
+
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, &logMessageBuilder, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Unauthorized: No user ID", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/try-on/jobs/"), "/"), "/")
+	jobID, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "events") {
+		utils.RespondError(w, &logMessageBuilder, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := findTryOnJob(r.Context(), jobID, userID)
+	if err != nil {
+		utils.RespondError(w, &logMessageBuilder, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		streamTryOnJob(w, r, rec)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, tryOnJobResponse(r.Context(), *rec))
+}
+
+func findTryOnJob(ctx context.Context, id primitive.ObjectID, userID string) (*models.TryOn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var rec models.TryOn
+	err := utils.GetCollection(config.DBName, "tryons").FindOne(ctx, bson.M{
+		"_id":        id,
+		"user_id":    userID,
+		"is_deleted": bson.M{"$ne": true},
+	}).Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// streamTryOnJob sends the job as a "status" server-sent event whenever it
+// changes, ending after it finishes.
+func streamTryOnJob(w http.ResponseWriter, r *http.Request, rec *models.TryOn) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.RespondError(w, nil, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := tryOnEvents.subscribe(rec.ID.Hex())
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	last := ""
+	send := func(rec models.TryOn) {
+		resp := tryOnJobResponse(r.Context(), rec)
+		key := fmt.Sprintf("%s/%d/%d", resp.Status, resp.QueuePosition, resp.Attempts)
+		if key == last {
+			return
+		}
+		last = key
+		data, _ := json.Marshal(resp)
+		fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	send(*rec)
+
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+	for !rec.IsFinished() {
+		select {
+		case <-r.Context().Done():
+			return
+		case update := <-events:
+			rec = &update
+			send(update)
+		case <-ticker.C:
+			if latest, err := findTryOnJob(r.Context(), rec.ID, rec.UserID); err == nil {
+				rec = latest
+				send(*latest)
+			}
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// jobHub fans try-on record updates out to waiting requests and SSE
+// streams on this instance.
+type jobHub struct {
+	mu   sync.Mutex
+	subs map[string][]chan models.TryOn
+}
+
+var tryOnEvents = &jobHub{subs: map[string][]chan models.TryOn{}}
+
+func (h *jobHub) subscribe(id string) (<-chan models.TryOn, func()) {
+	ch := make(chan models.TryOn, 8)
+	h.mu.Lock()
+	h.subs[id] = append(h.subs[id], ch)
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		subs := h.subs[id]
+		for i, c := range subs {
+			if c == ch {
+				h.subs[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(h.subs[id]) == 0 {
+			delete(h.subs, id)
+		}
+	}
+}
+
+// publish never blocks; a subscriber that falls behind misses updates
+// but the SSE stream catches up from the database.
+func (h *jobHub) publish(rec models.TryOn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subs[rec.ID.Hex()] {
+		select {
+		case ch <- rec:
+		default:
+		}
+	}
+}
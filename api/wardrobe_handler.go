@@ -11,6 +11,7 @@ import (
 
 	"github.com/raushankrgupta/web-product-scraper/config"
 	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -27,9 +28,10 @@ type WardrobeResponse struct {
 
 // SaveProductRequest represents the payload for saving a product
 type SaveProductRequest struct {
-	Category  string   `json:"category"`
+	Category  string   `json:"category"` // Optional; derived from the scraped product when empty
 	Images    []string `json:"images"`
 	SourceURL string   `json:"source_url,omitempty"`
+	ProductID string   `json:"product_id,omitempty"`
 }
 
 type UpdateProductRequest struct {
@@ -207,6 +209,12 @@ func saveProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	slot, ok := reservePlanSlot(w, r, &logMessageBuilder, "wardrobe")
+	if !ok {
+		return
+	}
+	defer slot.release()
+
 	var req SaveProductRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondError(w, &logMessageBuilder, "Invalid request body", http.StatusBadRequest)
@@ -228,12 +236,20 @@ func saveProduct(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	category := strings.TrimSpace(req.Category)
+	productCategory, garmentSlot := classifyWardrobeItem(ctx, userID, req)
+	if category == "" {
+		category = productCategory
+		utils.AddToLogMessage(&logMessageBuilder, fmt.Sprintf("Auto-assigned category: %q", category))
+	}
+
 	wardrobeCollection := utils.GetCollection(config.DBName, "wardrobe")
 
 	wardrobeItem := models.WardrobeItem{
 		ID:         primitive.NewObjectID(),
 		UserID:     userID,
-		Category:   req.Category,
+		Category:   category,
+		Slot:       garmentSlot,
 		Images:     cleanImages,
 		SourceURL:  req.SourceURL,
 		IsFavorite: false,
@@ -245,6 +261,7 @@ func saveProduct(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, &logMessageBuilder, "Failed to save product", http.StatusInternalServerError)
 		return
 	}
+	slot.keep()
 
 	utils.AddToLogMessage(&logMessageBuilder, "Product saved to wardrobe")
 	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
@@ -253,6 +270,47 @@ func saveProduct(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// classifyWardrobeItem finds the scraped product behind a wardrobe item
+// (by product_id, else the caller's latest product for source_url) and
+// returns its store category, for an item saved without one, and its
+// garment slot. Without a product the slot comes from the source URL
+// alone and the category falls back to the slot name.
+func classifyWardrobeItem(ctx context.Context, userID string, req SaveProductRequest) (category, slot string) {
+	productCollection := utils.GetCollection(config.DBName, "products")
+
+	var filter bson.M
+	if productID, err := primitive.ObjectIDFromHex(req.ProductID); err == nil {
+		filter = bson.M{"_id": productID, "user_id": userID}
+	} else if req.SourceURL != "" {
+		filter = bson.M{
+			"user_id": userID,
+			"status":  "success",
+			"$or":     bson.A{bson.M{"url": req.SourceURL}, bson.M{"resolved_url": req.SourceURL}},
+		}
+	}
+
+	if filter != nil {
+		var product models.Product
+		findOptions := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		if err := productCollection.FindOne(ctx, filter, findOptions).Decode(&product); err == nil {
+			slot = product.Slot
+			if slot == "" {
+				// Products scraped before slot mapping existed
+				slot = scrapers.ClassifyProduct(&product)
+			}
+			category = strings.TrimSpace(product.Category)
+		}
+	}
+
+	if slot == "" {
+		slot = scrapers.ClassifyProduct(&models.Product{URL: req.SourceURL})
+	}
+	if category == "" {
+		category = slot
+	}
+	return category, slot
+}
+
 // removeProduct handles removing a product from the wardrobe
 func removeProduct(w http.ResponseWriter, r *http.Request, itemIDHex string) {
 	var logMessageBuilder strings.Builder
@@ -287,6 +345,7 @@ func removeProduct(w http.ResponseWriter, r *http.Request, itemIDHex string) {
 		utils.RespondError(w, &logMessageBuilder, "Item not found or unauthorized", http.StatusNotFound)
 		return
 	}
+	releaseSavedItem(userID, "wardrobe")
 
 	utils.AddToLogMessage(&logMessageBuilder, "Product removed from wardrobe")
 	w.WriteHeader(http.StatusNoContent)
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -29,6 +32,66 @@ var (
 	// InternalAPISecret is sent to server B in the X-Internal-Secret header so
 	// B can verify the request came from this server. Must match B's value.
 	InternalAPISecret string
+	// AdminAPISecret gates the /admin/* endpoints via the X-Admin-Secret
+	// header. When empty the admin endpoints are disabled entirely.
+	AdminAPISecret string
+
+	// ImageBackend selects the try-on image generator: "gemini" (default),
+	// "openai" for any OpenAI-compatible image edit API, or "stub" for a
+	// local composite that needs no API key.
+	ImageBackend     string
+	GeminiImageModel string
+	// GeminiFallbackModels are tried in order when GeminiImageModel is
+	// failing or its circuit breaker is open.
+	GeminiFallbackModels []string
+	// GeminiAPIKeys are rotated through when one hits its quota. Set from
+	// GEMINI_API_KEYS (comma-separated), else GEMINI_API_KEY.
+	GeminiAPIKeys    []string
+	OpenAIBaseURL    string
+	OpenAIAPIKey     string
+	OpenAIImageModel string
+
+	// Generation retry policy (see utils.GenerationPolicy)
+	GenerationMaxAttempts    int           // per model, for transient errors
+	GenerationBackoff        time.Duration // first retry delay, doubled each time
+	GenerationMaxBackoff     time.Duration
+	GenerationAttemptTimeout time.Duration
+	BreakerThreshold         int // consecutive transient failures that open a model's breaker
+	BreakerCooldown          time.Duration
+
+	// InstanceID names this server instance; it must stay the same across
+	// restarts. A restarting instance fails the try-on jobs it left
+	// unfinished. Defaults to the host name.
+	InstanceID string
+
+	// GenerationConcurrency is how many image generations run at once
+	// across the process. Up to GenerationQueueSize more wait, by plan
+	// priority, for at most GenerationMaxWait.
+	GenerationConcurrency int
+	GenerationQueueSize   int
+	GenerationMaxWait     time.Duration
+
+	// BillingProvider selects the payment provider: "razorpay", "stripe",
+	// or "fake" for local development. Empty (the default) turns checkout
+	// off. Fake webhooks are signed with FakeBillingSecret and rejected
+	// while it is empty.
+	BillingProvider string
+	// BillingSuccessURL / BillingCancelURL are where checkout sends the
+	// user back to.
+	BillingSuccessURL string
+	BillingCancelURL  string
+	FakeBillingSecret string
+
+	RazorpayKeyID         string
+	RazorpayKeySecret     string
+	RazorpayWebhookSecret string
+	// RazorpayPlans maps our plans to Razorpay plan ids
+	RazorpayPlans map[string]string
+
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	// StripePrices maps our plans to recurring Stripe price ids
+	StripePrices map[string]string
 )
 
 // LoadConfig loads environment variables from .env file
@@ -55,6 +118,13 @@ func LoadConfig() {
 	}
 
 	GeminiAPIKey = os.Getenv("GEMINI_API_KEY")
+	GeminiAPIKeys = splitList(os.Getenv("GEMINI_API_KEYS"))
+	if len(GeminiAPIKeys) == 0 && GeminiAPIKey != "" {
+		GeminiAPIKeys = []string{GeminiAPIKey}
+	}
+	if GeminiAPIKey == "" && len(GeminiAPIKeys) > 0 {
+		GeminiAPIKey = GeminiAPIKeys[0]
+	}
 
 	AWSRegion = os.Getenv("AWS_REGION")
 	if AWSRegion == "" {
@@ -79,4 +149,87 @@ func LoadConfig() {
 	// existing deployments keep scraping locally until B is configured.
 	ServerBScrapeURL = os.Getenv("SERVER_B_SCRAPE_URL")
 	InternalAPISecret = os.Getenv("INTERNAL_API_SECRET")
+
+	AdminAPISecret = os.Getenv("ADMIN_API_SECRET")
+
+	ImageBackend = os.Getenv("IMAGE_BACKEND")
+	if ImageBackend == "" {
+		ImageBackend = "gemini"
+	}
+	GeminiImageModel = os.Getenv("GEMINI_IMAGE_MODEL")
+	if GeminiImageModel == "" {
+		GeminiImageModel = "gemini-3-pro-image-preview"
+	}
+	OpenAIBaseURL = os.Getenv("OPENAI_BASE_URL")
+	if OpenAIBaseURL == "" {
+		OpenAIBaseURL = "https://api.openai.com/v1"
+	}
+	OpenAIAPIKey = os.Getenv("OPENAI_API_KEY")
+	OpenAIImageModel = os.Getenv("OPENAI_IMAGE_MODEL")
+	if OpenAIImageModel == "" {
+		OpenAIImageModel = "gpt-image-1"
+	}
+	GeminiFallbackModels = splitList(os.Getenv("GEMINI_FALLBACK_MODELS"))
+
+	GenerationMaxAttempts = envInt("GENERATION_MAX_ATTEMPTS", 3)
+	GenerationBackoff = time.Duration(envInt("GENERATION_BACKOFF_MS", 1000)) * time.Millisecond
+	GenerationMaxBackoff = time.Duration(envInt("GENERATION_MAX_BACKOFF_MS", 16000)) * time.Millisecond
+	GenerationAttemptTimeout = time.Duration(envInt("GENERATION_ATTEMPT_TIMEOUT_SEC", 120)) * time.Second
+	BreakerThreshold = envInt("BREAKER_THRESHOLD", 5)
+	BreakerCooldown = time.Duration(envInt("BREAKER_COOLDOWN_SEC", 60)) * time.Second
+
+	InstanceID = os.Getenv("INSTANCE_ID")
+	if InstanceID == "" {
+		InstanceID, _ = os.Hostname()
+	}
+
+	GenerationConcurrency = envInt("GENERATION_CONCURRENCY", 4)
+	GenerationQueueSize = envInt("GENERATION_QUEUE_SIZE", 100)
+	GenerationMaxWait = time.Duration(envInt("GENERATION_MAX_WAIT_SEC", 180)) * time.Second
+
+	BillingProvider = os.Getenv("BILLING_PROVIDER")
+	BillingSuccessURL = os.Getenv("BILLING_SUCCESS_URL")
+	if BillingSuccessURL == "" {
+		BillingSuccessURL = "https://tryonfusion.com/billing/success"
+	}
+	BillingCancelURL = os.Getenv("BILLING_CANCEL_URL")
+	if BillingCancelURL == "" {
+		BillingCancelURL = "https://tryonfusion.com/billing/cancel"
+	}
+	FakeBillingSecret = os.Getenv("FAKE_BILLING_SECRET")
+
+	RazorpayKeyID = os.Getenv("RAZORPAY_KEY_ID")
+	RazorpayKeySecret = os.Getenv("RAZORPAY_KEY_SECRET")
+	RazorpayWebhookSecret = os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+	RazorpayPlans = map[string]string{
+		"plus": os.Getenv("RAZORPAY_PLAN_PLUS"),
+		"pro":  os.Getenv("RAZORPAY_PLAN_PRO"),
+	}
+
+	StripeSecretKey = os.Getenv("STRIPE_SECRET_KEY")
+	StripeWebhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
+	StripePrices = map[string]string{
+		"plus": os.Getenv("STRIPE_PRICE_PLUS"),
+		"pro":  os.Getenv("STRIPE_PRICE_PRO"),
+	}
+}
+
+// splitList splits a comma-separated variable, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// envInt reads a positive integer variable, or returns def.
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
 }
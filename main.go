@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/raushankrgupta/web-product-scraper/api"
 	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 )
 
@@ -18,17 +20,55 @@ func main() {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 
+	// Normalize person measurements saved before unit handling
+	if n, err := api.MigratePersonMeasurements(); err != nil {
+		log.Printf("Person measurement migration failed: %v", err)
+	} else if n > 0 {
+		fmt.Printf("Migrated measurements of %d persons to cm\n", n)
+	}
+
 	// Initialize S3
 	if err := utils.InitS3(); err != nil {
 		log.Fatalf("Failed to initialize S3: %v", err)
 	}
 
+	// Select the try-on image backend
+	if err := utils.InitImageGenerator(); err != nil {
+		log.Fatalf("Failed to initialize image generator: %v", err)
+	}
+	if err := utils.InitPaymentProvider(); err != nil {
+		log.Fatalf("Failed to initialize payment provider: %v", err)
+	}
+
+	if err := api.EnsureIdempotencyIndexes(); err != nil {
+		log.Printf("Failed to create idempotency indexes: %v", err)
+	}
+	if err := utils.EnsureQuotaIndexes(); err != nil {
+		log.Printf("Failed to create quota indexes: %v", err)
+	}
+	if err := utils.EnsureCreditIndexes(); err != nil {
+		log.Printf("Failed to create credit indexes: %v", err)
+	}
+	if err := utils.EnsureBillingIndexes(); err != nil {
+		log.Printf("Failed to create billing indexes: %v", err)
+	}
+	// Plan entitlements are cached in process; the defaults apply until
+	// they load
+	if err := utils.InitPlanEntitlements(context.Background()); err != nil {
+		log.Printf("Failed to load plan entitlements: %v", err)
+	}
+
+	// Bound concurrent generations and clean up unfinished try-on jobs
+	utils.InitGenerationScheduler()
+	api.InitTryOnJobs()
+
 	// CORS Middleware
 	corsMiddleware := func(next http.Handler) http.Handler {
 		return utils.LatencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Idempotency-Key, Prefer")
+			w.Header().Set("Access-Control-Expose-Headers", "Location, Idempotent-Replayed, Retry-After")
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
 				return
@@ -54,13 +94,19 @@ func main() {
 
 	// Billing / quota
 	http.Handle("/billing/status", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.BillingStatusHandler))))
+	http.Handle("/billing/ledger", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.CreditLedgerHandler))))
+	http.Handle("/billing/checkout", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.CheckoutHandler))))
+	http.Handle("/billing/subscription/cancel", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.CancelSubscriptionHandler))))
+	// Payment provider webhooks: public, verified by signature
+	http.Handle("/billing/webhook/", corsMiddleware(http.HandlerFunc(api.BillingWebhookHandler)))
 
 	// Legal Routes
 	http.Handle("/legal/privacy-policy", corsMiddleware(http.HandlerFunc(api.GetPrivacyPolicy)))
 	http.Handle("/legal/terms-of-service", corsMiddleware(http.HandlerFunc(api.GetTermsOfService)))
 
-	http.Handle("/product/details", corsMiddleware(api.ImageCacheMiddleware(api.AuthMiddleware(http.HandlerFunc(api.ScrapeHandler)), true)))
+	http.Handle("/product/details", corsMiddleware(api.ImageCacheMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(http.HandlerFunc(api.ScrapeHandler))), true)))
 	http.Handle("/product/upload", corsMiddleware(api.ImageCacheMiddleware(api.AuthMiddleware(http.HandlerFunc(api.UploadProductHandler)), true)))
+	http.Handle("/product/", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.ProductHandler))))
 
 	http.Handle("/themes", corsMiddleware(api.ImageCacheMiddleware(http.HandlerFunc(api.GetThemesHandler), true)))
 
@@ -74,17 +120,27 @@ func main() {
 	http.Handle("/persons", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.PersonHandler))))
 	http.Handle("/persons/", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.PersonHandler))))
 
-	// Try-on endpoints: AuthMiddleware → QuotaMiddleware → handler.
-	// QuotaMiddleware checks the per-user daily cap before invoking the handler
-	// and bumps the counter after a successful 2xx response.
-	http.Handle("/try-on", corsMiddleware(api.AuthMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.VirtualTryOnHandler)))))
-	http.Handle("/try-on/individual", corsMiddleware(api.AuthMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.IndividualTryOnHandler)))))
-	http.Handle("/try-on/couple", corsMiddleware(api.AuthMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.CoupleTryOnHandler)))))
-	http.Handle("/try-on/group", corsMiddleware(api.AuthMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.GroupTryOnHandler)))))
+	// Try-on endpoints: AuthMiddleware → IdempotencyMiddleware → EntitlementMiddleware → QuotaMiddleware → handler.
+	// IdempotencyMiddleware replays the stored response for a retried
+	// Idempotency-Key before quota is checked or charged.
+	// EntitlementMiddleware rejects try-on types and themes the caller's
+	// plan doesn't include (see models.PlanEntitlements).
+	// QuotaMiddleware reserves the request's units of the per-user daily cap
+	// (priced by the route's cost func) before invoking the handler, commits
+	// them after a successful 2xx response and releases them otherwise. The
+	// try-on handlers queue a job and defer the charge until it completes.
+	http.Handle("/try-on", corsMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(api.EntitlementMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.VirtualTryOnHandler), api.SingleTryOnCost), models.TryOnTypeProduct, api.SingleTryOnCost)))))
+	http.Handle("/try-on/individual", corsMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(api.EntitlementMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.IndividualTryOnHandler), api.AdvancedTryOnCost), models.TryOnTypeIndividual, api.AdvancedTryOnCost)))))
+	http.Handle("/try-on/couple", corsMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(api.EntitlementMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.CoupleTryOnHandler), api.AdvancedTryOnCost), models.TryOnTypeCouple, api.AdvancedTryOnCost)))))
+	http.Handle("/try-on/group", corsMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(api.EntitlementMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.GroupTryOnHandler), api.AdvancedTryOnCost), models.TryOnTypeGroup, api.AdvancedTryOnCost)))))
 	// Guest try-on: one-shot endpoint for anonymous users (no persistence).
-	// Uses the same AuthMiddleware → QuotaMiddleware sandwich because guest
-	// tokens come through the same path with plan=guest, capped at 1/day.
-	http.Handle("/try-on/guest", corsMiddleware(api.AuthMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.GuestTryOnHandler)))))
+	// Uses the same middleware chain because guest tokens come through the
+	// same path with plan=guest, capped at 1 unit/day by default. Only the
+	// guest plan includes this try-on type.
+	http.Handle("/try-on/guest", corsMiddleware(api.AuthMiddleware(api.IdempotencyMiddleware(api.EntitlementMiddleware(api.QuotaMiddleware(http.HandlerFunc(api.GuestTryOnHandler), api.SingleTryOnCost), models.TryOnTypeGuest, api.SingleTryOnCost)))))
+	// Try-on job status: polling and an SSE stream. No quota — reading a
+	// job doesn't cost a try-on.
+	http.Handle("/try-on/jobs/", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.TryOnJobHandler))))
 	// Gallery, wardrobe, and feedback all return user-specific JSON (not raw
 	// images), and the response also contains presigned S3 URLs that expire
 	// quickly. Wrapping these in ImageCacheMiddleware caused two bugs:
@@ -101,6 +157,15 @@ func main() {
 	http.Handle("/wardrobe", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.WardrobeHandler))))
 	http.Handle("/wardrobe/", corsMiddleware(api.AuthMiddleware(http.HandlerFunc(api.WardrobeHandler))))
 
+	// Admin / internal tooling. Gated by ADMIN_API_SECRET (X-Admin-Secret
+	// header); disabled when the secret isn't configured.
+	http.Handle("/admin/failed-scrapes", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminFailedScrapesHandler))))
+	http.Handle("/admin/failed-scrapes/", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminFailedScrapesHandler))))
+	http.Handle("/admin/credits/", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminCreditsHandler))))
+	http.Handle("/admin/plans", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminPlansHandler))))
+	http.Handle("/admin/plans/", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminPlansHandler))))
+	http.Handle("/admin/metrics", corsMiddleware(api.AdminMiddleware(http.HandlerFunc(api.AdminMetricsHandler))))
+
 	port := config.Port
 	fmt.Printf("Server starting on port %s...\n", port)
 	if err := http.ListenAndServe(":"+port, http.DefaultServeMux); err != nil {
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Canonical materials
+const (
+	MaterialCotton    = "cotton"
+	MaterialLinen     = "linen"
+	MaterialPolyester = "polyester"
+	MaterialViscose   = "viscose"
+	MaterialWool      = "wool"
+	MaterialSilk      = "silk"
+	MaterialDenim     = "denim"
+	MaterialNylon     = "nylon"
+	MaterialLeather   = "leather"
+	MaterialBlend     = "blend"
+)
+
+// Canonical fits
+const (
+	FitSkinny    = "skinny"
+	FitSlim      = "slim"
+	FitRegular   = "regular"
+	FitRelaxed   = "relaxed"
+	FitOversized = "oversized"
+)
+
+// Canonical patterns
+const (
+	PatternSolid       = "solid"
+	PatternStriped     = "striped"
+	PatternChecked     = "checked"
+	PatternFloral      = "floral"
+	PatternGraphic     = "graphic"
+	PatternPrinted     = "printed"
+	PatternEmbroidered = "embroidered"
+	PatternColorblock  = "colorblock"
+)
+
+// NormalizedAttribute is a scraped attribute mapped onto a controlled
+// vocabulary. Raw keeps the store's text it was derived from; Confidence is
+// 1 for an exact vocabulary match and lower when the value was picked out of
+// a longer string or inferred from the title / description.
+type NormalizedAttribute struct {
+	Value      string  `bson:"value" json:"value"`
+	Confidence float64 `bson:"confidence" json:"confidence"`
+	Raw        string  `bson:"raw,omitempty" json:"raw,omitempty"`
+}
+
+// ProductAttributes holds the normalized attributes of a product. The raw
+// store values stay on Product (Material, FitType, ...).
+type ProductAttributes struct {
+	Material *NormalizedAttribute `bson:"material,omitempty" json:"material,omitempty"`
+	Fit      *NormalizedAttribute `bson:"fit,omitempty" json:"fit,omitempty"`
+	Color    *NormalizedAttribute `bson:"color,omitempty" json:"color,omitempty"` // One of a fixed basic colour list ("navy", "maroon", "multicolor", ...)
+	Pattern  *NormalizedAttribute `bson:"pattern,omitempty" json:"pattern,omitempty"`
+}
+
+// IsEmpty reports whether no attribute could be normalized.
+func (a *ProductAttributes) IsEmpty() bool {
+	return a == nil || (a.Material == nil && a.Fit == nil && a.Color == nil && a.Pattern == nil)
+}
+
+// PromptConfidence is the minimum confidence for an attribute to be
+// mentioned in a try-on prompt. It sits above what a title match scores,
+// so only values read from the product's own attribute fields are used.
+const PromptConfidence = 0.7
+
+// Summary renders the confident attributes as "Material: cotton, Fit: slim"
+// for prompts. Returns "" when there are none.
+func (a *ProductAttributes) Summary() string {
+	if a == nil {
+		return ""
+	}
+	var parts []string
+	for _, attr := range []struct {
+		label string
+		value *NormalizedAttribute
+	}{
+		{"Material", a.Material},
+		{"Fit", a.Fit},
+		{"Color", a.Color},
+		{"Pattern", a.Pattern},
+	} {
+		if attr.value != nil && attr.value.Confidence >= PromptConfidence {
+			parts = append(parts, fmt.Sprintf("%s: %s", attr.label, attr.value.Value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
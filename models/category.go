@@ -0,0 +1,27 @@
+package models
+
+// Garment slots: our store-independent category taxonomy. Each scraped
+// product is classified into one of these, and they line up with the
+// try-on slots on TryOnPerson (outerwear and footwear are worn over / with
+// the top and bottom slots).
+const (
+	SlotTop       = "top"
+	SlotBottom    = "bottom"
+	SlotDress     = "dress"
+	SlotOuterwear = "outerwear"
+	SlotFootwear  = "footwear"
+	SlotAccessory = "accessory"
+)
+
+// GarmentSlots lists every slot in display order.
+var GarmentSlots = []string{SlotTop, SlotBottom, SlotDress, SlotOuterwear, SlotFootwear, SlotAccessory}
+
+// IsValidSlot reports whether s is one of GarmentSlots.
+func IsValidSlot(s string) bool {
+	for _, slot := range GarmentSlots {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
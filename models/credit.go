@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Credit sources, and the ledger entry kinds that change a balance.
+const (
+	CreditSourceAllowance = "allowance" // monthly plan allowance
+	CreditSourcePack      = "pack"      // purchased credit pack
+	CreditSourcePromo     = "promo"     // promotional grant
+
+	LedgerGrant   = "grant"   // units added as a new lot
+	LedgerConsume = "consume" // units spent on a try-on
+	LedgerRefund  = "refund"  // consumed units given back after a failed try-on
+	LedgerExpire  = "expire"  // unspent units of an expired lot
+)
+
+// CreditAccount holds a user's credit lots. Units are the same quota units
+// as the daily limit (see TryOnCost) and are spent once the day's free
+// units run out. One document per user; Version guards concurrent updates.
+// Every change is also written to credit_ledger: the entries are saved in
+// PendingLedger along with the change, then copied to the ledger.
+type CreditAccount struct {
+	UserID string      `bson:"user_id" json:"user_id"`
+	Lots   []CreditLot `bson:"lots" json:"lots"`
+	// AllowancePeriod is the month (YYYY-MM, UTC) whose plan allowance has
+	// been granted
+	AllowancePeriod string `bson:"allowance_period,omitempty" json:"allowance_period,omitempty"`
+	AllowancePlan   string `bson:"allowance_plan,omitempty" json:"allowance_plan,omitempty"`
+	// PendingLedger are ledger entries not yet copied to credit_ledger
+	PendingLedger []CreditLedgerEntry `bson:"pending_ledger,omitempty" json:"-"`
+	Version       int64               `bson:"version" json:"-"`
+	UpdatedAt     time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// CreditLot is one grant of credits. Lots are spent soonest-expiring first
+// and removed once empty or expired.
+type CreditLot struct {
+	ID        string     `bson:"id" json:"id"`
+	Source    string     `bson:"source" json:"source"`
+	Units     int        `bson:"units" json:"units"` // granted
+	Remaining int        `bson:"remaining" json:"remaining"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // nil never expires
+	Ref       string     `bson:"ref,omitempty" json:"ref,omitempty"`               // pack id, payment or campaign; grants with the same ref are applied once
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// CreditLedgerEntry is one append-only change to a user's credits. Units is
+// positive for grants and refunds, negative for consumption and expiry.
+type CreditLedgerEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Key       string             `bson:"key,omitempty" json:"-"` // user, account version and index; copying an entry twice is a no-op
+	Kind      string             `bson:"kind" json:"kind"`
+	Source    string             `bson:"source" json:"source"`
+	LotID     string             `bson:"lot_id" json:"lot_id"`
+	Units     int                `bson:"units" json:"units"`
+	Balance   int                `bson:"balance" json:"balance"` // total after the change
+	Ref       string             `bson:"ref,omitempty" json:"ref,omitempty"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CreditPack is a one-off purchasable bundle of credits.
+type CreditPack struct {
+	ID         string `json:"id"`
+	Units      int    `json:"units"`
+	PriceCents int    `json:"price_cents"`
+	Currency   string `json:"currency"`
+	ValidDays  int    `json:"valid_days"` // credits expire this long after purchase
+}
+
+// CreditPacks is the pack catalogue.
+var CreditPacks = []CreditPack{
+	{ID: "pack_10", Units: 10, PriceCents: 9900, Currency: "INR", ValidDays: 365},
+	{ID: "pack_30", Units: 30, PriceCents: 24900, Currency: "INR", ValidDays: 365},
+	{ID: "pack_100", Units: 100, PriceCents: 69900, Currency: "INR", ValidDays: 365},
+}
+
+// FindCreditPack returns the pack with the given id, or nil.
+func FindCreditPack(id string) *CreditPack {
+	for i := range CreditPacks {
+		if CreditPacks[i].ID == id {
+			return &CreditPacks[i]
+		}
+	}
+	return nil
+}
+
+// MonthlyAllowanceForPlan returns the credits a plan is granted each UTC
+// month on top of its daily limit. They expire at the end of the month.
+func MonthlyAllowanceForPlan(plan string) int {
+	return EntitlementsForPlan(plan).MonthlyAllowance
+}
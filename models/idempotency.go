@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Idempotency record states.
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord stores the response to a POST sent with an
+// Idempotency-Key header, so a retry with the same key gets the same
+// response instead of running again. One document per (user_id, key);
+// expired ones are removed by a TTL index on expires_at.
+type IdempotencyRecord struct {
+	UserID      string    `bson:"user_id"`
+	Key         string    `bson:"key"`
+	RequestHash string    `bson:"request_hash"` // method, path, query and body (multipart by field)
+	State       string    `bson:"state"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Location    string    `bson:"location,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	JobID       string    `bson:"job_id,omitempty"` // try-on job the response describes; replays are rebuilt from it
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
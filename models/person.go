@@ -1,25 +1,224 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Unit systems a person's measurements can be entered and displayed in.
+// Storage is always metric (cm / kg) whatever the person's preference.
+const (
+	UnitsMetric   = "metric"   // cm, kg
+	UnitsImperial = "imperial" // inches, lb
+	// UnitsLegacy is the contract from before units could be chosen, used
+	// when a request doesn't send units: height in cm, weight in kg, and
+	// chest, waist and hips in inches.
+	UnitsLegacy = "legacy"
+)
+
+// MeasurementUnitCM marks person documents whose measurements are stored
+// in canonical cm / kg. Documents without it predate unit handling and are
+// normalized at startup.
+const MeasurementUnitCM = "cm"
+
+const lbPerKG = 2.20462
+
+// EstimableMeasurements are the fields the photo estimator can fill.
+var EstimableMeasurements = []string{MeasureChest, MeasureWaist, MeasureHips}
+
 // Person represents a user profile with body dimensions and images
 type Person struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"` // Link to User
-	Name       string             `bson:"name" json:"name"`
-	Age        int                `bson:"age" json:"age"`
-	Gender     string             `bson:"gender" json:"gender"`
-	Height     float64            `bson:"height" json:"height"` // in cm
-	Weight     float64            `bson:"weight" json:"weight"` // in kg
-	Chest      float64            `bson:"chest" json:"chest"`   // in inches
-	Waist      float64            `bson:"waist" json:"waist"`   // in inches
-	Hips       float64            `bson:"hips" json:"hips"`     // in inches
-	ImagePaths []string           `bson:"image_paths" json:"image_paths"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
-	IsDeleted  bool               `bson:"is_deleted" json:"is_deleted"` // Soft delete flag
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"` // Link to User
+	Name            string             `bson:"name" json:"name"`
+	Age             int                `bson:"age" json:"age"`
+	Gender          string             `bson:"gender" json:"gender"`
+	Height          float64            `bson:"height" json:"height"`         // in cm
+	Weight          float64            `bson:"weight" json:"weight"`         // in kg
+	Chest           float64            `bson:"chest" json:"chest"`           // in cm
+	Waist           float64            `bson:"waist" json:"waist"`           // in cm
+	Hips            float64            `bson:"hips" json:"hips"`             // in cm
+	Units           string             `bson:"units,omitempty" json:"units"` // UnitsMetric, UnitsImperial or UnitsLegacy: input / display preference
+	MeasurementUnit string             `bson:"measurement_unit,omitempty" json:"-"`
+	EstimatedFields []string           `bson:"estimated_fields,omitempty" json:"estimated_fields,omitempty"` // Measurements estimated from a photo, not yet confirmed
+	EstimationError string             `bson:"-" json:"estimation_error,omitempty"`                          // Why estimate_measurements filled nothing; responses only
+	ImagePaths      []string           `bson:"image_paths" json:"image_paths"`
+	PrimaryImage    string             `bson:"primary_image,omitempty" json:"primary_image,omitempty"` // Entry of ImagePaths try-on uses by default
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	IsDeleted       bool               `bson:"is_deleted" json:"is_deleted"` // Soft delete flag
+}
+
+// IsValidUnits reports whether units is a supported unit system.
+func IsValidUnits(units string) bool {
+	return units == UnitsMetric || units == UnitsImperial || units == UnitsLegacy
+}
+
+// IsFemale reports whether a profile's free-text gender is female, however
+// it was entered ("F", "Female", "woman", "Women", ...).
+func IsFemale(gender string) bool {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "f", "female", "woman", "women", "girl":
+		return true
+	}
+	return false
+}
+
+// LengthToCM converts a length entered in units to cm.
+func LengthToCM(value float64, units string) float64 {
+	if units == UnitsImperial {
+		return ToCM(value, "in")
+	}
+	return value
+}
+
+// GirthToCM converts a chest, waist or hips value entered in units to cm.
+func GirthToCM(value float64, units string) float64 {
+	if units == UnitsLegacy {
+		return ToCM(value, "in")
+	}
+	return LengthToCM(value, units)
+}
+
+// WeightToKG converts a weight entered in units to kg.
+func WeightToKG(value float64, units string) float64 {
+	if units == UnitsImperial {
+		return value / lbPerKG
+	}
+	return value
+}
+
+// InUnits returns a copy of the person with measurements converted from
+// storage (cm / kg) to units, rounded to one decimal, for API responses.
+func (p Person) InUnits(units string) Person {
+	if !IsValidUnits(units) {
+		units = UnitsLegacy
+	}
+	p.Units = units
+	length := func(cm float64) float64 {
+		if units == UnitsImperial {
+			cm /= 2.54
+		}
+		return math.Round(cm*10) / 10
+	}
+	girth := length
+	if units == UnitsLegacy {
+		girth = func(cm float64) float64 { return math.Round(cm/2.54*10) / 10 }
+	}
+	weight := p.Weight
+	if units == UnitsImperial {
+		weight *= lbPerKG
+	}
+	p.Height = length(p.Height)
+	p.Weight = math.Round(weight*10) / 10
+	p.Chest = girth(p.Chest)
+	p.Waist = girth(p.Waist)
+	p.Hips = girth(p.Hips)
+	return p
+}
+
+// MeasurementDetails renders gender and the known measurements with
+// explicit metric units for the try-on prompts. Unset values are skipped.
+func (p *Person) MeasurementDetails() string {
+	var parts []string
+	if p.Gender != "" {
+		parts = append(parts, fmt.Sprintf("Gender: %s", p.Gender))
+	}
+	for _, m := range []struct {
+		name  string
+		value float64
+		unit  string
+	}{
+		{"Height", p.Height, "cm"},
+		{"Weight", p.Weight, "kg"},
+		{"Chest", p.Chest, "cm"},
+		{"Waist", p.Waist, "cm"},
+		{"Hips", p.Hips, "cm"},
+	} {
+		if m.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %.1f %s", m.name, m.value, m.unit))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IsEstimated reports whether field holds an unconfirmed estimate.
+func (p *Person) IsEstimated(field string) bool {
+	for _, f := range p.EstimatedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearEstimated drops field from EstimatedFields, e.g. once the user has
+// entered it themselves.
+func (p *Person) ClearEstimated(field string) {
+	kept := p.EstimatedFields[:0]
+	for _, f := range p.EstimatedFields {
+		if f != field {
+			kept = append(kept, f)
+		}
+	}
+	p.EstimatedFields = kept
+}
+
+// TryOnPhotos picks the person photos (S3 keys) to send to the generator:
+// the photo chosen by key or index, else PrimaryImage, else the first
+// photo. With multiReference a second photo of the person is added (the
+// primary one if it wasn't chosen, else the next photo) to help preserve
+// their identity.
+func (p *Person) TryOnPhotos(key string, index *int, multiReference bool) ([]string, error) {
+	if len(p.ImagePaths) == 0 {
+		return nil, errors.New("person has no images")
+	}
+
+	chosen := -1
+	switch {
+	case key != "":
+		for i, img := range p.ImagePaths {
+			if img == key {
+				chosen = i
+				break
+			}
+		}
+		if chosen == -1 {
+			return nil, fmt.Errorf("image %s is not one of the person's images", key)
+		}
+	case index != nil:
+		if *index < 0 || *index >= len(p.ImagePaths) {
+			return nil, fmt.Errorf("image_index %d out of range (person has %d images)", *index, len(p.ImagePaths))
+		}
+		chosen = *index
+	default:
+		chosen = 0
+		for i, img := range p.ImagePaths {
+			if img == p.PrimaryImage {
+				chosen = i
+				break
+			}
+		}
+	}
+
+	photos := []string{p.ImagePaths[chosen]}
+	if multiReference && len(p.ImagePaths) > 1 {
+		second := -1
+		for i, img := range p.ImagePaths {
+			if i != chosen && img == p.PrimaryImage {
+				second = i
+				break
+			}
+		}
+		if second == -1 {
+			second = (chosen + 1) % len(p.ImagePaths)
+		}
+		photos = append(photos, p.ImagePaths[second])
+	}
+	return photos, nil
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnitConversions(t *testing.T) {
+	tests := []struct {
+		name       string
+		units      string
+		value      float64
+		wantLength float64
+		wantGirth  float64
+		wantWeight float64
+	}{
+		{name: "metric", units: UnitsMetric, value: 100, wantLength: 100, wantGirth: 100, wantWeight: 100},
+		{name: "imperial", units: UnitsImperial, value: 40, wantLength: 101.6, wantGirth: 101.6, wantWeight: 18.14},
+		// Legacy profiles sent height in cm and weight in kg, but girths
+		// in inches
+		{name: "legacy", units: UnitsLegacy, value: 40, wantLength: 40, wantGirth: 101.6, wantWeight: 40},
+		{name: "unknown units are metric", units: "stones", value: 40, wantLength: 40, wantGirth: 40, wantWeight: 40},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LengthToCM(tt.value, tt.units); !near(got, tt.wantLength) {
+				t.Errorf("LengthToCM = %v, want %v", got, tt.wantLength)
+			}
+			if got := GirthToCM(tt.value, tt.units); !near(got, tt.wantGirth) {
+				t.Errorf("GirthToCM = %v, want %v", got, tt.wantGirth)
+			}
+			if got := WeightToKG(tt.value, tt.units); !near(got, tt.wantWeight) {
+				t.Errorf("WeightToKG = %v, want %v", got, tt.wantWeight)
+			}
+		})
+	}
+}
+
+func TestPersonInUnits(t *testing.T) {
+	stored := Person{Height: 175, Weight: 70, Chest: 101.6, Waist: 81.28, Hips: 96.52}
+
+	tests := []struct {
+		units string
+		want  Person
+	}{
+		{UnitsMetric, Person{Units: UnitsMetric, Height: 175, Weight: 70, Chest: 101.6, Waist: 81.3, Hips: 96.5}},
+		{UnitsImperial, Person{Units: UnitsImperial, Height: 68.9, Weight: 154.3, Chest: 40, Waist: 32, Hips: 38}},
+		{UnitsLegacy, Person{Units: UnitsLegacy, Height: 175, Weight: 70, Chest: 40, Waist: 32, Hips: 38}},
+		{"", Person{Units: UnitsLegacy, Height: 175, Weight: 70, Chest: 40, Waist: 32, Hips: 38}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.units, func(t *testing.T) {
+			got := stored.InUnits(tt.units)
+			if got.Units != tt.want.Units || got.Height != tt.want.Height || got.Weight != tt.want.Weight ||
+				got.Chest != tt.want.Chest || got.Waist != tt.want.Waist || got.Hips != tt.want.Hips {
+				t.Errorf("InUnits(%q) = %s %v/%v/%v/%v/%v, want %s %v/%v/%v/%v/%v", tt.units,
+					got.Units, got.Height, got.Weight, got.Chest, got.Waist, got.Hips,
+					tt.want.Units, tt.want.Height, tt.want.Weight, tt.want.Chest, tt.want.Waist, tt.want.Hips)
+			}
+		})
+	}
+}
+
+func TestIsFemale(t *testing.T) {
+	for gender, want := range map[string]bool{
+		"Female": true, " woman ": true, "WOMEN": true, "f": true, "girl": true,
+		"Male": false, "man": false, "": false, "other": false,
+	} {
+		if got := IsFemale(gender); got != want {
+			t.Errorf("IsFemale(%q) = %v, want %v", gender, got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Try-on types a plan can allow, one per try-on endpoint.
+const (
+	TryOnTypeProduct    = "product" // /try-on
+	TryOnTypeIndividual = "individual"
+	TryOnTypeCouple     = "couple"
+	TryOnTypeGroup      = "group"
+	TryOnTypeGuest      = "guest" // /try-on/guest
+)
+
+// TryOnTypes lists every try-on type.
+var TryOnTypes = []string{TryOnTypeProduct, TryOnTypeIndividual, TryOnTypeCouple, TryOnTypeGroup, TryOnTypeGuest}
+
+// Plans lists every plan, lowest first.
+var Plans = []string{PlanGuest, PlanFree, PlanPlus, PlanPro}
+
+// PlanRank orders plans as listed in Plans, to pick the best of several
+// subscriptions and tell an upgrade. Unknown plans rank below all of
+// them.
+func PlanRank(plan string) int {
+	return slices.Index(Plans, plan)
+}
+
+// PlanEntitlements is what a plan includes. One document per plan in the
+// plans collection, keyed by plan name, editable through /admin/plans.
+// For the limits, 0 means unlimited.
+type PlanEntitlements struct {
+	Plan              string    `bson:"_id" json:"plan"`
+	DailyLimit        int       `bson:"daily_limit" json:"daily_limit"`             // quota units per UTC day
+	MonthlyAllowance  int       `bson:"monthly_allowance" json:"monthly_allowance"` // credits granted each UTC month; 0 grants none
+	TryOnTypes        []string  `bson:"tryon_types" json:"tryon_types"`
+	Themes            bool      `bson:"themes" json:"themes"`                             // may render into a theme scene
+	MaxPersons        int       `bson:"max_persons" json:"max_persons"`                   // saved person profiles
+	MaxWardrobeItems  int       `bson:"max_wardrobe_items" json:"max_wardrobe_items"`     // saved wardrobe items
+	MaxPeoplePerTryOn int       `bson:"max_people_per_tryon" json:"max_people_per_tryon"` // people in one try-on
+	Watermark         bool      `bson:"watermark" json:"watermark"`                       // generated images are watermarked
+	Priority          int       `bson:"priority" json:"priority"`                         // generation queue order: higher runs first
+	UpdatedAt         time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// AllowsTryOn reports whether the plan includes the given try-on type.
+func (e PlanEntitlements) AllowsTryOn(tryOnType string) bool {
+	return slices.Contains(e.TryOnTypes, tryOnType)
+}
+
+// Validate checks the limits and try-on types.
+func (e PlanEntitlements) Validate() error {
+	if !slices.Contains(Plans, e.Plan) {
+		return fmt.Errorf("unknown plan %q", e.Plan)
+	}
+	if e.DailyLimit < 0 || e.MonthlyAllowance < 0 || e.MaxPersons < 0 || e.MaxWardrobeItems < 0 || e.MaxPeoplePerTryOn < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for _, t := range e.TryOnTypes {
+		if !slices.Contains(TryOnTypes, t) {
+			return fmt.Errorf("unknown try-on type %q", t)
+		}
+	}
+	return nil
+}
+
+// DefaultPlanEntitlements are the plans seeded into an empty plans
+// collection, and used for any plan missing from it.
+func DefaultPlanEntitlements() []PlanEntitlements {
+	signedIn := []string{TryOnTypeProduct, TryOnTypeIndividual, TryOnTypeCouple, TryOnTypeGroup}
+	return []PlanEntitlements{
+		{Plan: PlanGuest, DailyLimit: 1, TryOnTypes: []string{TryOnTypeGuest}, Watermark: true, Priority: 0},
+		{Plan: PlanFree, DailyLimit: 5, TryOnTypes: signedIn, Themes: true, MaxPeoplePerTryOn: 4, Priority: 1},
+		{Plan: PlanPlus, DailyLimit: 50, MonthlyAllowance: 100, TryOnTypes: signedIn, Themes: true, MaxPeoplePerTryOn: 8, Priority: 2},
+		{Plan: PlanPro, DailyLimit: 0, TryOnTypes: signedIn, Themes: true, Priority: 3},
+	}
+}
+
+// planEntitlements is the in-process copy of the plans collection,
+// refreshed by utils.LoadPlanEntitlements.
+var planEntitlements = struct {
+	sync.RWMutex
+	byPlan map[string]PlanEntitlements
+}{byPlan: planMap(nil)}
+
+// planMap returns the defaults overlaid with plans.
+func planMap(plans []PlanEntitlements) map[string]PlanEntitlements {
+	m := make(map[string]PlanEntitlements)
+	for _, e := range DefaultPlanEntitlements() {
+		m[e.Plan] = e
+	}
+	for _, e := range plans {
+		m[e.Plan] = e
+	}
+	return m
+}
+
+// SetPlanEntitlements replaces the cached plans. Plans missing from the
+// list fall back to their defaults.
+func SetPlanEntitlements(plans []PlanEntitlements) {
+	m := planMap(plans)
+	planEntitlements.Lock()
+	planEntitlements.byPlan = m
+	planEntitlements.Unlock()
+}
+
+// EntitlementsForPlan returns what plan includes. Unknown plans get the
+// free plan's entitlements.
+func EntitlementsForPlan(plan string) PlanEntitlements {
+	planEntitlements.RLock()
+	defer planEntitlements.RUnlock()
+	if e, ok := planEntitlements.byPlan[plan]; ok {
+		return e
+	}
+	return planEntitlements.byPlan[PlanFree]
+}
+
+// AllPlanEntitlements returns every cached plan, lowest rank first.
+func AllPlanEntitlements() []PlanEntitlements {
+	planEntitlements.RLock()
+	out := make([]PlanEntitlements, 0, len(planEntitlements.byPlan))
+	for _, e := range planEntitlements.byPlan {
+		out = append(out, e)
+	}
+	planEntitlements.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return PlanRank(out[i].Plan) < PlanRank(out[j].Plan)
+	})
+	return out
+}
@@ -8,10 +8,11 @@ import (
 
 // Variant represents a specific product variation
 type Variant struct {
-	ASIN   string   `json:"asin"`
-	Size   string   `json:"size"`
-	Color  string   `json:"color"`
-	Images []string `json:"image_paths"`
+	ASIN      string   `json:"asin"` // Store's variant ID (ASIN on Amazon, pid / SKU elsewhere)
+	Size      string   `json:"size"`
+	Color     string   `json:"color"`
+	Images    []string `json:"image_paths"`
+	Available *bool    `bson:"available,omitempty" json:"available,omitempty"` // nil when the store doesn't expose stock
 }
 
 // Product represents the scraped product details
@@ -25,6 +26,7 @@ type Product struct {
 	ScrapeError      string             `bson:"scrape_error,omitempty" json:"scrape_error,omitempty"` // Error details when scraping fails
 	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
 	Title            string             `json:"title" bson:"title"`
+	Brand            string             `bson:"brand,omitempty" json:"brand,omitempty"`
 	MRP              string             `json:"mrp"`              // Maximum Retail Price (List Price)
 	DiscountedPrice  string             `json:"discounted_price"` // Selling Price
 	Discount         string             `json:"discount"`
@@ -34,7 +36,45 @@ type Product struct {
 	Dimensions       string             `json:"dimensions"`
 	Material         string             `json:"material"`
 	FitType          string             `json:"fit_type"`
+	Attributes       *ProductAttributes `bson:"attributes,omitempty" json:"attributes,omitempty"` // Material / FitType etc. mapped to canonical values
+	Slot             string             `bson:"slot,omitempty" json:"slot,omitempty"` // Garment slot (see GarmentSlots), mapped from Category / Subcategory
+	Specifications   map[string]string  `bson:"specifications,omitempty" json:"specifications,omitempty"` // Store attribute table (fabric, fit, neck, sleeve, ...)
+	SizeChart        *SizeChart         `bson:"size_chart,omitempty" json:"size_chart,omitempty"`
 	Images           []string           `json:"image_paths"`        // Main product images
 	CurrentSelection *Variant           `json:"current_selection"`  // Details of the currently selected variant
 	Variants         []Variant          `json:"variants,omitempty"` // All variants (hidden if empty)
+
+	// FailureArtifacts holds one entry per fetch strategy that failed, with
+	// S3 keys for the captured HTML / screenshot. Only set when Status is
+	// "failed".
+	FailureArtifacts []ScrapeAttempt `bson:"failure_artifacts,omitempty" json:"failure_artifacts,omitempty"`
+	// ScrapeTrace is only recorded for debug-mode scrapes.
+	ScrapeTrace *ScrapeTrace `bson:"scrape_trace,omitempty" json:"scrape_trace,omitempty"`
+
+	// Owner curation (PATCH /product/{id}). Both hold entries from Images.
+	ExcludedImages []string   `bson:"excluded_images,omitempty" json:"excluded_images,omitempty"`
+	PreferredImage string     `bson:"preferred_image,omitempty" json:"preferred_image,omitempty"` // Best garment shot, sent first to try-on
+	EditedAt       *time.Time `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+}
+
+// TryOnImages returns the images try-on should use: Images in their curated
+// order with exclusions removed and the preferred image moved to the front.
+// Products that were never curated return Images unchanged.
+func (p *Product) TryOnImages() []string {
+	excluded := make(map[string]bool, len(p.ExcludedImages))
+	for _, img := range p.ExcludedImages {
+		excluded[img] = true
+	}
+
+	var images []string
+	if p.PreferredImage != "" && !excluded[p.PreferredImage] {
+		images = append(images, p.PreferredImage)
+	}
+	for _, img := range p.Images {
+		if excluded[img] || img == p.PreferredImage {
+			continue
+		}
+		images = append(images, img)
+	}
+	return images
 }
@@ -7,29 +7,57 @@ import (
 )
 
 // TryOnQuota tracks per-user (or per-guest-device) try-on usage for a single
-// UTC calendar day. One document per (user_id, date) pair. Increment via
-// $inc; when the date rolls over we just insert a new document.
+// UTC calendar day, in quota units (see TryOnCost). One document per
+// (user_id, date) pair. Increment via $inc; when the date rolls over we just
+// insert a new document.
 type TryOnQuota struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID    string             `bson:"user_id" json:"user_id"` // user._id hex, or "guest:<device_id>"
 	Date      string             `bson:"date"    json:"date"`    // YYYY-MM-DD in UTC
-	Count     int                `bson:"count"   json:"count"`
+	Count     int                `bson:"count"   json:"count"`   // units used
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Reservations are try-ons in progress. They count against the limit
+	// until committed (moved into Count) or released.
+	Reservations []QuotaReservationEntry `bson:"reservations,omitempty" json:"reservations,omitempty"`
 }
 
-// DailyLimitForPlan returns how many try-ons a given plan is allowed per UTC
-// day. A return value of 0 means "unlimited" (Pro tier or B2B).
-func DailyLimitForPlan(plan string) int {
-	switch plan {
-	case PlanPro:
-		return 0
-	case PlanPlus:
-		return 50
-	case PlanGuest:
-		return 1
-	case PlanFree:
-		fallthrough
-	default:
-		return 5
+// QuotaReservationEntry is one in-progress try-on held against the quota.
+type QuotaReservationEntry struct {
+	ID        string    `bson:"id" json:"id"`
+	Units     int       `bson:"units" json:"units"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Quota units charged per try-on. A plain single-person try-on costs one
+// unit; the rest scale with the work sent to the image model.
+const (
+	UnitsPerPerson = 1 // each person rendered
+	UnitsPerTheme  = 1 // a theme scene on top of the people
+)
+
+// TryOnCost describes a try-on request for quota purposes.
+type TryOnCost struct {
+	People int  // people in the image; at least one is charged
+	Theme  bool // rendered into a theme scene
+}
+
+// Units is the quota the try-on uses: its people plus the theme.
+func (c TryOnCost) Units() int {
+	units := max(c.People, 1) * UnitsPerPerson
+	if c.Theme {
+		units += UnitsPerTheme
 	}
+	return units
+}
+
+// DailyLimitForPlan returns how many quota units a given plan is allowed per
+// UTC day. A return value of 0 means "unlimited" (Pro tier or B2B).
+func DailyLimitForPlan(plan string) int {
+	return EntitlementsForPlan(plan).DailyLimit
+}
+
+// PlanPriority orders plans in the generation queue: higher runs first.
+func PlanPriority(plan string) int {
+	return EntitlementsForPlan(plan).Priority
 }
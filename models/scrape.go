@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fetch strategy names recorded on a ScrapeAttempt.
+const (
+	StrategyHTTP     = "http"
+	StrategyChromeDP = "chromedp"
+	StrategySelenium = "selenium"
+)
+
+// ScrapeAttempt records what a single fetch strategy (HTTP / ChromeDP /
+// Selenium) saw. The raw HTML body and screenshot are held in memory only
+// long enough for the API layer to upload them to S3; only the resulting
+// object keys are persisted on the failed Product document.
+type ScrapeAttempt struct {
+	Strategy      string            `bson:"strategy" json:"strategy"`
+	Error         string            `bson:"error,omitempty" json:"error,omitempty"`
+	StatusCode    int               `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Headers       map[string]string `bson:"headers,omitempty" json:"headers,omitempty"`
+	HTMLKey       string            `bson:"html_key,omitempty" json:"html_key,omitempty"`
+	ScreenshotKey string            `bson:"screenshot_key,omitempty" json:"screenshot_key,omitempty"`
+	CapturedAt    time.Time         `bson:"captured_at" json:"captured_at"`
+
+	// Diagnostics filled in once the strategy returns (see ScrapeTrace).
+	DurationMS      int64  `bson:"duration_ms" json:"duration_ms"`
+	ValidatorPassed bool   `bson:"validator_passed" json:"validator_passed"`
+	Title           string `bson:"title,omitempty" json:"title,omitempty"`
+	BodyTextLen     int    `bson:"body_text_len,omitempty" json:"body_text_len,omitempty"`
+	BodySample      string `bson:"body_sample,omitempty" json:"body_sample,omitempty"`
+	Blocked         bool   `bson:"blocked" json:"blocked"` // block-page heuristics matched
+
+	HTML       []byte `bson:"-" json:"-"`
+	Screenshot []byte `bson:"-" json:"-"` // PNG, ChromeDP only
+}
+
+// privateScrapeHeaders are response headers never stored on an attempt:
+// they carry the site's session cookies or credentials.
+var privateScrapeHeaders = map[string]bool{
+	"Set-Cookie":          true,
+	"Set-Cookie2":         true,
+	"Cookie":              true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+}
+
+// RecordResponse stores the status code and a flattened copy of the response
+// headers on the attempt, without privateScrapeHeaders.
+func (a *ScrapeAttempt) RecordResponse(status int, header http.Header) {
+	a.StatusCode = status
+	if len(header) == 0 {
+		return
+	}
+	a.Headers = make(map[string]string, len(header))
+	for k, v := range header {
+		if privateScrapeHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		a.Headers[k] = strings.Join(v, ", ")
+	}
+}
+
+// ScrapeTrace is the structured record of one scrape: how the URL was
+// resolved, which scraper handled it, and every strategy it tried. Only
+// collected in debug mode (see api.ScrapeHandler).
+type ScrapeTrace struct {
+	URLChain   []string        `bson:"url_chain" json:"url_chain"`
+	Scraper    string          `bson:"scraper,omitempty" json:"scraper,omitempty"`
+	Attempts   []ScrapeAttempt `bson:"attempts" json:"attempts"`
+	Outcome    string          `bson:"outcome" json:"outcome"` // "success", "failed"
+	Error      string          `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time       `bson:"started_at" json:"started_at"`
+	DurationMS int64           `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Finish stamps the outcome and total duration on the trace.
+func (t *ScrapeTrace) Finish(err error) {
+	t.DurationMS = time.Since(t.StartedAt).Milliseconds()
+	if err != nil {
+		t.Outcome = "failed"
+		t.Error = err.Error()
+		return
+	}
+	t.Outcome = "success"
+}
+
+// ScrapeFailure is returned by the fetch chains when every strategy failed.
+// It wraps the final error and carries the per-strategy attempts so callers
+// can persist debugging artifacts with errors.As.
+type ScrapeFailure struct {
+	Err      error
+	Attempts []ScrapeAttempt
+}
+
+func (e *ScrapeFailure) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("scrape failed after %d attempts", len(e.Attempts))
+	}
+	return e.Err.Error()
+}
+
+func (e *ScrapeFailure) Unwrap() error {
+	return e.Err
+}
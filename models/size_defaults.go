@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Size chart sources for charts that weren't scraped.
+const (
+	SizeChartSourceBrandDefault = "brand_default"
+	SizeChartSourceDefault      = "default"
+)
+
+// sizeRow is one row of a default body chart: label -> measurement -> cm range.
+type sizeRow struct {
+	label string
+	cm    map[string]SizeRange
+}
+
+func cmRange(min, max float64) SizeRange { return SizeRange{Min: min, Max: max} }
+
+// Generic Indian-market body charts (cm), used when neither the store nor a
+// brand override gives us one.
+var (
+	menTopChart = []sizeRow{
+		{"XS", map[string]SizeRange{MeasureChest: cmRange(81, 86)}},
+		{"S", map[string]SizeRange{MeasureChest: cmRange(86, 94)}},
+		{"M", map[string]SizeRange{MeasureChest: cmRange(94, 102)}},
+		{"L", map[string]SizeRange{MeasureChest: cmRange(102, 110)}},
+		{"XL", map[string]SizeRange{MeasureChest: cmRange(110, 118)}},
+		{"XXL", map[string]SizeRange{MeasureChest: cmRange(118, 126)}},
+		{"3XL", map[string]SizeRange{MeasureChest: cmRange(126, 134)}},
+	}
+	menBottomLetterChart = []sizeRow{
+		{"S", map[string]SizeRange{MeasureWaist: cmRange(71, 79)}},
+		{"M", map[string]SizeRange{MeasureWaist: cmRange(79, 87)}},
+		{"L", map[string]SizeRange{MeasureWaist: cmRange(87, 95)}},
+		{"XL", map[string]SizeRange{MeasureWaist: cmRange(95, 103)}},
+		{"XXL", map[string]SizeRange{MeasureWaist: cmRange(103, 111)}},
+	}
+	womenChart = []sizeRow{
+		{"XS", map[string]SizeRange{MeasureChest: cmRange(76, 81), MeasureWaist: cmRange(61, 66), MeasureHips: cmRange(86, 91)}},
+		{"S", map[string]SizeRange{MeasureChest: cmRange(81, 86), MeasureWaist: cmRange(66, 71), MeasureHips: cmRange(91, 97)}},
+		{"M", map[string]SizeRange{MeasureChest: cmRange(86, 91), MeasureWaist: cmRange(71, 76), MeasureHips: cmRange(97, 102)}},
+		{"L", map[string]SizeRange{MeasureChest: cmRange(91, 97), MeasureWaist: cmRange(76, 81), MeasureHips: cmRange(102, 107)}},
+		{"XL", map[string]SizeRange{MeasureChest: cmRange(97, 104), MeasureWaist: cmRange(81, 89), MeasureHips: cmRange(107, 114)}},
+		{"XXL", map[string]SizeRange{MeasureChest: cmRange(104, 112), MeasureWaist: cmRange(89, 97), MeasureHips: cmRange(114, 122)}},
+	}
+)
+
+// abfrlShirtChart maps the collar-size labels Peter England, Allen Solly,
+// Van Heusen and Louis Philippe use for men's shirts to chest ranges.
+var abfrlShirtChart = []sizeRow{
+	{"38", map[string]SizeRange{MeasureChest: cmRange(91, 97)}},
+	{"39", map[string]SizeRange{MeasureChest: cmRange(97, 101)}},
+	{"40", map[string]SizeRange{MeasureChest: cmRange(101, 105)}},
+	{"42", map[string]SizeRange{MeasureChest: cmRange(105, 110)}},
+	{"44", map[string]SizeRange{MeasureChest: cmRange(110, 116)}},
+	{"46", map[string]SizeRange{MeasureChest: cmRange(116, 122)}},
+}
+
+// brandTopCharts holds brand-level overrides for men's tops, keyed by
+// lower-cased brand name.
+var brandTopCharts = map[string][]sizeRow{
+	"peter england":  abfrlShirtChart,
+	"allen solly":    abfrlShirtChart,
+	"van heusen":     abfrlShirtChart,
+	"louis philippe": abfrlShirtChart,
+}
+
+// numericWaistChart covers bottoms labelled by waist in inches (28, 30,
+// 32, ...), each fitting +/- half an inch.
+func numericWaistChart(from, to int) []sizeRow {
+	var rows []sizeRow
+	for w := from; w <= to; w++ {
+		cm := ToCM(float64(w), "in")
+		rows = append(rows, sizeRow{fmt.Sprintf("%d", w), map[string]SizeRange{MeasureWaist: cmRange(cm-1.27, cm+1.27)}})
+	}
+	return rows
+}
+
+// DefaultSizeChart returns the fallback body chart for a product with no
+// scraped chart: a brand-level chart when we have one for brand, else the
+// generic chart for the garment slot and the wearer's gender. Returns nil
+// for slots we don't size (footwear, accessories).
+func DefaultSizeChart(brand, slot, gender string) *SizeChart {
+	female := IsFemale(gender)
+
+	var rows []sizeRow
+	source := SizeChartSourceDefault
+	switch slot {
+	case SlotTop, SlotOuterwear, SlotDress, "":
+		if b, ok := brandTopCharts[strings.ToLower(strings.TrimSpace(brand))]; ok && !female && slot != SlotDress {
+			rows = append(rows, b...)
+			source = SizeChartSourceBrandDefault
+		}
+		if female {
+			rows = append(rows, womenChart...)
+		} else {
+			rows = append(rows, menTopChart...)
+		}
+	case SlotBottom:
+		if female {
+			rows = append(append(rows, womenChart...), numericWaistChart(24, 40)...)
+		} else {
+			rows = append(append(rows, menBottomLetterChart...), numericWaistChart(26, 44)...)
+		}
+	default:
+		return nil
+	}
+
+	chart := &SizeChart{Kind: SizeChartBody, Source: source}
+	for _, row := range rows {
+		chart.Sizes = append(chart.Sizes, SizeChartEntry{Label: row.label, Measurements: row.cm})
+	}
+	return chart
+}
@@ -0,0 +1,78 @@
+package models
+
+import "strings"
+
+// Size chart measurement kinds. Body charts give the wearer measurements
+// a size fits; garment charts give the flat measurements of the garment
+// itself (which run larger by the ease allowance).
+const (
+	SizeChartBody    = "body"
+	SizeChartGarment = "garment"
+)
+
+// Measurement names used as SizeChartEntry.Measurements keys.
+const (
+	MeasureChest    = "chest"
+	MeasureWaist    = "waist"
+	MeasureHips     = "hips"
+	MeasureShoulder = "shoulder"
+	MeasureLength   = "length"
+	MeasureSleeve   = "sleeve"
+	MeasureInseam   = "inseam"
+)
+
+// SizeRange is a measurement in cm. Single values have Min == Max.
+type SizeRange struct {
+	Min float64 `bson:"min" json:"min"`
+	Max float64 `bson:"max" json:"max"`
+}
+
+// SizeChartEntry is one size label with its measurements.
+type SizeChartEntry struct {
+	Label        string               `bson:"label" json:"label"`
+	Measurements map[string]SizeRange `bson:"measurements,omitempty" json:"measurements,omitempty"`
+	Available    *bool                `bson:"available,omitempty" json:"available,omitempty"`
+}
+
+// SizeChart maps a product's size labels to measurements, always stored
+// in cm whatever unit the store published.
+type SizeChart struct {
+	Kind   string           `bson:"kind" json:"kind"`     // SizeChartBody or SizeChartGarment
+	Source string           `bson:"source" json:"source"` // store the chart was scraped from
+	Sizes  []SizeChartEntry `bson:"sizes" json:"sizes"`
+}
+
+// CanonicalMeasurement maps a store's measurement label ("Chest",
+// "To Fit Waist", "Across Shoulder") to one of the Measure* names, or "".
+func CanonicalMeasurement(label string) string {
+	l := strings.ToLower(label)
+	switch {
+	case strings.Contains(l, "chest") || strings.Contains(l, "bust"):
+		return MeasureChest
+	case strings.Contains(l, "waist"):
+		return MeasureWaist
+	case strings.Contains(l, "hip"):
+		return MeasureHips
+	case strings.Contains(l, "shoulder"):
+		return MeasureShoulder
+	case strings.Contains(l, "sleeve"):
+		return MeasureSleeve
+	case strings.Contains(l, "inseam") || strings.Contains(l, "inside leg"):
+		return MeasureInseam
+	case strings.Contains(l, "length"):
+		return MeasureLength
+	}
+	return ""
+}
+
+// ToCM converts value in unit ("cm", "in", "Inches", ...) to centimetres.
+// Unknown units are assumed to already be cm.
+func ToCM(value float64, unit string) float64 {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "in", "inch", "inches", "\"":
+		return value * 2.54
+	case "mm":
+		return value / 10
+	}
+	return value
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Size recommendation confidence levels.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// garmentEase is how much larger a garment's flat measurement runs than the
+// body it fits, used to read garment charts as body charts.
+var garmentEase = map[string]float64{
+	MeasureChest: 10,
+	MeasureWaist: 4,
+	MeasureHips:  6,
+}
+
+// FitDelta compares one body measurement with the recommended size.
+// Delta is body minus the nearest bound of the size's range, so positive
+// means the size is tight and negative means it is loose.
+type FitDelta struct {
+	Measurement string    `json:"measurement"`
+	BodyCM      float64   `json:"body_cm"`
+	SizeCM      SizeRange `json:"size_cm"`
+	DeltaCM     float64   `json:"delta_cm"`
+	Fit         string    `json:"fit"`     // "tight", "loose" or "fits"
+	Message     string    `json:"message"` // e.g. "chest +2cm tight"
+}
+
+// SizeRecommendation is the best size on a chart for a set of body
+// measurements.
+type SizeRecommendation struct {
+	Size        string     `json:"recommended_size"`
+	Fit         []FitDelta `json:"fit"`
+	Confidence  string     `json:"confidence"`
+	ChartKind   string     `json:"chart_kind"`
+	ChartSource string     `json:"chart_source"`
+}
+
+// BodyMeasurementsCM returns the person's known measurements in cm, keyed
+// by Measure* name. Unset (zero) measurements are left out.
+func (p *Person) BodyMeasurementsCM() map[string]float64 {
+	body := make(map[string]float64)
+	for name, v := range map[string]float64{MeasureChest: p.Chest, MeasureWaist: p.Waist, MeasureHips: p.Hips} {
+		if v > 0 {
+			body[name] = v
+		}
+	}
+	return body
+}
+
+// primaryMeasurement is the measurement that decides the size for a slot.
+func primaryMeasurement(slot string) string {
+	if slot == SlotBottom {
+		return MeasureWaist
+	}
+	return MeasureChest
+}
+
+// RecommendSize picks the size on chart that best fits body (cm, keyed by
+// Measure* name). Each size is scored by how far the body falls outside
+// its ranges, with the slot's primary measurement weighted double and
+// tight misses counting more than loose ones. Sizes marked unavailable are
+// only considered when nothing else is. Returns nil when the chart and
+// body share no measurements.
+func RecommendSize(chart *SizeChart, body map[string]float64, slot string) *SizeRecommendation {
+	if chart == nil || len(chart.Sizes) == 0 || len(body) == 0 {
+		return nil
+	}
+	primary := primaryMeasurement(slot)
+
+	candidates := make([]SizeChartEntry, 0, len(chart.Sizes))
+	for _, entry := range chart.Sizes {
+		if entry.Available == nil || *entry.Available {
+			candidates = append(candidates, entry)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = chart.Sizes
+	}
+
+	var best *SizeRecommendation
+	bestScore := math.Inf(1)
+	for _, entry := range candidates {
+		var fit []FitDelta
+		score := 0.0
+		for _, name := range []string{MeasureChest, MeasureWaist, MeasureHips} {
+			bodyCM, ok := body[name]
+			if !ok {
+				continue
+			}
+			rng, ok := entry.Measurements[name]
+			if !ok {
+				continue
+			}
+			if chart.Kind == SizeChartGarment {
+				rng = SizeRange{Min: rng.Min - garmentEase[name], Max: rng.Max - garmentEase[name]}
+			}
+			d := fitDelta(name, bodyCM, rng)
+			fit = append(fit, d)
+
+			weight := 1.0
+			if name == primary {
+				weight = 2
+			}
+			if d.DeltaCM > 0 {
+				weight *= 1.5
+			}
+			score += weight * math.Abs(d.DeltaCM)
+		}
+		if len(fit) == 0 {
+			continue
+		}
+		// More matched measurements beat fewer at equal score.
+		score -= 0.01 * float64(len(fit))
+		if score < bestScore {
+			bestScore = score
+			best = &SizeRecommendation{Size: entry.Label, Fit: fit, ChartKind: chart.Kind, ChartSource: chart.Source}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.Confidence = sizeConfidence(chart, best.Fit, primary)
+	return best
+}
+
+func fitDelta(name string, bodyCM float64, rng SizeRange) FitDelta {
+	d := FitDelta{Measurement: name, BodyCM: round1(bodyCM), SizeCM: SizeRange{Min: round1(rng.Min), Max: round1(rng.Max)}, Fit: "fits"}
+	switch {
+	case bodyCM > rng.Max:
+		d.DeltaCM, d.Fit = round1(bodyCM-rng.Max), "tight"
+	case bodyCM < rng.Min:
+		d.DeltaCM, d.Fit = round1(bodyCM-rng.Min), "loose"
+	}
+	if d.Fit == "fits" {
+		d.Message = name + " fits"
+	} else {
+		d.Message = fmt.Sprintf("%s %+.0fcm %s", name, d.DeltaCM, d.Fit)
+	}
+	return d
+}
+
+// sizeConfidence starts from how trustworthy the chart is (a store body
+// chart beats a garment chart or brand default, which beat the generic
+// default) and drops a level when the slot's primary measurement wasn't
+// compared or the best size still misses by more than 4cm.
+func sizeConfidence(chart *SizeChart, fit []FitDelta, primary string) string {
+	level := 3
+	switch {
+	case chart.Source == SizeChartSourceDefault:
+		level = 1
+	case chart.Source == SizeChartSourceBrandDefault || chart.Kind == SizeChartGarment:
+		level = 2
+	}
+
+	hasPrimary := false
+	worst := 0.0
+	for _, d := range fit {
+		if d.Measurement == primary {
+			hasPrimary = true
+		}
+		worst = math.Max(worst, math.Abs(d.DeltaCM))
+	}
+	if !hasPrimary {
+		level--
+	}
+	if worst > 4 {
+		level--
+	}
+
+	switch {
+	case level >= 3:
+		return ConfidenceHigh
+	case level == 2:
+		return ConfidenceMedium
+	}
+	return ConfidenceLow
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
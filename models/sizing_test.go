@@ -0,0 +1,205 @@
+package models
+
+import "testing"
+
+// testChart builds a chart of kind from source out of rows.
+func testChart(kind, source string, rows ...sizeRow) *SizeChart {
+	chart := &SizeChart{Kind: kind, Source: source}
+	for _, r := range rows {
+		chart.Sizes = append(chart.Sizes, SizeChartEntry{Label: r.label, Measurements: r.cm})
+	}
+	return chart
+}
+
+func chest(min, max float64) map[string]SizeRange {
+	return map[string]SizeRange{MeasureChest: cmRange(min, max)}
+}
+
+func TestRecommendSize(t *testing.T) {
+	storeBody := func(rows ...sizeRow) *SizeChart { return testChart(SizeChartBody, "myntra", rows...) }
+	smallMediumLarge := []sizeRow{{"S", chest(86, 94)}, {"M", chest(94, 102)}, {"L", chest(102, 110)}}
+	unavailable := func(chart *SizeChart, labels ...string) *SizeChart {
+		no := false
+		for i := range chart.Sizes {
+			for _, l := range labels {
+				if chart.Sizes[i].Label == l {
+					chart.Sizes[i].Available = &no
+				}
+			}
+		}
+		return chart
+	}
+	chestAndWaist := storeBody(
+		sizeRow{"S", map[string]SizeRange{MeasureChest: cmRange(86, 94), MeasureWaist: cmRange(76, 84)}},
+		sizeRow{"M", map[string]SizeRange{MeasureChest: cmRange(94, 102), MeasureWaist: cmRange(84, 92)}},
+	)
+
+	tests := []struct {
+		name           string
+		chart          *SizeChart
+		body           map[string]float64
+		slot           string
+		wantSize       string // "" for no recommendation
+		wantConfidence string
+		wantMessage    string // first fit message, when set
+	}{
+		{
+			name:           "fits a store body chart",
+			chart:          storeBody(smallMediumLarge...),
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceHigh,
+			wantMessage:    "chest fits",
+		},
+		{
+			name:           "loose beats equally tight",
+			chart:          storeBody(sizeRow{"S", chest(86, 94)}, sizeRow{"M", chest(96, 104)}),
+			body:           map[string]float64{MeasureChest: 95},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceHigh,
+			wantMessage:    "chest -1cm loose",
+		},
+		{
+			name:           "unavailable sizes are skipped",
+			chart:          unavailable(storeBody(smallMediumLarge...), "M"),
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotTop,
+			wantSize:       "L",
+			wantConfidence: ConfidenceHigh,
+			wantMessage:    "chest -4cm loose",
+		},
+		{
+			name:           "all unavailable still recommends",
+			chart:          unavailable(storeBody(smallMediumLarge...), "S", "M", "L"),
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceHigh,
+		},
+		{
+			name:           "garment chart is read with ease",
+			chart:          testChart(SizeChartGarment, "myntra", sizeRow{"M", chest(104, 112)}, sizeRow{"L", chest(112, 120)}),
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceMedium,
+		},
+		{
+			name:           "big miss lowers confidence",
+			chart:          storeBody(smallMediumLarge...),
+			body:           map[string]float64{MeasureChest: 130},
+			slot:           SlotTop,
+			wantSize:       "L",
+			wantConfidence: ConfidenceMedium,
+			wantMessage:    "chest +20cm tight",
+		},
+		{
+			name:           "generic default chart",
+			chart:          testChart(SizeChartBody, SizeChartSourceDefault, smallMediumLarge...),
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceLow,
+		},
+		{
+			name:           "chest decides a top",
+			chart:          chestAndWaist,
+			body:           map[string]float64{MeasureChest: 98, MeasureWaist: 80},
+			slot:           SlotTop,
+			wantSize:       "M",
+			wantConfidence: ConfidenceHigh,
+		},
+		{
+			name:           "waist decides a bottom",
+			chart:          chestAndWaist,
+			body:           map[string]float64{MeasureChest: 98, MeasureWaist: 80},
+			slot:           SlotBottom,
+			wantSize:       "S",
+			wantConfidence: ConfidenceHigh,
+		},
+		{
+			name:           "missing primary measurement lowers confidence",
+			chart:          chestAndWaist,
+			body:           map[string]float64{MeasureChest: 98},
+			slot:           SlotBottom,
+			wantSize:       "M",
+			wantConfidence: ConfidenceMedium,
+		},
+		{
+			name:  "no shared measurements",
+			chart: storeBody(smallMediumLarge...),
+			body:  map[string]float64{MeasureHips: 100},
+			slot:  SlotTop,
+		},
+		{
+			name:  "no body measurements",
+			chart: storeBody(smallMediumLarge...),
+			body:  map[string]float64{},
+			slot:  SlotTop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := RecommendSize(tt.chart, tt.body, tt.slot)
+			if tt.wantSize == "" {
+				if rec != nil {
+					t.Fatalf("recommended %q, want none", rec.Size)
+				}
+				return
+			}
+			if rec == nil {
+				t.Fatalf("no recommendation, want %q", tt.wantSize)
+			}
+			if rec.Size != tt.wantSize || rec.Confidence != tt.wantConfidence {
+				t.Errorf("got %s (%s), want %s (%s); fit %+v", rec.Size, rec.Confidence, tt.wantSize, tt.wantConfidence, rec.Fit)
+			}
+			if tt.wantMessage != "" && (len(rec.Fit) == 0 || rec.Fit[0].Message != tt.wantMessage) {
+				t.Errorf("fit = %+v, want message %q", rec.Fit, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDefaultSizeChart(t *testing.T) {
+	tests := []struct {
+		name       string
+		brand      string
+		slot       string
+		gender     string
+		wantSource string
+		wantFirst  string // first size label
+	}{
+		{name: "men's top", slot: SlotTop, gender: "Male", wantSource: SizeChartSourceDefault, wantFirst: "XS"},
+		{name: "brand shirt", brand: " Van Heusen ", slot: SlotTop, gender: "male", wantSource: SizeChartSourceBrandDefault, wantFirst: "38"},
+		{name: "brand chart is for men", brand: "Allen Solly", slot: SlotTop, gender: "Women", wantSource: SizeChartSourceDefault, wantFirst: "XS"},
+		{name: "footwear isn't sized", slot: SlotFootwear, gender: "female"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := DefaultSizeChart(tt.brand, tt.slot, tt.gender)
+			if tt.wantSource == "" {
+				if chart != nil {
+					t.Fatalf("chart = %+v, want none", chart)
+				}
+				return
+			}
+			if chart == nil || len(chart.Sizes) == 0 {
+				t.Fatal("no chart")
+			}
+			if chart.Source != tt.wantSource || chart.Sizes[0].Label != tt.wantFirst {
+				t.Errorf("chart %s starting at %s, want %s starting at %s", chart.Source, chart.Sizes[0].Label, tt.wantSource, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestShirtChartIsContiguous(t *testing.T) {
+	for i := 1; i < len(abfrlShirtChart); i++ {
+		prev, cur := abfrlShirtChart[i-1], abfrlShirtChart[i]
+		if prev.cm[MeasureChest].Max != cur.cm[MeasureChest].Min {
+			t.Errorf("%s ends at %v but %s starts at %v", prev.label, prev.cm[MeasureChest].Max, cur.label, cur.cm[MeasureChest].Min)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subscription statuses, normalised across payment providers.
+const (
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due" // renewal failed; the plan is kept while the provider retries
+	SubscriptionPaused   = "paused"   // paused or halted at the provider; no plan until it resumes
+	SubscriptionCanceled = "canceled"
+)
+
+// Subscription is a paid plan at a payment provider, kept in sync by its
+// webhooks. One document per (provider, provider_subscription_id).
+type Subscription struct {
+	ID                     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID                 string             `bson:"user_id" json:"user_id"`
+	Provider               string             `bson:"provider" json:"provider"`
+	ProviderSubscriptionID string             `bson:"provider_subscription_id" json:"provider_subscription_id"`
+	Plan                   string             `bson:"plan" json:"plan"`
+	Status                 string             `bson:"status" json:"status"`
+	CurrentPeriodEnd       *time.Time         `bson:"current_period_end,omitempty" json:"current_period_end,omitempty"`
+	// CancelAtPeriodEnd means the plan stays until CurrentPeriodEnd and
+	// won't renew
+	CancelAtPeriodEnd bool       `bson:"cancel_at_period_end" json:"cancel_at_period_end"`
+	CanceledAt        *time.Time `bson:"canceled_at,omitempty" json:"canceled_at,omitempty"`
+	// LastEventAt is when the provider created the newest event applied,
+	// so older ones delivered late are skipped
+	LastEventAt *time.Time `bson:"last_event_at,omitempty" json:"-"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// GrantsPlan reports whether the subscription currently entitles its user
+// to Plan. A subscription cancelled at period end stays active until the
+// provider reports it cancelled.
+func (s *Subscription) GrantsPlan() bool {
+	return s.Status == SubscriptionActive || s.Status == SubscriptionPastDue
+}
+
+// PlanChange is an audit entry for a change of User.Plan.
+type PlanChange struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID         string             `bson:"user_id" json:"user_id"`
+	From           string             `bson:"from" json:"from"`
+	To             string             `bson:"to" json:"to"`
+	Reason         string             `bson:"reason" json:"reason"` // e.g. the webhook event type
+	Provider       string             `bson:"provider,omitempty" json:"provider,omitempty"`
+	SubscriptionID string             `bson:"subscription_id,omitempty" json:"subscription_id,omitempty"`
+	EventID        string             `bson:"event_id,omitempty" json:"event_id,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// BillingEventRecord marks a provider webhook event as handled, so
+// redeliveries are ignored. Unique on (provider, event_id).
+type BillingEventRecord struct {
+	Provider  string    `bson:"provider"`
+	EventID   string    `bson:"event_id"`
+	Type      string    `bson:"type"`
+	UserID    string    `bson:"user_id,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
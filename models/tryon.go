@@ -13,6 +13,11 @@ type TryOnPerson struct {
 	BottomID    string `bson:"bottom_id,omitempty" json:"bottom_id,omitempty"`
 	AccessoryID string `bson:"accessory_id,omitempty" json:"accessory_id,omitempty"`
 	DressID     string `bson:"dress_id,omitempty" json:"dress_id,omitempty"`
+
+	// Person photo selection (see Person.TryOnPhotos)
+	ImageKey       string `bson:"image_key,omitempty" json:"image_key,omitempty"` // S3 key or presigned URL of one of the person's images
+	ImageIndex     *int   `bson:"image_index,omitempty" json:"image_index,omitempty"`
+	MultiReference bool   `bson:"multi_reference,omitempty" json:"multi_reference,omitempty"` // Also send a second photo of the person
 }
 
 // TryOn represents a virtual try-on session and result
@@ -30,12 +35,69 @@ type TryOn struct {
 	PersonImageURL  string `bson:"person_image_url,omitempty" json:"person_image_url,omitempty"`
 	ProductImageURL string `bson:"product_image_url,omitempty" json:"product_image_url,omitempty"`
 
-	GeneratedImageURL string    `bson:"generated_image_url" json:"generated_image_url"`
-	Status            string    `bson:"status" json:"status"`
-	CreatedAt         time.Time `bson:"created_at" json:"created_at"`
-	IsDeleted         bool      `bson:"is_deleted" json:"is_deleted"`
-	IsFavorite        bool      `bson:"is_favorite" json:"is_favorite"`
-	IsSaved           bool      `bson:"is_saved" json:"is_saved"`
-	Rating            int       `bson:"rating,omitempty" json:"rating,omitempty"`
-	Comment           string    `bson:"comment,omitempty" json:"comment,omitempty"`
+	GeneratedImageURL string     `bson:"generated_image_url" json:"generated_image_url"`
+	Status            string     `bson:"status" json:"status"` // see TryOnStatus*
+	Error             string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt         time.Time  `bson:"created_at" json:"created_at"`
+	StartedAt         *time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	CompletedAt       *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	IsDeleted         bool       `bson:"is_deleted" json:"is_deleted"`
+	IsFavorite        bool       `bson:"is_favorite" json:"is_favorite"`
+	IsSaved           bool       `bson:"is_saved" json:"is_saved"`
+	Rating            int        `bson:"rating,omitempty" json:"rating,omitempty"`
+	Comment           string     `bson:"comment,omitempty" json:"comment,omitempty"`
+
+	// Attempts are the image generation calls made for this try-on
+	Attempts []GenerationAttempt `bson:"attempts,omitempty" json:"attempts,omitempty"`
+
+	// Instance and BootID identify the process running the job
+	Instance string `bson:"instance,omitempty" json:"-"`
+	BootID   string `bson:"boot_id,omitempty" json:"-"`
+
+	// Credits are the credits the job took, refunded if a restart
+	// interrupts it
+	Credits *TryOnCredits `bson:"credits,omitempty" json:"-"`
+}
+
+// TryOnCredits is the credits taken for a try-on job: Units in total, and
+// per lot in Lots (Remaining is the units taken from the lot).
+type TryOnCredits struct {
+	Plan  string      `bson:"plan"`
+	Ref   string      `bson:"ref"`
+	Units int         `bson:"units"`
+	Lots  []CreditLot `bson:"lots"`
+}
+
+// Try-on statuses. A record is created pending when its job is queued and
+// only completed records have a generated image.
+const (
+	TryOnStatusPending   = "pending"
+	TryOnStatusRunning   = "running"
+	TryOnStatusFailed    = "failed"
+	TryOnStatusCompleted = "completed"
+)
+
+// IsFinished reports whether the try-on job has completed or failed.
+func (t *TryOn) IsFinished() bool {
+	return t.Status == TryOnStatusCompleted || t.Status == TryOnStatusFailed
+}
+
+// Generation attempt outcomes.
+const (
+	AttemptSucceeded   = "succeeded"
+	AttemptTransient   = "transient"    // 5xx, timeout: retried with backoff
+	AttemptQuota       = "quota"        // 429 / quota: next API key
+	AttemptBlocked     = "blocked"      // safety block: not retried
+	AttemptFailed      = "failed"       // other error: next model
+	AttemptCircuitOpen = "circuit_open" // model skipped, its breaker is open
+)
+
+// GenerationAttempt is one call to an image model.
+type GenerationAttempt struct {
+	Model      string    `bson:"model" json:"model"`
+	KeyIndex   int       `bson:"key_index" json:"key_index"` // position in the API key list, never the key
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+	Outcome    string    `bson:"outcome" json:"outcome"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
 }
@@ -11,6 +11,7 @@ type WardrobeItem struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID     string             `bson:"user_id" json:"user_id"`
 	Category   string             `bson:"category" json:"category"`
+	Slot       string             `bson:"slot,omitempty" json:"slot,omitempty"` // garment slot (models.GarmentSlots) the item can fill in a try-on
 	Images     []string           `bson:"images" json:"images"`
 	SourceURL  string             `bson:"source_url,omitempty" json:"source_url,omitempty"`
 	IsFavorite bool               `bson:"is_favorite" json:"is_favorite"`
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
+	"github.com/raushankrgupta/web-product-scraper/models"
 )
 
 // chromeUserDataDir is the Chromium profile directory used by this package.
@@ -22,6 +25,17 @@ const chromeUserDataDir = "/tmp/chrome-user-data-myntra"
 // FetchDocumentChromeDP fetches the URL using ChromeDP (headless Chromium)
 // and returns the parsed document.
 func (b *baseScraper) FetchDocumentChromeDP(url string) (*goquery.Document, error) {
+	doc, _, err := b.fetchChromeDP(url, nil)
+	return doc, err
+}
+
+// fetchChromeDP is FetchDocumentChromeDP plus the attempt record: the main
+// document's status and headers, the rendered HTML and, when the fetch
+// failed or the page is empty or rejected by validator (nil accepts any
+// page), a screenshot.
+func (b *baseScraper) fetchChromeDP(url string, validator func(*goquery.Document) bool) (*goquery.Document, models.ScrapeAttempt, error) {
+	attempt := models.ScrapeAttempt{Strategy: models.StrategyChromeDP, CapturedAt: time.Now()}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
@@ -74,20 +88,57 @@ func (b *baseScraper) FetchDocumentChromeDP(url string) (*goquery.Document, erro
 	}
 
 	if err := chromedp.Run(taskCtx, network.SetExtraHTTPHeaders(network.Headers(headers))); err != nil {
-		return nil, fmt.Errorf("chromedp header error: %w", err)
+		return nil, attempt, fmt.Errorf("chromedp header error: %w", err)
 	}
 
+	// Record the status/headers of the first document response. The
+	// listener runs on chromedp's event goroutine, hence the mutex.
+	var mu sync.Mutex
+	chromedp.ListenTarget(taskCtx, func(ev interface{}) {
+		e, ok := ev.(*network.EventResponseReceived)
+		if !ok || e.Type != network.ResourceTypeDocument {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if attempt.StatusCode != 0 {
+			return
+		}
+		header := http.Header{}
+		for k, v := range e.Response.Headers {
+			header.Set(k, fmt.Sprint(v))
+		}
+		attempt.RecordResponse(int(e.Response.Status), header)
+	})
+
 	var htmlContent string
+	var screenshot []byte
 	err := chromedp.Run(taskCtx,
+		network.Enable(),
 		chromedp.Navigate(url),
 		chromedp.WaitReady("body", chromedp.ByQuery),
 		chromedp.Sleep(time.Duration(5+rand.Float64()*5)*time.Second), // Random delay
 		chromedp.OuterHTML("html", &htmlContent),
 	)
+	var doc *goquery.Document
+	if err == nil {
+		doc, err = goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	}
+	// The screenshot is only a debugging artifact for failed attempts:
+	// take it while the page is still open, and separately so failing to
+	// capture it doesn't fail the fetch
+	if err != nil || strings.TrimSpace(doc.Text()) == "" || (validator != nil && !validator(doc)) {
+		if shotErr := chromedp.Run(taskCtx, chromedp.CaptureScreenshot(&screenshot)); shotErr != nil {
+			screenshot = nil
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	attempt.HTML = []byte(htmlContent)
+	attempt.Screenshot = screenshot
 
 	if err != nil {
-		return nil, fmt.Errorf("chromedp navigation error: %w", err)
+		return nil, attempt, fmt.Errorf("chromedp navigation error: %w", err)
 	}
-
-	return goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	return doc, attempt, nil
 }
@@ -27,6 +27,12 @@ func NewMyntraScraper() *MyntraScraper {
 	}
 }
 
+// SetTrace attaches a trace that every fetch attempt is recorded onto. It
+// satisfies scrapers.Traceable structurally.
+func (s *MyntraScraper) SetTrace(trace *models.ScrapeTrace) {
+	s.base.trace = trace
+}
+
 // CanScrape reports whether the given URL is a Myntra URL. This is also
 // used by the API layer to decide between this package and the generic
 // scrapers.GetScraper factory.
@@ -203,6 +209,13 @@ func populateFromMyxJSON(product *models.Product, jsonStr string) error {
 		product.Title = getString(pd, "title")
 	}
 
+	switch brand := pd["brand"].(type) {
+	case map[string]interface{}:
+		product.Brand = getString(brand, "name")
+	case string:
+		product.Brand = brand
+	}
+
 	product.MRP = formatPriceWithCurrency(extractPrice(pd["mrp"]))
 	product.DiscountedPrice = formatPriceWithCurrency(extractPrice(pd["price"]))
 
@@ -215,6 +228,9 @@ func populateFromMyxJSON(product *models.Product, jsonStr string) error {
 		product.Description = getString(pd, "description")
 	}
 
+	populateSpecifications(product, pd)
+	populateSizes(product, pd)
+
 	if media, ok := pd["media"].(map[string]interface{}); ok {
 		if albums, ok := media["albums"].([]interface{}); ok {
 			for _, album := range albums {
@@ -250,6 +266,124 @@ func populateFromMyxJSON(product *models.Product, jsonStr string) error {
 	return nil
 }
 
+// populateSpecifications keeps pdpData.articleAttributes (Fabric, Fit,
+// Neck, Sleeve Length, Length, ...) and fills Material / FitType from it.
+func populateSpecifications(product *models.Product, pd map[string]interface{}) {
+	attrs, ok := pd["articleAttributes"].(map[string]interface{})
+	if !ok || len(attrs) == 0 {
+		return
+	}
+	product.Specifications = make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		value := strings.TrimSpace(fmt.Sprintf("%v", v))
+		if v == nil || value == "" || strings.EqualFold(value, "NA") {
+			continue
+		}
+		product.Specifications[k] = value
+	}
+
+	for _, key := range []string{"Fabric", "Fabric Type", "Material"} {
+		if v := product.Specifications[key]; v != "" && product.Material == "" {
+			product.Material = v
+		}
+	}
+	if v := product.Specifications["Fit"]; v != "" && product.FitType == "" {
+		product.FitType = v
+	}
+}
+
+// numberRegex pulls the numbers out of measurement values like "40",
+// "40.5" or "38 - 40".
+var numberRegex = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// populateSizes turns pdpData.sizes into a size chart (per-size
+// measurements, converted to cm) and one Variant per size with its
+// availability. Myntra lists body measurements ("To Fit Chest") alongside
+// garment measurements; body ones are preferred since they compare
+// directly against a Person's measurements.
+func populateSizes(product *models.Product, pd map[string]interface{}) {
+	sizes, ok := pd["sizes"].([]interface{})
+	if !ok || len(sizes) == 0 {
+		return
+	}
+	color := getString(pd, "baseColour")
+
+	body := &models.SizeChart{Kind: models.SizeChartBody, Source: "myntra"}
+	garment := &models.SizeChart{Kind: models.SizeChartGarment, Source: "myntra"}
+
+	for _, sz := range sizes {
+		sizeMap, ok := sz.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		label := strings.TrimSpace(getString(sizeMap, "label"))
+		if label == "" {
+			continue
+		}
+		available, _ := sizeMap["available"].(bool)
+
+		skuID := ""
+		if v, ok := sizeMap["skuId"]; ok && v != nil {
+			skuID = fmt.Sprintf("%v", v)
+			if f, ok := v.(float64); ok {
+				skuID = fmt.Sprintf("%.0f", f)
+			}
+		}
+		product.Variants = append(product.Variants, models.Variant{
+			ASIN:      skuID,
+			Size:      label,
+			Color:     color,
+			Available: &available,
+		})
+
+		bodyEntry := models.SizeChartEntry{Label: label, Measurements: map[string]models.SizeRange{}, Available: &available}
+		garmentEntry := models.SizeChartEntry{Label: label, Measurements: map[string]models.SizeRange{}, Available: &available}
+
+		measurements, _ := sizeMap["measurements"].([]interface{})
+		for _, m := range measurements {
+			mm, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := models.CanonicalMeasurement(getString(mm, "name"))
+			if name == "" {
+				continue
+			}
+			nums := numberRegex.FindAllString(fmt.Sprintf("%v", mm["value"]), -1)
+			if len(nums) == 0 {
+				continue
+			}
+			unit := getString(mm, "unit")
+			var r models.SizeRange
+			fmt.Sscanf(nums[0], "%g", &r.Min)
+			r.Max = r.Min
+			if len(nums) > 1 {
+				fmt.Sscanf(nums[len(nums)-1], "%g", &r.Max)
+			}
+			r.Min, r.Max = models.ToCM(r.Min, unit), models.ToCM(r.Max, unit)
+
+			if strings.Contains(strings.ToLower(getString(mm, "type")), "body") {
+				bodyEntry.Measurements[name] = r
+			} else {
+				garmentEntry.Measurements[name] = r
+			}
+		}
+		if len(bodyEntry.Measurements) > 0 {
+			body.Sizes = append(body.Sizes, bodyEntry)
+		}
+		if len(garmentEntry.Measurements) > 0 {
+			garment.Sizes = append(garment.Sizes, garmentEntry)
+		}
+	}
+
+	switch {
+	case len(body.Sizes) > 0:
+		product.SizeChart = body
+	case len(garment.Sizes) > 0:
+		product.SizeChart = garment
+	}
+}
+
 func extractPrice(val interface{}) string {
 	switch v := val.(type) {
 	case nil:
@@ -18,8 +18,10 @@
 package myntra_scraper
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -28,6 +30,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
 )
 
 func hostOf(rawURL string) string {
@@ -92,6 +95,9 @@ func ScraperProxyRaw() string {
 // should use NewMyntraScraper().
 type baseScraper struct {
 	Client *http.Client
+
+	// trace, when set via MyntraScraper.SetTrace, receives every attempt.
+	trace *models.ScrapeTrace
 }
 
 func newBaseScraper() *baseScraper {
@@ -136,6 +142,22 @@ func inspectDoc(doc *goquery.Document) (int, string) {
 	return len(body), title
 }
 
+// bodySampleLen is how much of the page text bodySample keeps.
+const bodySampleLen = 300
+
+// bodySample returns a whitespace-collapsed prefix of the page's body text
+// for scrape traces.
+func bodySample(doc *goquery.Document) string {
+	if doc == nil {
+		return ""
+	}
+	sample := strings.Join(strings.Fields(doc.Find("body").Text()), " ")
+	if len(sample) > bodySampleLen {
+		sample = sample[:bodySampleLen]
+	}
+	return sample
+}
+
 // looksLikeIPBlock returns true if the document is one of the well-known
 // "you're blocked" / "site under maintenance" responses that origin servers
 // serve to suspected datacenter traffic. Detecting this short-circuits the
@@ -173,13 +195,22 @@ func looksLikeIPBlock(doc *goquery.Document) bool {
 // chain. Each strategy's output is run through the per-call validator
 // before being accepted, and well-known IP-block stubs short-circuit the
 // rest of the chain (it would just hit the same IP and the same stub).
+// Failures are returned as *models.ScrapeFailure carrying what each
+// strategy saw, so the API layer can persist artifacts for debugging.
 func (b *baseScraper) FetchDocument(rawURL string, validator func(*goquery.Document) bool) (*goquery.Document, error) {
 	host := hostOf(rawURL)
+	var attempts []models.ScrapeAttempt
+	fail := func(err error) error {
+		return &models.ScrapeFailure{Err: err, Attempts: attempts}
+	}
 
 	// Strategy 1: HTTP Client (Fastest)
-	doc, err := b.FetchDocumentHTTP(rawURL)
+	started := time.Now()
+	doc, attempt, err := b.fetchHTTP(rawURL)
+	valid := err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
 	if err == nil {
-		if validator(doc) {
+		if valid {
 			fmt.Printf("[MyntraScraper] HTTP Success: %s\n", rawURL)
 			return doc, nil
 		}
@@ -192,7 +223,7 @@ func (b *baseScraper) FetchDocument(rawURL string, validator func(*goquery.Docum
 		// stub. Short-circuit to save ~15s per request and surface an
 		// actionable error.
 		if looksLikeIPBlock(doc) && ScraperProxyURL() == nil {
-			return nil, fmt.Errorf("scrape blocked by %s (server returned %q in %d bytes) - the host is rejecting this server's IP as datacenter/bot traffic; configure SCRAPER_PROXY_URL (residential proxy or scraping service) to fix", host, titleText, bodyLen)
+			return nil, fail(fmt.Errorf("scrape blocked by %s (server returned %q in %d bytes) - the host is rejecting this server's IP as datacenter/bot traffic; configure SCRAPER_PROXY_URL (residential proxy or scraping service) to fix", host, titleText, bodyLen))
 		}
 	} else {
 		fmt.Printf("[MyntraScraper] HTTP Failed: %v\n", err)
@@ -200,16 +231,19 @@ func (b *baseScraper) FetchDocument(rawURL string, validator func(*goquery.Docum
 
 	// Strategy 2: ChromeDP (Headless)
 	fmt.Printf("[MyntraScraper] Trying ChromeDP: %s\n", rawURL)
-	doc, err = b.FetchDocumentChromeDP(rawURL)
+	started = time.Now()
+	doc, attempt, err = b.fetchChromeDP(rawURL, validator)
+	valid = err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
 	if err == nil {
-		if validator(doc) {
+		if valid {
 			fmt.Printf("[MyntraScraper] ChromeDP Success: %s\n", rawURL)
 			return doc, nil
 		}
 		bodyLen, titleText := inspectDoc(doc)
 		fmt.Printf("[MyntraScraper] ChromeDP yielded invalid content (validator failed) - bodyTextLen=%d title=%q url=%s\n", bodyLen, titleText, rawURL)
 		if looksLikeIPBlock(doc) && ScraperProxyURL() == nil {
-			return nil, fmt.Errorf("scrape blocked by %s (ChromeDP also returned %q) - the host is rejecting this server's IP; configure SCRAPER_PROXY_URL to fix", host, titleText)
+			return nil, fail(fmt.Errorf("scrape blocked by %s (ChromeDP also returned %q) - the host is rejecting this server's IP; configure SCRAPER_PROXY_URL to fix", host, titleText))
 		}
 	} else {
 		fmt.Printf("[MyntraScraper] ChromeDP Failed: %v\n", err)
@@ -217,29 +251,65 @@ func (b *baseScraper) FetchDocument(rawURL string, validator func(*goquery.Docum
 
 	// Strategy 3: Selenium (Full Browser)
 	fmt.Printf("[MyntraScraper] Trying Selenium: %s\n", rawURL)
-	doc, err = b.FetchDocumentSelenium(rawURL)
+	started = time.Now()
+	doc, attempt, err = b.fetchSelenium(rawURL)
+	valid = err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
 	if err == nil {
-		if validator(doc) {
+		if valid {
 			fmt.Printf("[MyntraScraper] Selenium Success: %s\n", rawURL)
 			return doc, nil
 		}
 		bodyLen, titleText := inspectDoc(doc)
 		fmt.Printf("[MyntraScraper] Selenium yielded invalid content (validator failed) - bodyTextLen=%d title=%q url=%s\n", bodyLen, titleText, rawURL)
 		if looksLikeIPBlock(doc) {
-			return nil, fmt.Errorf("scrape blocked by %s across all strategies (last seen: %q) - configure or rotate SCRAPER_PROXY_URL", host, titleText)
+			return nil, fail(fmt.Errorf("scrape blocked by %s across all strategies (last seen: %q) - configure or rotate SCRAPER_PROXY_URL", host, titleText))
 		}
 	} else {
 		fmt.Printf("[MyntraScraper] Selenium Failed: %v\n", err)
 	}
 
-	return nil, fmt.Errorf("all strategies failed for %s", rawURL)
+	return nil, fail(fmt.Errorf("all strategies failed for %s", rawURL))
+}
+
+// recordAttempt fills in the diagnostic fields of a finished attempt, copies
+// it onto the trace (if any) and, when it failed, appends it to attempts.
+func (b *baseScraper) recordAttempt(attempts []models.ScrapeAttempt, attempt models.ScrapeAttempt, started time.Time, doc *goquery.Document, err error, valid bool) []models.ScrapeAttempt {
+	attempt.DurationMS = time.Since(started).Milliseconds()
+	attempt.ValidatorPassed = valid
+	attempt.BodyTextLen, attempt.Title = inspectDoc(doc)
+	attempt.BodySample = bodySample(doc)
+	attempt.Blocked = looksLikeIPBlock(doc)
+	switch {
+	case err != nil:
+		attempt.Error = err.Error()
+	case !valid:
+		attempt.Error = "validator failed"
+	}
+
+	if b.trace != nil {
+		b.trace.Attempts = append(b.trace.Attempts, attempt)
+	}
+	if valid {
+		return attempts
+	}
+	return append(attempts, attempt)
 }
 
 // FetchDocumentHTTP fetches the URL via the standard HTTP client (Strategy 1).
 func (b *baseScraper) FetchDocumentHTTP(url string) (*goquery.Document, error) {
+	doc, _, err := b.fetchHTTP(url)
+	return doc, err
+}
+
+// fetchHTTP is FetchDocumentHTTP plus the attempt record. The body is read in
+// full before the status check so block pages (403 / 503) are still captured.
+func (b *baseScraper) fetchHTTP(url string) (*goquery.Document, models.ScrapeAttempt, error) {
+	attempt := models.ScrapeAttempt{Strategy: models.StrategyHTTP, CapturedAt: time.Now()}
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 
 	// Common headers to mimic a real browser
@@ -266,18 +336,25 @@ func (b *baseScraper) FetchDocumentHTTP(url string) (*goquery.Document, error) {
 
 	res, err := b.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 	defer res.Body.Close()
 
+	attempt.RecordResponse(res.StatusCode, res.Header)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, attempt, err
+	}
+	attempt.HTML = body
+
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+		return nil, attempt, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
 	}
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 
-	return doc, nil
+	return doc, attempt, nil
 }
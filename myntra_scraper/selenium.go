@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/tebeka/selenium"
 	"github.com/tebeka/selenium/chrome"
 )
@@ -27,11 +28,20 @@ const (
 // package's port manager, spawns ChromeDriver on it, and tears it down
 // when the request completes.
 func (b *baseScraper) FetchDocumentSelenium(url string) (*goquery.Document, error) {
+	doc, _, err := b.fetchSelenium(url)
+	return doc, err
+}
+
+// fetchSelenium is FetchDocumentSelenium plus the attempt record (HTML only;
+// WebDriver exposes no status code or headers).
+func (b *baseScraper) fetchSelenium(url string) (*goquery.Document, models.ScrapeAttempt, error) {
+	attempt := models.ScrapeAttempt{Strategy: models.StrategySelenium, CapturedAt: time.Now()}
+
 	initPortManager(seleniumBasePort, seleniumPortRange)
 
 	port, err := globalPortManager.GetPort()
 	if err != nil {
-		return nil, fmt.Errorf("port error: %w", err)
+		return nil, attempt, fmt.Errorf("port error: %w", err)
 	}
 	defer globalPortManager.ReleasePort(port)
 
@@ -44,7 +54,7 @@ func (b *baseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 
 	service, err := selenium.NewChromeDriverService(driverPath, port, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("error starting Chrome driver service: %v", err)
+		return nil, attempt, fmt.Errorf("error starting Chrome driver service: %v", err)
 	}
 	defer service.Stop()
 
@@ -85,7 +95,7 @@ func (b *baseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 
 	driver, err := selenium.NewRemote(caps, fmt.Sprintf("http://localhost:%d/wd/hub", port))
 	if err != nil {
-		return nil, fmt.Errorf("error creating WebDriver: %v", err)
+		return nil, attempt, fmt.Errorf("error creating WebDriver: %v", err)
 	}
 	defer driver.Quit()
 
@@ -100,7 +110,7 @@ func (b *baseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 	driver.SetPageLoadTimeout(60 * time.Second)
 
 	if err := driver.Get(url); err != nil {
-		return nil, fmt.Errorf("navigation error: %w", err)
+		return nil, attempt, fmt.Errorf("navigation error: %w", err)
 	}
 
 	driver.ExecuteScript(maskScript, nil)
@@ -117,8 +127,11 @@ func (b *baseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 
 	html, err := driver.PageSource()
 	if err != nil {
-		return nil, fmt.Errorf("page source error: %w", err)
+		return nil, attempt, fmt.Errorf("page source error: %w", err)
 	}
 
-	return goquery.NewDocumentFromReader(strings.NewReader(html))
+	attempt.HTML = []byte(html)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	return doc, attempt, err
 }
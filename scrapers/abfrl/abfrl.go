@@ -0,0 +1,370 @@
+// Package abfrl scrapes the Aditya Birla Fashion & Retail storefronts
+// (Peter England, Allen Solly, Van Heusen, Louis Philippe). They run on one
+// shared platform, so a single scraper handles all of them, with each brand
+// described by a Brand entry.
+package abfrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers/base"
+)
+
+// Selectors are the CSS selectors of an ABFRL storefront. The brands share
+// one platform, so they share pageSelectors.
+type Selectors struct {
+	Title       []string
+	Price       []string
+	MRP         []string
+	Description []string
+	Gallery     []string // img elements of the product gallery
+	ColorLinks  string   // a elements linking to sibling colours
+	SizeOptions string   // one element per size
+}
+
+var pageSelectors = Selectors{
+	Title:       []string{"h1.pdp-title", ".ProductDetails__productName"},
+	Price:       []string{".pdp-price strong", ".ProductDetails__price"},
+	MRP:         []string{".pdp-mrp del", ".ProductDetails__mrp"},
+	Description: []string{".pdp-desc", ".ProductDetails__description"},
+	Gallery:     []string{".Start-image-gallery img", ".slick-track img"},
+	ColorLinks:  ".pdp-color-list a, .color-swatches a",
+	SizeOptions: ".pdp-size-list li, .size-list li, .pdp-sizes button",
+}
+
+// Brand is the per-domain configuration of one storefront.
+type Brand struct {
+	Name    string
+	Domains []string // host substrings this brand is served from
+}
+
+// Brands lists every supported storefront.
+var Brands = []Brand{
+	{Name: "Peter England", Domains: []string{"peterengland.abfrl.in", "peterengland.com", "peterengland"}},
+	{Name: "Allen Solly", Domains: []string{"allensolly.abfrl.in", "allensolly.com"}},
+	{Name: "Van Heusen", Domains: []string{"vanheusenindia.abfrl.in", "vanheusenindia.com", "vanheusen.abfrl.in"}},
+	{Name: "Louis Philippe", Domains: []string{"louisphilippe.abfrl.in", "louisphilippe.com"}},
+}
+
+// IsBrandURL reports whether url belongs to any of Brands.
+func IsBrandURL(url string) bool {
+	return brandFor(url) != nil
+}
+
+func brandFor(url string) *Brand {
+	u := strings.ToLower(url)
+	for i := range Brands {
+		for _, d := range Brands[i].Domains {
+			if strings.Contains(u, d) {
+				return &Brands[i]
+			}
+		}
+	}
+	return nil
+}
+
+type ABFRLScraper struct {
+	*base.BaseScraper
+}
+
+func NewABFRLScraper() *ABFRLScraper {
+	return &ABFRLScraper{
+		BaseScraper: base.NewBaseScraper(),
+	}
+}
+
+func (s *ABFRLScraper) CanScrape(url string) bool {
+	return IsBrandURL(url)
+}
+
+func (s *ABFRLScraper) ScrapeProduct(url string) (*models.Product, error) {
+	brand := brandFor(url)
+	if brand == nil {
+		return nil, fmt.Errorf("no ABFRL brand configured for %s", url)
+	}
+	sel := pageSelectors
+
+	doc, err := s.FetchDocument(url, func(doc *goquery.Document) bool {
+		for _, t := range sel.Title {
+			if doc.Find(t).Length() > 0 {
+				return true
+			}
+		}
+		return findLDProduct(doc) != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	product := &models.Product{Brand: brand.Name}
+
+	// 1. Title
+	product.Title = base.FirstText(doc, sel.Title...)
+	if product.Title == "" {
+		// Fallback to page title "Name Online - ID | Brand"
+		pageTitle := doc.Find("title").Text()
+		if parts := strings.Split(pageTitle, " Online -"); len(parts) > 1 {
+			product.Title = strings.TrimSpace(parts[0])
+		}
+	}
+
+	// 2. Price
+	product.DiscountedPrice = base.FirstText(doc, sel.Price...)
+	product.MRP = base.FirstText(doc, sel.MRP...)
+
+	// 3. Description
+	product.Description = base.FirstText(doc, sel.Description...)
+
+	// 4. Images
+	for _, g := range sel.Gallery {
+		doc.Find(g).Each(func(i int, img *goquery.Selection) {
+			src := img.AttrOr("src", img.AttrOr("data-src", ""))
+			if src != "" {
+				product.Images = base.AppendUnique(product.Images, base.AbsoluteURL(src))
+			}
+		})
+		if len(product.Images) > 0 {
+			break
+		}
+	}
+
+	// 5. Structured data fills the gaps and carries the variants
+	if ld := findLDProduct(doc); ld != nil {
+		populateFromLD(product, ld)
+	}
+
+	// 6. DOM variants when the structured data had none
+	if len(product.Variants) == 0 {
+		populateVariantsFromDOM(product, doc, sel)
+	}
+
+	return product, nil
+}
+
+// populateVariantsFromDOM reads the size buttons (disabled / out-of-stock
+// classes mark unavailable sizes) and the sibling colour swatches.
+func populateVariantsFromDOM(product *models.Product, doc *goquery.Document, sel Selectors) {
+	currentColor := ""
+	doc.Find(sel.ColorLinks).Each(func(i int, a *goquery.Selection) {
+		color := strings.TrimSpace(a.AttrOr("title", a.AttrOr("aria-label", a.Text())))
+		if color == "" {
+			return
+		}
+		if a.HasClass("active") || a.HasClass("selected") || a.AttrOr("aria-current", "") == "true" {
+			currentColor = color
+			return
+		}
+		product.Variants = append(product.Variants, models.Variant{
+			ASIN:  skuFromHref(a.AttrOr("href", "")),
+			Color: color,
+		})
+	})
+
+	doc.Find(sel.SizeOptions).Each(func(i int, el *goquery.Selection) {
+		size := strings.TrimSpace(el.Text())
+		if size == "" {
+			return
+		}
+		_, disabled := el.Attr("disabled")
+		class := strings.ToLower(el.AttrOr("class", ""))
+		available := !disabled && !strings.Contains(class, "disabled") && !strings.Contains(class, "out-of-stock") && !strings.Contains(class, "oos")
+		product.Variants = append(product.Variants, models.Variant{
+			Size:      size,
+			Color:     currentColor,
+			Images:    product.Images,
+			Available: &available,
+		})
+		if product.CurrentSelection == nil && (strings.Contains(class, "active") || strings.Contains(class, "selected")) {
+			current := product.Variants[len(product.Variants)-1]
+			product.CurrentSelection = &current
+		}
+	})
+}
+
+// findLDProduct returns the schema.org Product / ProductGroup from the
+// page's JSON-LD, or nil.
+func findLDProduct(doc *goquery.Document) map[string]interface{} {
+	var found map[string]interface{}
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true
+		}
+		found = ldProduct(data)
+		return found == nil
+	})
+	return found
+}
+
+func ldProduct(node interface{}) map[string]interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if t := ldType(v); t == "Product" || t == "ProductGroup" {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return ldProduct(graph)
+		}
+	case []interface{}:
+		for _, child := range v {
+			if p := ldProduct(child); p != nil {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// populateFromLD fills empty fields and builds variants from JSON-LD. A
+// ProductGroup lists its variants in hasVariant; a plain Product may list
+// one offer per size.
+func populateFromLD(product *models.Product, ld map[string]interface{}) {
+	if product.Title == "" {
+		product.Title = strings.TrimSpace(base.StringAt(ld, "name"))
+	}
+	if product.Description == "" {
+		product.Description = strings.TrimSpace(base.StringAt(ld, "description"))
+	}
+	if len(product.Images) == 0 {
+		product.Images = base.AppendUnique(product.Images, ldImages(ld)...)
+	}
+	if product.Material == "" {
+		product.Material = strings.TrimSpace(base.StringAt(ld, "material"))
+	}
+
+	offers := ldOffers(ld)
+	if product.DiscountedPrice == "" && len(offers) > 0 {
+		if price := ldPrice(offers[0]); price != "" {
+			product.DiscountedPrice = "₹" + price
+		}
+	}
+
+	color := strings.TrimSpace(base.StringAt(ld, "color"))
+
+	if variants, ok := ld["hasVariant"].([]interface{}); ok {
+		for _, v := range variants {
+			vm, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			variant := models.Variant{
+				ASIN:   base.StringAt(vm, "sku"),
+				Size:   strings.TrimSpace(base.StringAt(vm, "size")),
+				Color:  strings.TrimSpace(base.StringAt(vm, "color")),
+				Images: ldImages(vm),
+			}
+			if vo := ldOffers(vm); len(vo) > 0 {
+				variant.Available = ldAvailability(vo[0])
+			}
+			product.Variants = append(product.Variants, variant)
+		}
+		return
+	}
+
+	// One offer per size
+	for _, o := range offers {
+		size := strings.TrimSpace(base.StringAt(o, "size"))
+		if size == "" {
+			if item, ok := o["itemOffered"].(map[string]interface{}); ok {
+				size = strings.TrimSpace(base.StringAt(item, "size"))
+			}
+		}
+		if size == "" {
+			continue
+		}
+		product.Variants = append(product.Variants, models.Variant{
+			ASIN:      base.StringAt(o, "sku"),
+			Size:      size,
+			Color:     color,
+			Images:    product.Images,
+			Available: ldAvailability(o),
+		})
+	}
+}
+
+func ldType(m map[string]interface{}) string {
+	switch t := m["@type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && (s == "Product" || s == "ProductGroup") {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func ldImages(m map[string]interface{}) []string {
+	var images []string
+	switch v := m["image"].(type) {
+	case string:
+		images = append(images, base.AbsoluteURL(v))
+	case []interface{}:
+		for _, img := range v {
+			switch iv := img.(type) {
+			case string:
+				images = append(images, base.AbsoluteURL(iv))
+			case map[string]interface{}:
+				images = append(images, base.AbsoluteURL(base.StringAt(iv, "url")))
+			}
+		}
+	}
+	return base.AppendUnique(nil, images...)
+}
+
+func ldOffers(m map[string]interface{}) []map[string]interface{} {
+	var offers []map[string]interface{}
+	switch v := m["offers"].(type) {
+	case map[string]interface{}:
+		if inner, ok := v["offers"].([]interface{}); ok { // AggregateOffer
+			for _, o := range inner {
+				if om, ok := o.(map[string]interface{}); ok {
+					offers = append(offers, om)
+				}
+			}
+		} else {
+			offers = append(offers, v)
+		}
+	case []interface{}:
+		for _, o := range v {
+			if om, ok := o.(map[string]interface{}); ok {
+				offers = append(offers, om)
+			}
+		}
+	}
+	return offers
+}
+
+func ldPrice(offer map[string]interface{}) string {
+	switch p := offer["price"].(type) {
+	case string:
+		return strings.TrimSpace(p)
+	case float64:
+		return fmt.Sprintf("%.0f", p)
+	}
+	return ""
+}
+
+// ldAvailability maps schema.org availability (".../InStock",
+// ".../OutOfStock") to a flag; nil when absent.
+func ldAvailability(offer map[string]interface{}) *bool {
+	a := base.StringAt(offer, "availability")
+	if a == "" {
+		return nil
+	}
+	available := strings.HasSuffix(a, "InStock") || strings.HasSuffix(a, "LimitedAvailability") || strings.HasSuffix(a, "PreOrder")
+	return &available
+}
+
+// skuFromHref takes the last path segment of a colour link as its ID.
+func skuFromHref(href string) string {
+	href = strings.SplitN(href, "?", 2)[0]
+	parts := strings.Split(strings.Trim(href, "/"), "/")
+	return parts[len(parts)-1]
+}
@@ -0,0 +1,216 @@
+package scrapers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+// vocabEntry maps store phrasings onto one canonical value.
+type vocabEntry struct {
+	value    string
+	synonyms []string
+}
+
+// Vocabularies are checked in order, so multi-word or more specific terms
+// ("navy blue", "floral print") come before the words they contain.
+var materialVocab = []vocabEntry{
+	{models.MaterialDenim, []string{"denim"}},
+	{models.MaterialCotton, []string{"cotton", "pure cotton", "organic cotton", "khadi"}},
+	{models.MaterialLinen, []string{"linen", "pure linen", "flax"}},
+	{models.MaterialPolyester, []string{"polyester", "poly", "recycled polyester"}},
+	{models.MaterialViscose, []string{"viscose", "rayon", "modal", "lyocell", "tencel"}},
+	{models.MaterialWool, []string{"wool", "woollen", "woolen", "merino", "cashmere", "acrylic wool"}},
+	{models.MaterialSilk, []string{"silk", "pure silk", "satin"}},
+	{models.MaterialNylon, []string{"nylon", "polyamide"}},
+	{models.MaterialLeather, []string{"leather", "genuine leather", "pu leather", "faux leather", "suede"}},
+}
+
+var fitVocab = []vocabEntry{
+	{models.FitSkinny, []string{"skinny", "skinny fit", "super skinny", "super slim"}},
+	{models.FitSlim, []string{"slim", "slim fit", "tailored", "tailored fit", "fitted", "muscle fit", "tapered", "tapered fit"}},
+	{models.FitOversized, []string{"oversized", "oversized fit", "boxy", "boxy fit", "baggy"}},
+	{models.FitRelaxed, []string{"relaxed", "relaxed fit", "loose", "loose fit", "comfort fit", "wide leg", "straight leg relaxed"}},
+	{models.FitRegular, []string{"regular", "regular fit", "classic fit", "straight", "straight fit", "standard fit"}},
+}
+
+var colorVocab = []vocabEntry{
+	{"multicolor", []string{"multicolor", "multicolour", "multi", "multi color", "multi colour", "assorted"}},
+	{"navy", []string{"navy", "navy blue", "dark blue", "indigo"}},
+	{"maroon", []string{"maroon", "burgundy", "wine", "oxblood"}},
+	{"olive", []string{"olive", "olive green", "khaki green"}},
+	{"beige", []string{"beige", "cream", "off white", "ivory", "khaki", "camel", "sand", "nude"}},
+	{"black", []string{"black", "jet black", "charcoal black"}},
+	{"white", []string{"white", "optic white", "snow white"}},
+	{"grey", []string{"grey", "gray", "charcoal", "melange", "ash", "silver"}},
+	{"blue", []string{"blue", "sky blue", "light blue", "teal blue", "turquoise", "aqua", "denim blue"}},
+	{"green", []string{"green", "teal", "mint", "sea green", "emerald", "bottle green"}},
+	{"red", []string{"red", "coral", "rust", "crimson"}},
+	{"pink", []string{"pink", "peach", "rose", "fuchsia", "magenta"}},
+	{"purple", []string{"purple", "lavender", "violet", "lilac", "mauve"}},
+	{"yellow", []string{"yellow", "mustard", "lemon"}},
+	{"orange", []string{"orange", "tangerine"}},
+	{"brown", []string{"brown", "tan", "coffee", "chocolate", "taupe"}},
+}
+
+var patternVocab = []vocabEntry{
+	{models.PatternFloral, []string{"floral", "floral print", "flower", "botanical"}},
+	{models.PatternStriped, []string{"striped", "stripes", "stripe", "pinstripe", "pinstriped"}},
+	{models.PatternChecked, []string{"checked", "checks", "checkered", "chequered", "plaid", "gingham", "tartan"}},
+	{models.PatternGraphic, []string{"graphic", "graphic print", "typography", "slogan", "logo print"}},
+	{models.PatternEmbroidered, []string{"embroidered", "embroidery", "chikankari"}},
+	{models.PatternColorblock, []string{"colorblocked", "colourblocked", "colorblock", "colourblock", "colour blocked", "color blocked"}},
+	{models.PatternPrinted, []string{"printed", "print", "prints", "abstract", "geometric", "polka", "polka dot", "tie dye", "camouflage", "camo", "paisley", "ethnic motifs"}},
+	{models.PatternSolid, []string{"solid", "plain", "self design", "textured", "solid color", "solid colour"}},
+}
+
+// Confidence levels by where a value was found.
+const (
+	confidenceExact       = 1.0 // the attribute field is exactly a vocabulary term
+	confidenceField       = 0.8 // a term found inside the attribute field
+	confidenceTitle       = 0.6 // inferred from the title
+	confidenceDescription = 0.4 // inferred from the description
+)
+
+// attributeSource is one piece of text a value may be found in, with the
+// confidence a match there deserves.
+type attributeSource struct {
+	text       string
+	confidence float64
+	field      bool // an exact whole-field match earns confidenceExact
+}
+
+// NormalizeAttributes maps the product's free-text attributes (Material,
+// FitType, variant colour, title, description) onto the canonical
+// vocabularies. Returns nil when nothing could be normalized.
+func NormalizeAttributes(product *models.Product) *models.ProductAttributes {
+	if product == nil {
+		return nil
+	}
+
+	color := ""
+	if product.CurrentSelection != nil {
+		color = product.CurrentSelection.Color
+	}
+
+	attrs := &models.ProductAttributes{
+		Material: normalizeMaterial(product),
+		Fit: normalizeAttribute(fitVocab,
+			attributeSource{product.FitType, confidenceField, true},
+			attributeSource{product.Title, confidenceTitle, false},
+			attributeSource{product.Description, confidenceDescription, false}),
+		Color: normalizeAttribute(colorVocab,
+			attributeSource{color, confidenceField, true},
+			attributeSource{product.Title, confidenceTitle, false}),
+		Pattern: normalizeAttribute(patternVocab,
+			attributeSource{specification(product, "Pattern", "Print or Pattern Type"), confidenceField, true},
+			attributeSource{product.Title, confidenceTitle, false},
+			attributeSource{product.Description, confidenceDescription, false}),
+	}
+	if attrs.IsEmpty() {
+		return nil
+	}
+	return attrs
+}
+
+// specification returns the first non-empty Specifications value among keys.
+func specification(product *models.Product, keys ...string) string {
+	for _, k := range keys {
+		if v := product.Specifications[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// materialPercent matches composition entries like "60% Cotton".
+var materialPercent = regexp.MustCompile(`(\d{1,3})\s*%\s*([A-Za-z][A-Za-z ]*)`)
+
+// normalizeMaterial handles compositions ("60% Cotton, 40% Polyester") and
+// blends before falling back to the plain vocabulary match.
+func normalizeMaterial(product *models.Product) *models.NormalizedAttribute {
+	raw := strings.TrimSpace(product.Material)
+	if raw != "" {
+		bestPct, bestValue := 0, ""
+		for _, m := range materialPercent.FindAllStringSubmatch(raw, -1) {
+			pct, _ := strconv.Atoi(m[1])
+			if value := matchVocab(materialVocab, m[2]); value != "" && pct > bestPct {
+				bestPct, bestValue = pct, value
+			}
+		}
+		switch {
+		case bestPct >= 100:
+			return &models.NormalizedAttribute{Value: bestValue, Confidence: confidenceExact, Raw: raw}
+		case bestPct >= 60:
+			return &models.NormalizedAttribute{Value: bestValue, Confidence: confidenceField, Raw: raw}
+		case bestPct > 0:
+			return &models.NormalizedAttribute{Value: models.MaterialBlend, Confidence: confidenceField, Raw: raw}
+		}
+
+		if strings.Contains(normalizeText(raw), " blend ") {
+			return &models.NormalizedAttribute{Value: models.MaterialBlend, Confidence: confidenceField, Raw: raw}
+		}
+	}
+
+	return normalizeAttribute(materialVocab,
+		attributeSource{raw, confidenceField, true},
+		attributeSource{product.Title, confidenceTitle, false},
+		attributeSource{product.Description, confidenceDescription, false})
+}
+
+// normalizeAttribute returns the first vocabulary match across sources.
+func normalizeAttribute(vocab []vocabEntry, sources ...attributeSource) *models.NormalizedAttribute {
+	for _, src := range sources {
+		raw := strings.TrimSpace(src.text)
+		if raw == "" {
+			continue
+		}
+		value := matchVocab(vocab, raw)
+		if value == "" {
+			continue
+		}
+		confidence := src.confidence
+		if src.field && isExactVocabTerm(vocab, raw) {
+			confidence = confidenceExact
+		}
+		if !src.field && len(raw) > 200 {
+			raw = raw[:200]
+		}
+		return &models.NormalizedAttribute{Value: value, Confidence: confidence, Raw: raw}
+	}
+	return nil
+}
+
+// matchVocab returns the canonical value of the first vocabulary term found
+// as a whole word / phrase in text.
+func matchVocab(vocab []vocabEntry, text string) string {
+	normalized := normalizeText(text)
+	if strings.TrimSpace(normalized) == "" {
+		return ""
+	}
+	for _, entry := range vocab {
+		for _, syn := range entry.synonyms {
+			if strings.Contains(normalized, " "+syn+" ") {
+				return entry.value
+			}
+		}
+	}
+	return ""
+}
+
+func isExactVocabTerm(vocab []vocabEntry, text string) bool {
+	normalized := strings.TrimSpace(normalizeText(text))
+	for _, entry := range vocab {
+		if normalized == entry.value {
+			return true
+		}
+		for _, syn := range entry.synonyms {
+			if normalized == syn {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package base
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FirstText returns the trimmed text of the first element matched by the
+// first selector that matches anything non-empty.
+func FirstText(doc *goquery.Document, selectors ...string) string {
+	for _, sel := range selectors {
+		if text := strings.TrimSpace(doc.Find(sel).First().Text()); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// AbsoluteURL fixes protocol-relative ("//cdn...") URLs.
+func AbsoluteURL(u string) string {
+	u = strings.TrimSpace(u)
+	if strings.HasPrefix(u, "//") {
+		return "https:" + u
+	}
+	return u
+}
+
+// AppendUnique appends the non-empty items not already in list.
+func AppendUnique(list []string, items ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		seen[s] = true
+	}
+	for _, s := range items {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// StringAt returns the string stored under key in a decoded JSON object,
+// or "".
+func StringAt(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
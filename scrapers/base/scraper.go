@@ -1,18 +1,24 @@
 package base
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
 )
 
 // BaseScraper handles common scraping logic
 type BaseScraper struct {
 	Client *http.Client
+
+	// trace, when set via SetTrace, receives every fetch attempt.
+	trace *models.ScrapeTrace
 }
 
 // NewBaseScraper creates a new BaseScraper instance
@@ -32,25 +38,39 @@ func NewBaseScraper() *BaseScraper {
 	}
 }
 
-// FetchDocument fetches the URL using multiple strategies with a custom validator
+// SetTrace attaches a trace that FetchDocument records every attempt onto.
+func (b *BaseScraper) SetTrace(trace *models.ScrapeTrace) {
+	b.trace = trace
+}
+
+// FetchDocument fetches the URL using multiple strategies with a custom validator.
+// When every strategy fails, the returned error is a *models.ScrapeFailure
+// carrying what each strategy saw so the caller can persist it for debugging.
 func (b *BaseScraper) FetchDocument(url string, validator func(*goquery.Document) bool) (*goquery.Document, error) {
+	var attempts []models.ScrapeAttempt
+
 	// Strategy 1: HTTP Client (Fastest)
-	doc, err := b.FetchDocumentHTTP(url)
+	started := time.Now()
+	doc, attempt, err := b.fetchHTTP(url)
+	valid := err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
+	if valid {
+		fmt.Printf("[BaseScraper] HTTP Success: %s\n", url)
+		return doc, nil
+	}
 	if err == nil {
-		if validator(doc) {
-			fmt.Printf("[BaseScraper] HTTP Success: %s\n", url)
-			return doc, nil
-		} else {
-			fmt.Printf("[BaseScraper] HTTP yielded invalid content (validator failed), trying fallbacks...\n")
-		}
+		fmt.Printf("[BaseScraper] HTTP yielded invalid content (validator failed), trying fallbacks...\n")
 	} else {
 		fmt.Printf("[BaseScraper] HTTP Failed: %v\n", err)
 	}
 
 	// Strategy 2: ChromeDP (Headless)
 	fmt.Printf("[BaseScraper] Trying ChromeDP: %s\n", url)
-	doc, err = b.FetchDocumentChromeDP(url)
-	if err == nil && validator(doc) {
+	started = time.Now()
+	doc, attempt, err = b.fetchChromeDP(url, validator)
+	valid = err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
+	if valid {
 		fmt.Printf("[BaseScraper] ChromeDP Success\n")
 		return doc, nil
 	}
@@ -60,8 +80,11 @@ func (b *BaseScraper) FetchDocument(url string, validator func(*goquery.Document
 
 	// Strategy 3: Selenium (Full Browser)
 	fmt.Printf("[BaseScraper] Trying Selenium: %s\n", url)
-	doc, err = b.FetchDocumentSelenium(url)
-	if err == nil && validator(doc) {
+	started = time.Now()
+	doc, attempt, err = b.fetchSelenium(url)
+	valid = err == nil && validator(doc)
+	attempts = b.recordAttempt(attempts, attempt, started, doc, err, valid)
+	if valid {
 		fmt.Printf("[BaseScraper] Selenium Success\n")
 		return doc, nil
 	}
@@ -69,19 +92,71 @@ func (b *BaseScraper) FetchDocument(url string, validator func(*goquery.Document
 		fmt.Printf("[BaseScraper] Selenium Failed: %v\n", err)
 	}
 
-	return nil, fmt.Errorf("all strategies failed for %s", url)
+	return nil, &models.ScrapeFailure{
+		Err:      fmt.Errorf("all strategies failed for %s", url),
+		Attempts: attempts,
+	}
+}
+
+// recordAttempt fills in the diagnostic fields of a finished attempt, copies
+// it onto the trace (if any) and, when it failed, appends it to attempts.
+func (b *BaseScraper) recordAttempt(attempts []models.ScrapeAttempt, attempt models.ScrapeAttempt, started time.Time, doc *goquery.Document, err error, valid bool) []models.ScrapeAttempt {
+	attempt.DurationMS = time.Since(started).Milliseconds()
+	attempt.ValidatorPassed = valid
+	attempt.BodyTextLen, attempt.Title, attempt.BodySample = inspectDoc(doc)
+	attempt.Blocked = looksLikeBlockPage(doc)
+	switch {
+	case err != nil:
+		attempt.Error = err.Error()
+	case !valid:
+		attempt.Error = "validator failed"
+	}
+
+	if b.trace != nil {
+		b.trace.Attempts = append(b.trace.Attempts, attempt)
+	}
+	if valid {
+		return attempts
+	}
+	return append(attempts, attempt)
+}
+
+// bodySampleLen is how much of the page text inspectDoc keeps as a sample.
+const bodySampleLen = 300
+
+// inspectDoc returns the body text length, page title and a whitespace-
+// collapsed sample of the body text, for traces and failure records.
+func inspectDoc(doc *goquery.Document) (int, string, string) {
+	if doc == nil {
+		return 0, "", ""
+	}
+	body := doc.Find("body").Text()
+	title := strings.TrimSpace(doc.Find("title").Text())
+	sample := strings.Join(strings.Fields(body), " ")
+	if len(sample) > bodySampleLen {
+		sample = sample[:bodySampleLen]
+	}
+	return len(body), title, sample
+}
+
+// looksLikeBlockPage reports whether the document is a bot-check / access
+// denied page rather than the product page.
+func looksLikeBlockPage(doc *goquery.Document) bool {
+	if doc == nil {
+		return false
+	}
+	lowerTitle := strings.ToLower(strings.TrimSpace(doc.Find("title").Text()))
+	return strings.Contains(lowerTitle, "robot check") ||
+		strings.Contains(lowerTitle, "captcha") ||
+		strings.Contains(lowerTitle, "access denied")
 }
 
 func isValidDocument(doc *goquery.Document) bool {
 	// Basic heuristics
-	title := strings.TrimSpace(doc.Find("title").Text())
 	body := strings.TrimSpace(doc.Find("body").Text())
 
 	// Check for common blocking titles/text
-	lowerTitle := strings.ToLower(title)
-	if strings.Contains(lowerTitle, "robot check") ||
-		strings.Contains(lowerTitle, "captcha") ||
-		strings.Contains(lowerTitle, "access denied") {
+	if looksLikeBlockPage(doc) {
 		return false
 	}
 
@@ -90,9 +165,18 @@ func isValidDocument(doc *goquery.Document) bool {
 
 // FetchDocumentHTTP fetches the URL and returns a GoQuery document via standard HTTP
 func (b *BaseScraper) FetchDocumentHTTP(url string) (*goquery.Document, error) {
+	doc, _, err := b.fetchHTTP(url)
+	return doc, err
+}
+
+// fetchHTTP is FetchDocumentHTTP plus the attempt record. The body is read in
+// full before the status check so block pages (403 / 503) are still captured.
+func (b *BaseScraper) fetchHTTP(url string) (*goquery.Document, models.ScrapeAttempt, error) {
+	attempt := models.ScrapeAttempt{Strategy: models.StrategyHTTP, CapturedAt: time.Now()}
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 
 	// Common headers to mimic a real browser
@@ -110,18 +194,25 @@ func (b *BaseScraper) FetchDocumentHTTP(url string) (*goquery.Document, error) {
 
 	res, err := b.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 	defer res.Body.Close()
 
+	attempt.RecordResponse(res.StatusCode, res.Header)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, attempt, err
+	}
+	attempt.HTML = body
+
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+		return nil, attempt, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
 	}
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, attempt, err
 	}
 
-	return doc, nil
+	return doc, attempt, nil
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
 	"github.com/tebeka/selenium"
 	"github.com/tebeka/selenium/chrome"
 )
@@ -15,12 +16,21 @@ const chromeDriverPath = "/usr/bin/chromedriver"
 
 // FetchDocumentSelenium fetches the URL using Selenium and returns the page content as a string
 func (b *BaseScraper) FetchDocumentSelenium(url string) (*goquery.Document, error) {
+	doc, _, err := b.fetchSelenium(url)
+	return doc, err
+}
+
+// fetchSelenium is FetchDocumentSelenium plus the attempt record. WebDriver
+// exposes neither the status code nor headers, so only the HTML is captured.
+func (b *BaseScraper) fetchSelenium(url string) (*goquery.Document, models.ScrapeAttempt, error) {
+	attempt := models.ScrapeAttempt{Strategy: models.StrategySelenium, CapturedAt: time.Now()}
+
 	// Initialize PortManager if not already
 	InitPortManager(4444, 16)
 
 	port, err := GlobalPortManager.GetPort()
 	if err != nil {
-		return nil, fmt.Errorf("port error: %w", err)
+		return nil, attempt, fmt.Errorf("port error: %w", err)
 	}
 	defer GlobalPortManager.ReleasePort(port)
 
@@ -37,7 +47,7 @@ func (b *BaseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 	// We can't easily start the service per request if we want speed, but for robustness we follow the pattern
 	service, err := selenium.NewChromeDriverService(driverPath, port, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("error starting Chrome driver service: %v", err)
+		return nil, attempt, fmt.Errorf("error starting Chrome driver service: %v", err)
 	}
 	defer service.Stop()
 
@@ -67,7 +77,7 @@ func (b *BaseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 
 	driver, err := selenium.NewRemote(caps, fmt.Sprintf("http://localhost:%d/wd/hub", port))
 	if err != nil {
-		return nil, fmt.Errorf("error creating WebDriver: %v", err)
+		return nil, attempt, fmt.Errorf("error creating WebDriver: %v", err)
 	}
 	defer driver.Quit()
 
@@ -84,7 +94,7 @@ func (b *BaseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 	driver.SetPageLoadTimeout(60 * time.Second)
 
 	if err := driver.Get(url); err != nil {
-		return nil, fmt.Errorf("navigation error: %w", err)
+		return nil, attempt, fmt.Errorf("navigation error: %w", err)
 	}
 
 	driver.ExecuteScript(maskScript, nil)
@@ -102,8 +112,11 @@ func (b *BaseScraper) FetchDocumentSelenium(url string) (*goquery.Document, erro
 
 	html, err := driver.PageSource()
 	if err != nil {
-		return nil, fmt.Errorf("page source error: %w", err)
+		return nil, attempt, fmt.Errorf("page source error: %w", err)
 	}
 
-	return goquery.NewDocumentFromReader(strings.NewReader(html))
+	attempt.HTML = []byte(html)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	return doc, attempt, err
 }
@@ -0,0 +1,173 @@
+package scrapers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+// CategoryMapper classifies a scraped product into one of models.GarmentSlots,
+// or returns "" when it can't tell.
+type CategoryMapper func(product *models.Product) string
+
+// categoryMappers holds the per-store mappers, keyed by a host substring.
+// Each store exposes its category in a different place, so each mapper
+// decides which signals to trust and in what order.
+var categoryMappers = []struct {
+	host   string
+	mapper CategoryMapper
+}{
+	{"amazon.", mapAmazonCategory},
+	{"amzn.", mapAmazonCategory},
+	{"myntra.com", mapMyntraCategory},
+	{"flipkart.com", mapFlipkartCategory},
+}
+
+// slotRule maps a set of store keywords to a slot. Rules are checked in
+// order, so more specific garments (a "shirt dress", a "shirt jacket") come
+// before the generic ones they contain, and bottoms come before footwear so
+// "boot cut jeans" stays a bottom. Formal "dress" garments that aren't
+// dresses come first of all.
+type slotRule struct {
+	slot     string
+	keywords []string
+}
+
+var slotRules = []slotRule{
+	{models.SlotTop, []string{"dress shirt", "dress shirts"}},
+	{models.SlotBottom, []string{"dress pants", "dress pant", "dress trousers", "dress trouser", "dress slacks"}},
+	{models.SlotFootwear, []string{"dress shoes", "dress shoe"}},
+	{models.SlotDress, []string{
+		"shirt dress", "t shirt dress", "dress", "dresses", "gown", "gowns", "jumpsuit", "jumpsuits",
+		"playsuit", "romper", "saree", "sarees", "lehenga", "lehengas", "kurta set", "kurta sets", "kurta with",
+		"co ords", "co ord", "nightdress",
+	}},
+	{models.SlotOuterwear, []string{
+		"jacket", "jackets", "shacket", "blazer", "blazers", "coat", "coats", "overcoat", "trench",
+		"parka", "windcheater", "gilet", "waistcoat", "nehru jacket", "shrug", "shrugs", "cardigan",
+		"cardigans", "rain jacket",
+	}},
+	{models.SlotBottom, []string{
+		"jeans", "trousers", "trouser", "pants", "pant", "chinos", "shorts", "skirt", "skirts",
+		"joggers", "track pants", "trackpants", "leggings", "jeggings", "palazzos", "palazzo",
+		"culottes", "salwar", "churidar", "dhoti", "pyjamas", "cargos", "bottomwear",
+	}},
+	{models.SlotFootwear, []string{
+		"footwear", "shoe", "shoes", "sneaker", "sneakers", "boot", "boots", "sandal", "sandals",
+		"heels", "flats", "loafer", "loafers", "slipper", "slippers", "flip flops", "mojaris",
+		"juttis", "slides", "clogs", "brogues", "derbys", "oxfords",
+	}},
+	{models.SlotTop, []string{
+		"t shirt", "t shirts", "tshirt", "tshirts", "tee", "tees", "shirt", "shirts", "top", "tops",
+		"blouse", "blouses", "polo", "polos", "tank", "camisole", "sweatshirt", "sweatshirts",
+		"hoodie", "hoodies", "sweater", "sweaters", "pullover", "kurta", "kurtas", "kurti", "kurtis",
+		"tunic", "tunics", "crop top", "topwear",
+	}},
+	{models.SlotAccessory, []string{
+		"watch", "watches", "belt", "belts", "bag", "bags", "handbag", "handbags", "backpack",
+		"wallet", "wallets", "sunglasses", "cap", "caps", "hat", "hats", "scarf", "scarves", "stole",
+		"tie", "ties", "cufflinks", "necklace", "earrings", "bracelet", "ring", "jewellery",
+		"jewelry", "socks", "gloves", "dupatta", "accessories",
+	}},
+}
+
+// ClassifyProduct returns the garment slot for a scraped product using the
+// mapper for its store, falling back to the generic signal order.
+func ClassifyProduct(product *models.Product) string {
+	if product == nil {
+		return ""
+	}
+	host := strings.ToLower(productHost(product))
+	for _, m := range categoryMappers {
+		if strings.Contains(host, m.host) {
+			if slot := m.mapper(product); slot != "" {
+				return slot
+			}
+			break
+		}
+	}
+	return mapGenericCategory(product)
+}
+
+// mapAmazonCategory trusts the breadcrumb: Subcategory is its deepest level.
+func mapAmazonCategory(product *models.Product) string {
+	return firstSlot(product.Subcategory, product.Category, product.Title)
+}
+
+// mapMyntraCategory uses the article-type slug that leads every Myntra PDP
+// path (myntra.com/tshirts/roadster/.../buy).
+func mapMyntraCategory(product *models.Product) string {
+	return firstSlot(firstPathSegment(product), product.Subcategory, product.Category, product.Title)
+}
+
+// mapFlipkartCategory: Flipkart paths are just the product name slug, so
+// the title is as good a signal as the (often empty) category.
+func mapFlipkartCategory(product *models.Product) string {
+	return firstSlot(product.Subcategory, product.Category, product.Title, firstPathSegment(product))
+}
+
+func mapGenericCategory(product *models.Product) string {
+	return firstSlot(product.Subcategory, product.Category, product.Title, productPath(product))
+}
+
+// firstSlot classifies each signal in turn and returns the first match.
+func firstSlot(signals ...string) string {
+	for _, s := range signals {
+		if slot := matchSlot(s); slot != "" {
+			return slot
+		}
+	}
+	return ""
+}
+
+// matchSlot matches whole words / phrases from slotRules against text.
+func matchSlot(text string) string {
+	normalized := normalizeText(text)
+	if strings.TrimSpace(normalized) == "" {
+		return ""
+	}
+	for _, rule := range slotRules {
+		for _, kw := range rule.keywords {
+			if strings.Contains(normalized, " "+kw+" ") {
+				return rule.slot
+			}
+		}
+	}
+	return ""
+}
+
+// normalizeText lower-cases text, turns punctuation into word breaks and
+// pads it with spaces so " "+term+" " matches whole words only.
+func normalizeText(text string) string {
+	return " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ") + " "
+}
+
+func productHost(product *models.Product) string {
+	u, err := url.Parse(productURL(product))
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func productPath(product *models.Product) string {
+	u, err := url.Parse(productURL(product))
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+func firstPathSegment(product *models.Product) string {
+	return strings.SplitN(strings.Trim(productPath(product), "/"), "/", 2)[0]
+}
+
+func productURL(product *models.Product) string {
+	if product.ResolvedURL != "" {
+		return product.ResolvedURL
+	}
+	return product.URL
+}
@@ -3,10 +3,10 @@ package scrapers
 import (
 	"fmt"
 
+	"github.com/raushankrgupta/web-product-scraper/scrapers/abfrl"
 	"github.com/raushankrgupta/web-product-scraper/scrapers/amazon"
 	"github.com/raushankrgupta/web-product-scraper/scrapers/flipkart"
 	"github.com/raushankrgupta/web-product-scraper/scrapers/myntra"
-	"github.com/raushankrgupta/web-product-scraper/scrapers/peterengland"
 	"github.com/raushankrgupta/web-product-scraper/scrapers/tatacliq"
 	"github.com/raushankrgupta/web-product-scraper/utils"
 )
@@ -25,7 +25,7 @@ func GetScraper(url string) (Scraper, string, error) {
 		flipkart.NewFlipkartScraper(),
 		myntra.NewMyntraScraper(),
 		tatacliq.NewTataCliqScraper(),
-		peterengland.NewPeterEnglandScraper(),
+		abfrl.NewABFRLScraper(), // Peter England, Allen Solly, Van Heusen, Louis Philippe
 	}
 
 	for _, s := range scrapers {
@@ -0,0 +1,344 @@
+package flipkart
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers/base"
+)
+
+// initialStateMarker prefixes the product payload Flipkart server-renders
+// into every PDP. Unlike the CSS class names, its keys have been stable
+// for years.
+const initialStateMarker = "window.__INITIAL_STATE__"
+
+// Flipkart image URLs are templates: .../image/{@width}/{@height}/...?q={@quality}
+const (
+	imageSize    = "832"
+	imageQuality = "90"
+)
+
+// extractInitialState finds and decodes window.__INITIAL_STATE__. Returns
+// nil when the page doesn't carry it (block pages, very old layouts).
+func extractInitialState(doc *goquery.Document) map[string]interface{} {
+	var state map[string]interface{}
+	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := s.Text()
+		idx := strings.Index(text, initialStateMarker)
+		if idx == -1 {
+			return true
+		}
+		brace := strings.Index(text[idx:], "{")
+		if brace == -1 {
+			return true
+		}
+		// Decode exactly one JSON value; the payload is followed by ";" and
+		// more script, and may itself contain ";" inside strings.
+		dec := json.NewDecoder(strings.NewReader(text[idx+brace:]))
+		if err := dec.Decode(&state); err != nil {
+			fmt.Printf("[FlipkartScraper] Failed to decode %s: %v\n", initialStateMarker, err)
+			state = nil
+			return true
+		}
+		return false
+	})
+	return state
+}
+
+// populateFromState fills product from the decoded state. It returns true
+// if it found the core fields (title and a price); the DOM selectors only
+// fill what is still empty afterwards.
+func populateFromState(product *models.Product, state map[string]interface{}, pageURL string) bool {
+	// The nodes enclosing the product's pageContext; the gallery and
+	// swatches are looked up nearest to it, away from recommendation widgets
+	scope := []interface{}{state}
+	for _, match := range findKeyMatches(state, "pageContext") {
+		pageContext, ok := match.value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		scope = match.ancestors
+		if titles, ok := pageContext["titles"].(map[string]interface{}); ok && product.Title == "" {
+			product.Title = strings.TrimSpace(base.StringAt(titles, "title"))
+		}
+		if pricing, ok := pageContext["pricing"].(map[string]interface{}); ok {
+			if val, ok := numberAt(pricing, "finalPrice", "value"); ok && product.DiscountedPrice == "" {
+				product.DiscountedPrice = fmt.Sprintf("₹%.0f", val)
+			}
+			if val, ok := numberAt(pricing, "mrp", "value"); ok && product.MRP == "" {
+				product.MRP = fmt.Sprintf("₹%.0f", val)
+			}
+			if val, ok := numberAt(pricing, "totalDiscount"); ok && val > 0 && product.Discount == "" {
+				product.Discount = fmt.Sprintf("%.0f%% off", val)
+			}
+		}
+		if analytics, ok := pageContext["analyticsData"].(map[string]interface{}); ok && product.Category == "" {
+			var path []string
+			for _, key := range []string{"superCategory", "category", "subCategory", "vertical"} {
+				if v := strings.TrimSpace(base.StringAt(analytics, key)); v != "" {
+					path = append(path, v)
+				}
+			}
+			if len(path) > 0 {
+				product.Category = strings.Join(path, " > ")
+				product.Subcategory = path[len(path)-1]
+			}
+		}
+		if product.Title != "" {
+			break
+		}
+	}
+
+	product.Images = base.AppendUnique(product.Images, stateImages(scope)...)
+	populateSwatches(product, scope, pageURL)
+
+	return product.Title != "" && product.DiscountedPrice != ""
+}
+
+// stateImages collects the full-resolution gallery: the first
+// multimediaComponents list with images in the nearest node of scope
+// (innermost last) that has one. Later lists on the page belong to
+// recommendation widgets showing other products.
+func stateImages(scope []interface{}) []string {
+	for i := len(scope) - 1; i >= 0; i-- {
+		for _, list := range findKey(scope[i], "multimediaComponents") {
+			if images := galleryImages(list); len(images) > 0 {
+				return images
+			}
+		}
+	}
+	return nil
+}
+
+// galleryImages returns the images of one multimediaComponents list.
+func galleryImages(list interface{}) []string {
+	components, ok := list.([]interface{})
+	if !ok {
+		return nil
+	}
+	var images []string
+	for _, c := range components {
+		component, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, ok := component["value"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ct := base.StringAt(value, "contentType"); ct != "" && ct != "IMAGE" {
+			continue // videos, 360 views
+		}
+		if img := resolveImageURL(base.StringAt(value, "url")); img != "" {
+			images = append(images, img)
+		}
+	}
+	return images
+}
+
+// populateSwatches builds colour/size Variants from the swatch component:
+//
+//	attributes:       [{"id": "color"}, {"id": "size"}]
+//	attributeOptions: [[{"value": "Black", "imageUrl": ...}, ...], [{"value": "M"}, ...]]
+//	products:         {"<pid>": {"attributeIndexes": [0, 2]}, ...}
+//
+// Variant.ASIN carries Flipkart's pid. The variant matching the pid in the
+// page URL becomes CurrentSelection. The swatch component is the first
+// one in the nearest node of scope, as for stateImages.
+func populateSwatches(product *models.Product, scope []interface{}, pageURL string) {
+	var swatch map[string]interface{}
+	for i := len(scope) - 1; i >= 0 && swatch == nil; i-- {
+		for _, c := range findKey(scope[i], "swatchComponent") {
+			if m, ok := c.(map[string]interface{}); ok {
+				if v, ok := m["value"].(map[string]interface{}); ok {
+					swatch = v
+					break
+				}
+			}
+		}
+	}
+	if swatch == nil {
+		return
+	}
+
+	attributes, _ := swatch["attributes"].([]interface{})
+	options, _ := swatch["attributeOptions"].([]interface{})
+	products, _ := swatch["products"].(map[string]interface{})
+	if len(attributes) == 0 || len(options) == 0 || len(products) == 0 {
+		return
+	}
+
+	colorIdx, sizeIdx := -1, -1
+	for i, a := range attributes {
+		attr, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id := strings.ToLower(base.StringAt(attr, "id"))
+		switch {
+		case strings.Contains(id, "color") || strings.Contains(id, "colour"):
+			colorIdx = i
+		case strings.Contains(id, "size"):
+			sizeIdx = i
+		}
+	}
+	if colorIdx == -1 && sizeIdx == -1 {
+		return
+	}
+
+	// option returns the swatch option at attributeOptions[dim][idx]
+	option := func(dim, idx int) map[string]interface{} {
+		if dim < 0 || dim >= len(options) {
+			return nil
+		}
+		list, ok := options[dim].([]interface{})
+		if !ok || idx < 0 || idx >= len(list) {
+			return nil
+		}
+		opt, _ := list[idx].(map[string]interface{})
+		return opt
+	}
+
+	currentPID := ""
+	if u, err := neturl.Parse(pageURL); err == nil {
+		currentPID = u.Query().Get("pid")
+	}
+
+	// Sorted so the variant list is stable across scrapes
+	pids := make([]string, 0, len(products))
+	for pid := range products {
+		pids = append(pids, pid)
+	}
+	sort.Strings(pids)
+
+	for _, pid := range pids {
+		entry, ok := products[pid].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		indexes, _ := entry["attributeIndexes"].([]interface{})
+		indexAt := func(dim int) int {
+			if dim < 0 || dim >= len(indexes) {
+				return -1
+			}
+			f, ok := indexes[dim].(float64)
+			if !ok {
+				return -1
+			}
+			return int(f)
+		}
+
+		variant := models.Variant{ASIN: pid}
+		if opt := option(sizeIdx, indexAt(sizeIdx)); opt != nil {
+			variant.Size = strings.TrimSpace(base.StringAt(opt, "value"))
+		}
+		if opt := option(colorIdx, indexAt(colorIdx)); opt != nil {
+			variant.Color = strings.TrimSpace(base.StringAt(opt, "value"))
+			for _, key := range []string{"imageUrl", "defaultImageUrl"} {
+				if img := resolveImageURL(base.StringAt(opt, key)); img != "" {
+					variant.Images = []string{img}
+					break
+				}
+			}
+		}
+		if variant.Size == "" && variant.Color == "" {
+			continue
+		}
+
+		product.Variants = append(product.Variants, variant)
+		if pid == currentPID {
+			current := variant
+			if len(product.Images) > 0 {
+				current.Images = product.Images // the gallery on the page is the selected variant's
+			}
+			product.CurrentSelection = &current
+		}
+	}
+}
+
+// resolveImageURL fills Flipkart's {@width}/{@height}/{@quality}
+// placeholders (or upgrades fixed thumbnail sizes) to full resolution.
+func resolveImageURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	img := strings.NewReplacer(
+		"{@width}", imageSize,
+		"{@height}", imageSize,
+		"{@quality}", imageQuality,
+	).Replace(raw)
+	img = thumbnailSize.ReplaceAllString(img, "/image/"+imageSize+"/"+imageSize+"/")
+	if strings.HasPrefix(img, "http://") {
+		img = "https://" + strings.TrimPrefix(img, "http://")
+	}
+	return img
+}
+
+// keyMatch is a value found under a key, with the nodes enclosing it,
+// outermost (the searched node) first.
+type keyMatch struct {
+	value     interface{}
+	ancestors []interface{}
+}
+
+// findKeyMatches returns every value stored under key anywhere in node.
+// Map keys are walked in sorted order and arrays in order, so the result
+// is the same on every run.
+func findKeyMatches(node interface{}, key string) []keyMatch {
+	var found []keyMatch
+	var path []interface{}
+	var walk func(n interface{})
+	walk = func(n interface{}) {
+		path = append(path, n)
+		defer func() { path = path[:len(path)-1] }()
+		switch v := n.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if k == key {
+					found = append(found, keyMatch{value: v[k], ancestors: append([]interface{}(nil), path...)})
+				}
+				walk(v[k])
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return found
+}
+
+// findKey returns every value stored under key anywhere in node, in the
+// order of findKeyMatches.
+func findKey(node interface{}, key string) []interface{} {
+	var found []interface{}
+	for _, m := range findKeyMatches(node, key) {
+		found = append(found, m.value)
+	}
+	return found
+}
+
+// numberAt follows path through nested maps and returns the number at the end.
+func numberAt(m map[string]interface{}, path ...string) (float64, bool) {
+	var cur interface{} = m
+	for _, key := range path {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		cur = obj[key]
+	}
+	f, ok := cur.(float64)
+	return f, ok
+}
@@ -9,3 +9,11 @@ type Scraper interface {
 	// ScrapeProduct scrapes the product details from the given URL
 	ScrapeProduct(url string) (*models.Product, error)
 }
+
+// Traceable is implemented by scrapers that can record every fetch attempt
+// onto a ScrapeTrace (everything built on scrapers/base, plus
+// myntra_scraper). Scrapers are constructed per request, so the trace is
+// request-scoped.
+type Traceable interface {
+	SetTrace(trace *models.ScrapeTrace)
+}
@@ -0,0 +1,312 @@
+package tatacliq
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"github.com/raushankrgupta/web-product-scraper/scrapers/base"
+)
+
+// stateMarkers are the globals Tata CLiQ's PWA preloads its Redux store
+// into. The product lives under productDescription.productDetails, which
+// is also the shape of the productDetails JSON API.
+var stateMarkers = []string{"window.__PRELOADED_STATE__", "window.__INITIAL_STATE__"}
+
+// productCodePattern pulls the listing code out of PDP URLs
+// (.../p-mp000000012345678).
+var productCodePattern = regexp.MustCompile(`(?i)/p-(mp[0-9]+)`)
+
+// extractProductDetails finds the preloaded state and returns its
+// productDetails object, or nil if the page doesn't carry one.
+func extractProductDetails(doc *goquery.Document) map[string]interface{} {
+	var details map[string]interface{}
+	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := s.Text()
+		for _, marker := range stateMarkers {
+			idx := strings.Index(text, marker)
+			if idx == -1 {
+				continue
+			}
+			brace := strings.Index(text[idx:], "{")
+			if brace == -1 {
+				continue
+			}
+			var state map[string]interface{}
+			if err := json.NewDecoder(strings.NewReader(text[idx+brace:])).Decode(&state); err != nil {
+				fmt.Printf("[TataCliqScraper] Failed to decode %s: %v\n", marker, err)
+				continue
+			}
+			details = findProductDetails(state)
+			if details != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return details
+}
+
+// findProductDetails returns the first "productDetails" object in node that
+// actually describes a product.
+func findProductDetails(node interface{}) map[string]interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if d, ok := v["productDetails"].(map[string]interface{}); ok && isProductDetails(d) {
+			return d
+		}
+		if isProductDetails(v) {
+			return v
+		}
+		// Sorted so the same object wins on every run
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d := findProductDetails(v[k]); d != nil {
+				return d
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if d := findProductDetails(child); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+func isProductDetails(m map[string]interface{}) bool {
+	_, hasGallery := m["galleryImagesList"]
+	return hasGallery && (base.StringAt(m, "productTitle") != "" || base.StringAt(m, "productName") != "")
+}
+
+// populateFromDetails fills product from a productDetails object.
+func populateFromDetails(product *models.Product, details map[string]interface{}) {
+	title := strings.TrimSpace(base.StringAt(details, "productTitle"))
+	if title == "" {
+		title = strings.TrimSpace(base.StringAt(details, "productName"))
+	}
+	if brand := strings.TrimSpace(base.StringAt(details, "brandName")); brand != "" {
+		product.Brand = brand
+		if !strings.HasPrefix(strings.ToLower(title), strings.ToLower(brand)) {
+			title = brand + " " + title
+		}
+	}
+	product.Title = title
+
+	// Pricing
+	mrp, hasMRP := priceAt(details, "mrpPrice")
+	price, hasPrice := priceAt(details, "winningSellerPrice")
+	if !hasPrice {
+		price, hasPrice = mrp, hasMRP
+	}
+	if hasMRP {
+		product.MRP = formatPrice(mrp)
+	}
+	if hasPrice {
+		product.DiscountedPrice = formatPrice(price)
+	}
+	if d := discountAt(details); d > 0 {
+		product.Discount = fmt.Sprintf("%d%% off", d)
+	} else if hasMRP && hasPrice && mrp > price {
+		product.Discount = fmt.Sprintf("%d%% off", int(math.Round((mrp-price)/mrp*100)))
+	}
+
+	product.Description = strings.TrimSpace(base.StringAt(details, "productDescription"))
+
+	// Category breadcrumb
+	if hierarchy, ok := details["categoryHierarchy"].([]interface{}); ok {
+		var path []string
+		for _, h := range hierarchy {
+			if m, ok := h.(map[string]interface{}); ok {
+				if name := strings.TrimSpace(base.StringAt(m, "category_name")); name != "" {
+					path = append(path, name)
+				}
+			}
+		}
+		if len(path) > 0 {
+			product.Category = strings.Join(path, " > ")
+			product.Subcategory = path[len(path)-1]
+		}
+	}
+
+	// Specifications table: material and fit
+	for _, spec := range specifications(details) {
+		k := strings.ToLower(spec.Key)
+		switch {
+		case product.Material == "" && (strings.Contains(k, "material") || strings.Contains(k, "fabric")):
+			product.Material = spec.Value
+		case product.FitType == "" && strings.Contains(k, "fit"):
+			product.FitType = spec.Value
+		case product.Dimensions == "" && strings.Contains(k, "dimension"):
+			product.Dimensions = spec.Value
+		}
+	}
+
+	product.Images = galleryImages(details)
+}
+
+// galleryImages returns the full-size images from galleryImagesList, in
+// gallery order. Each entry offers several renditions; the largest wins.
+func galleryImages(details map[string]interface{}) []string {
+	list, _ := details["galleryImagesList"].([]interface{})
+	var images []string
+	seen := make(map[string]bool)
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if mt := strings.ToLower(base.StringAt(entry, "mediaType")); mt != "" && mt != "image" {
+			continue
+		}
+		renditions := make(map[string]string)
+		if imgs, ok := entry["galleryImages"].([]interface{}); ok {
+			for _, r := range imgs {
+				if m, ok := r.(map[string]interface{}); ok {
+					renditions[base.StringAt(m, "key")] = base.StringAt(m, "value")
+				}
+			}
+		}
+		for _, key := range []string{"superZoom", "zoom", "product", "cartPage", "thumbnail"} {
+			if img := base.AbsoluteURL(renditions[key]); img != "" {
+				if !seen[img] {
+					seen[img] = true
+					images = append(images, img)
+				}
+				break
+			}
+		}
+	}
+	return images
+}
+
+// variantOption is one entry of productDetails.variantOptions: a colour
+// link and a size link. The colour URL is the PDP of that colour.
+type variantOption struct {
+	Color       string
+	ColorCode   string // product code parsed from the colour URL
+	ColorActive bool
+	Size        string
+	SizeCode    string
+	SizeActive  bool
+	Available   *bool // the size's stock; nil when not reported
+}
+
+// variantOptions reads productDetails.variantOptions.
+func variantOptions(details map[string]interface{}) []variantOption {
+	list, _ := details["variantOptions"].([]interface{})
+	var options []variantOption
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var opt variantOption
+		if color, ok := entry["colorlink"].(map[string]interface{}); ok {
+			opt.Color = strings.TrimSpace(base.StringAt(color, "color"))
+			opt.ColorActive, _ = color["selected"].(bool)
+			if m := productCodePattern.FindStringSubmatch(base.StringAt(color, "colorurl")); len(m) > 1 {
+				opt.ColorCode = strings.ToUpper(m[1])
+			}
+		}
+		if size, ok := entry["sizelink"].(map[string]interface{}); ok {
+			opt.Size = strings.TrimSpace(base.StringAt(size, "size"))
+			opt.SizeCode = strings.ToUpper(base.StringAt(size, "productCode"))
+			opt.SizeActive, _ = size["selected"].(bool)
+			if available, ok := size["isAvailable"].(bool); ok {
+				opt.Available = &available
+			}
+		}
+		if opt.Color == "" && opt.Size == "" {
+			continue
+		}
+		options = append(options, opt)
+	}
+	return options
+}
+
+// specification is one row of the product's specification tables.
+type specification struct {
+	Key, Value string
+}
+
+// specifications flattens the classifications / details tables, in table
+// order. A key repeated later is dropped.
+func specifications(details map[string]interface{}) []specification {
+	var specs []specification
+	seen := make(map[string]bool)
+	add := func(list interface{}) {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := strings.TrimSpace(base.StringAt(m, "key"))
+			value := strings.TrimSpace(base.StringAt(m, "value"))
+			if key != "" && value != "" && !seen[key] {
+				seen[key] = true
+				specs = append(specs, specification{Key: key, Value: value})
+			}
+		}
+	}
+	if groups, ok := details["classifications"].([]interface{}); ok {
+		for _, g := range groups {
+			if m, ok := g.(map[string]interface{}); ok {
+				add(m["specifications"])
+			}
+		}
+	}
+	add(details["details"])
+	return specs
+}
+
+// priceAt reads a Tata CLiQ price object ({"doubleValue": 1299, "value": 1299,
+// "formattedValue": "₹1,299.00"}).
+func priceAt(details map[string]interface{}, key string) (float64, bool) {
+	p, ok := details[key].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	for _, field := range []string{"doubleValue", "value"} {
+		switch v := p[field].(type) {
+		case float64:
+			if v > 0 {
+				return v, true
+			}
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// discountAt reads productDetails.discount, sent as a number or a string.
+func discountAt(details map[string]interface{}) int {
+	switch v := details["discount"].(type) {
+	case float64:
+		return int(math.Round(v))
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64); err == nil {
+			return int(math.Round(f))
+		}
+	}
+	return 0
+}
+
+func formatPrice(v float64) string {
+	return fmt.Sprintf("₹%.0f", v)
+}
@@ -1,6 +1,9 @@
 package tatacliq
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -8,6 +11,13 @@ import (
 	"github.com/raushankrgupta/web-product-scraper/scrapers/base"
 )
 
+// productDetailsAPI is the JSON endpoint the Tata CLiQ PWA loads a PDP
+// from. Used to fetch the gallery of colours other than the scraped one.
+const productDetailsAPI = "https://www.tatacliq.com/marketplacewebservices/v2/mpl/products/productDetails/%s?isPwa=true&isMDE=true"
+
+// maxColorGalleries caps the extra API calls made for colour galleries.
+const maxColorGalleries = 6
+
 type TataCliqScraper struct {
 	*base.BaseScraper
 }
@@ -24,8 +34,11 @@ func (s *TataCliqScraper) CanScrape(url string) bool {
 
 func (s *TataCliqScraper) ScrapeProduct(url string) (*models.Product, error) {
 	doc, err := s.FetchDocument(url, func(doc *goquery.Document) bool {
-		// Needs strictly dynamic content
-		return doc.Find(".ProductDescriptionPage__productName").Length() > 0 || doc.Find(".ProductDetailsMainCard__productName").Length() > 0
+		// Needs strictly dynamic content, or the preloaded product state
+		if doc.Find(".ProductDescriptionPage__productName").Length() > 0 || doc.Find(".ProductDetailsMainCard__productName").Length() > 0 {
+			return true
+		}
+		return extractProductDetails(doc) != nil
 	})
 	if err != nil {
 		return nil, err
@@ -33,51 +46,148 @@ func (s *TataCliqScraper) ScrapeProduct(url string) (*models.Product, error) {
 
 	product := &models.Product{}
 
-	// TataCliq uses dynamic content heavily, but some basics might be in meta tags or specific divs
+	// 1. Preloaded product state (title, pricing, gallery, specs, variants)
+	if details := extractProductDetails(doc); details != nil {
+		populateFromDetails(product, details)
+		s.populateVariants(product, details, url)
+		fmt.Printf("[TataCliqScraper] Parsed preloaded state: %d images, %d variants\n", len(product.Images), len(product.Variants))
+	}
 
-	// 1. Title
-	product.Title = strings.TrimSpace(doc.Find("h1.ProductDescriptionPage__productName").Text())
+	// 2. Selector fallbacks for anything the state didn't provide
+	if product.Title == "" {
+		product.Title = strings.TrimSpace(doc.Find("h1.ProductDescriptionPage__productName").Text())
+	}
 	if product.Title == "" {
-		// Fallback checks
 		product.Title = strings.TrimSpace(doc.Find(".ProductDetailsMainCard__productName").Text())
 	}
 
-	// 2. Price
-	product.DiscountedPrice = strings.TrimSpace(doc.Find(".ProductDescriptionPage__price").Text())
+	if product.DiscountedPrice == "" {
+		product.DiscountedPrice = strings.TrimSpace(doc.Find(".ProductDescriptionPage__price").Text())
+	}
 	if product.DiscountedPrice == "" {
 		product.DiscountedPrice = strings.TrimSpace(doc.Find(".ProductDetailsMainCard__price").Text())
 	}
 
-	product.MRP = strings.TrimSpace(doc.Find(".ProductDescriptionPage__mrp").Text())
+	if product.MRP == "" {
+		product.MRP = strings.TrimSpace(doc.Find(".ProductDescriptionPage__mrp").Text())
+	}
 	if product.MRP == "" {
 		product.MRP = strings.TrimSpace(doc.Find(".ProductDetailsMainCard__mrp").Text())
 	}
 
-	product.Discount = strings.TrimSpace(doc.Find(".ProductDescriptionPage__discount").Text())
+	if product.Discount == "" {
+		product.Discount = strings.TrimSpace(doc.Find(".ProductDescriptionPage__discount").Text())
+	}
 
-	// 3. Description
-	product.Description = strings.TrimSpace(doc.Find(".ProductDescriptionPage__productDescription").Text())
+	if product.Description == "" {
+		product.Description = strings.TrimSpace(doc.Find(".ProductDescriptionPage__productDescription").Text())
+	}
 	if product.Description == "" {
 		product.Description = strings.TrimSpace(doc.Find(".ProductDetailsMainCard__description").Text())
 	}
 
-	// 4. Images
-	// TataCliq images are tricky with basic scraping.
-	// Often found in .ImageGallery__image or similar
-	doc.Find("img.ImageGallery__image").Each(func(i int, s *goquery.Selection) {
-		src := s.AttrOr("src", "")
-		if src != "" {
-			product.Images = append(product.Images, src)
-		}
-	})
+	if len(product.Images) == 0 {
+		doc.Find("img.ImageGallery__image").Each(func(i int, s *goquery.Selection) {
+			src := base.AbsoluteURL(s.AttrOr("src", ""))
+			if src != "" {
+				product.Images = append(product.Images, src)
+			}
+		})
+	}
 
-	// Also check for meta image
+	// Last resort: meta image
 	if len(product.Images) == 0 {
 		metaImg := doc.Find("meta[property='og:image']").AttrOr("content", "")
 		if metaImg != "" {
-			product.Images = append(product.Images, metaImg)
+			product.Images = append(product.Images, base.AbsoluteURL(metaImg))
 		}
 	}
 
 	return product, nil
 }
+
+// populateVariants builds one Variant per colour/size option, keeping
+// out-of-stock sizes with Available=false. The scraped colour uses the page
+// gallery; other colours get theirs from the productDetails API (best
+// effort, capped at maxColorGalleries galleries in all).
+func (s *TataCliqScraper) populateVariants(product *models.Product, details map[string]interface{}, pageURL string) {
+	options := variantOptions(details)
+	if len(options) == 0 {
+		return
+	}
+
+	currentCode := strings.ToUpper(base.StringAt(details, "productListingId"))
+	if m := productCodePattern.FindStringSubmatch(pageURL); len(m) > 1 {
+		currentCode = strings.ToUpper(m[1])
+	}
+
+	galleries := make(map[string][]string)
+	for _, opt := range options {
+		if opt.ColorActive || opt.ColorCode == currentCode || opt.SizeCode == currentCode {
+			galleries[opt.Color] = product.Images
+		}
+	}
+	for _, opt := range options {
+		if _, done := galleries[opt.Color]; done || opt.ColorCode == "" {
+			continue
+		}
+		if len(galleries) >= maxColorGalleries {
+			break
+		}
+		images, err := s.fetchColorGallery(opt.ColorCode)
+		if err != nil {
+			fmt.Printf("[TataCliqScraper] Gallery for %s (%s) failed: %v\n", opt.Color, opt.ColorCode, err)
+		}
+		galleries[opt.Color] = images
+	}
+
+	for _, opt := range options {
+		code := opt.SizeCode
+		if code == "" {
+			code = opt.ColorCode
+		}
+		variant := models.Variant{
+			ASIN:      code,
+			Size:      opt.Size,
+			Color:     opt.Color,
+			Images:    galleries[opt.Color],
+			Available: opt.Available,
+		}
+		product.Variants = append(product.Variants, variant)
+
+		if product.CurrentSelection == nil && ((opt.ColorActive && opt.SizeActive) || (code != "" && code == currentCode)) {
+			current := variant
+			product.CurrentSelection = &current
+		}
+	}
+}
+
+// fetchColorGallery loads another colour's productDetails and returns its
+// gallery.
+func (s *TataCliqScraper) fetchColorGallery(productCode string) ([]string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(productDetailsAPI, productCode), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code error: %d", res.StatusCode)
+	}
+
+	var payload map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	details := findProductDetails(payload)
+	if details == nil {
+		return nil, fmt.Errorf("no productDetails in response")
+	}
+	return galleryImages(details), nil
+}
@@ -0,0 +1,436 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	creditAccountsCollection = "credit_accounts"
+	creditLedgerCollection   = "credit_ledger"
+	// creditUpdateRetries bounds the optimistic-concurrency retries of one
+	// account update.
+	creditUpdateRetries = 5
+)
+
+// ErrInsufficientCredits is returned by ConsumeCredits when the balance is
+// lower than the units asked for.
+var ErrInsufficientCredits = errors.New("not enough credits")
+
+// CreditBalance is a user's spendable credits.
+type CreditBalance struct {
+	Available        int                `json:"available"`
+	MonthlyAllowance int                `json:"monthly_allowance"`
+	Lots             []models.CreditLot `json:"lots"`
+}
+
+// CreditGrant describes credits to add to an account.
+type CreditGrant struct {
+	Source    string // models.CreditSource*
+	Units     int
+	ExpiresAt *time.Time // nil never expires
+	Ref       string     // a grant is applied once per ref, so webhooks can be retried
+	Note      string
+}
+
+// CreditUse is the credits taken for one try-on, kept so they can be
+// refunded to the lots they came from.
+type CreditUse struct {
+	Ref   string
+	Units int
+	Lots  []models.CreditLot // Remaining is the units taken from the lot
+}
+
+// EnsureCreditIndexes creates the unique account index, and the ledger's
+// per-user history, grant ref and unique entry key indexes.
+func EnsureCreditIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := GetCollection(config.DBName, creditAccountsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = GetCollection(config.DBName, creditLedgerCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "ref", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"key": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+// GetCreditBalance returns the user's credits as they stand now: with
+// expired lots left out and this month's plan allowance included. It only
+// reads; the allowance is granted and expiry recorded by the next spend.
+func GetCreditBalance(ctx context.Context, userID, plan string) (CreditBalance, error) {
+	acc := &models.CreditAccount{UserID: userID}
+	err := GetCollection(config.DBName, creditAccountsCollection).FindOne(ctx, bson.M{"user_id": userID}).Decode(acc)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return CreditBalance{}, fmt.Errorf("load credits: %w", err)
+	}
+	refreshCreditAccount(acc, plan, time.Now())
+	dropEmptyLots(acc)
+	return CreditBalance{
+		Available:        creditTotal(acc),
+		MonthlyAllowance: models.MonthlyAllowanceForPlan(plan),
+		Lots:             acc.Lots,
+	}, nil
+}
+
+// GrantCredits adds a lot of credits to the user's account. A grant whose
+// Ref was already applied is a no-op.
+func GrantCredits(ctx context.Context, userID, plan string, grant CreditGrant) error {
+	if grant.Units <= 0 {
+		return fmt.Errorf("grant credits: units must be positive")
+	}
+	_, err := updateCreditAccount(ctx, userID, plan, func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+		if grant.Ref != "" {
+			// A grant's entry is in the account's pending entries or, once
+			// copied, in the ledger. The account was loaded first and is
+			// saved only if unchanged, so a racing grant can't slip between.
+			for _, e := range acc.PendingLedger {
+				if e.Kind == models.LedgerGrant && e.Ref == grant.Ref {
+					return nil, nil
+				}
+			}
+			n, err := GetCollection(config.DBName, creditLedgerCollection).CountDocuments(ctx,
+				bson.M{"user_id": userID, "kind": models.LedgerGrant, "ref": grant.Ref}, options.Count().SetLimit(1))
+			if err != nil {
+				return nil, fmt.Errorf("check grant: %w", err)
+			}
+			if n > 0 {
+				return nil, nil
+			}
+		}
+		lot := models.CreditLot{
+			ID:        primitive.NewObjectID().Hex(),
+			Source:    grant.Source,
+			Units:     grant.Units,
+			Remaining: grant.Units,
+			ExpiresAt: grant.ExpiresAt,
+			Ref:       grant.Ref,
+			CreatedAt: now,
+		}
+		acc.Lots = append(acc.Lots, lot)
+		return []models.CreditLedgerEntry{ledgerEntry(acc, models.LedgerGrant, lot, grant.Units, grant.Ref, grant.Note, now)}, nil
+	})
+	return err
+}
+
+// ConsumeCredits spends units from the user's lots, soonest-expiring first.
+// ref ties the ledger entries to the try-on.
+func ConsumeCredits(ctx context.Context, userID, plan string, units int, ref string) (*CreditUse, error) {
+	use := &CreditUse{Ref: ref, Units: units}
+	_, err := updateCreditAccount(ctx, userID, plan, func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+		use.Lots = nil
+		if creditTotal(acc) < units {
+			return nil, ErrInsufficientCredits
+		}
+		sort.SliceStable(acc.Lots, func(i, j int) bool {
+			a, b := acc.Lots[i].ExpiresAt, acc.Lots[j].ExpiresAt
+			if a == nil || b == nil {
+				return a != nil
+			}
+			return a.Before(*b)
+		})
+
+		var entries []models.CreditLedgerEntry
+		left := units
+		for i := range acc.Lots {
+			if left == 0 {
+				break
+			}
+			lot := &acc.Lots[i]
+			take := min(lot.Remaining, left)
+			if take <= 0 {
+				continue
+			}
+			lot.Remaining -= take
+			left -= take
+			taken := *lot
+			taken.Remaining = take
+			use.Lots = append(use.Lots, taken)
+			entries = append(entries, ledgerEntry(acc, models.LedgerConsume, *lot, -take, ref, "", now))
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return use, nil
+}
+
+// TryOnCredits is the use as saved on a try-on job's record.
+func (u *CreditUse) TryOnCredits(plan string) *models.TryOnCredits {
+	return &models.TryOnCredits{Plan: plan, Ref: u.Ref, Units: u.Units, Lots: u.Lots}
+}
+
+// RefundTryOnCredits gives back the credits saved on a try-on job's
+// record, for a job that never got to settle them.
+func RefundTryOnCredits(ctx context.Context, userID string, c *models.TryOnCredits) error {
+	return RefundCredits(ctx, userID, c.Plan, &CreditUse{Ref: c.Ref, Units: c.Units, Lots: c.Lots})
+}
+
+// RefundCredits gives back credits taken by ConsumeCredits. Units from a
+// lot that has since expired are not returned.
+func RefundCredits(ctx context.Context, userID, plan string, use *CreditUse) error {
+	_, err := updateCreditAccount(ctx, userID, plan, func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+		var entries []models.CreditLedgerEntry
+		for _, taken := range use.Lots {
+			if taken.ExpiresAt != nil && !now.Before(*taken.ExpiresAt) {
+				continue
+			}
+			i := findLot(acc, taken.ID)
+			if i < 0 {
+				// Emptied lots are dropped; put it back
+				lot := taken
+				lot.Remaining = 0
+				acc.Lots = append(acc.Lots, lot)
+				i = len(acc.Lots) - 1
+			}
+			acc.Lots[i].Remaining += taken.Remaining
+			entries = append(entries, ledgerEntry(acc, models.LedgerRefund, acc.Lots[i], taken.Remaining, use.Ref, "", now))
+		}
+		return entries, nil
+	})
+	return err
+}
+
+// updateCreditAccount loads the user's account, brings it up to date
+// (expiry and monthly allowance), applies change and saves it if anything
+// changed, retrying when a concurrent update wins. change may be nil.
+//
+// The ledger entries are saved in the account's PendingLedger in the same
+// write as the change, then copied to the ledger under keys derived from
+// the account version, and cleared. Entries a crash left pending are
+// copied by the next update; copying one twice is a no-op.
+func updateCreditAccount(ctx context.Context, userID, plan string, change func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error)) (*models.CreditAccount, error) {
+	coll := GetCollection(config.DBName, creditAccountsCollection)
+	for i := 0; i < creditUpdateRetries; i++ {
+		now := time.Now()
+		acc := &models.CreditAccount{UserID: userID}
+		err := coll.FindOne(ctx, bson.M{"user_id": userID}).Decode(acc)
+		isNew := errors.Is(err, mongo.ErrNoDocuments)
+		if err != nil && !isNew {
+			return nil, fmt.Errorf("load credits: %w", err)
+		}
+
+		if len(acc.PendingLedger) > 0 {
+			flushCreditLedger(ctx, acc)
+		}
+
+		entries := refreshCreditAccount(acc, plan, now)
+		if change != nil {
+			more, err := change(acc, now)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, more...)
+		}
+		if len(entries) == 0 {
+			return acc, nil
+		}
+		dropEmptyLots(acc)
+
+		version := acc.Version
+		acc.Version++
+		acc.UpdatedAt = now
+		for j := range entries {
+			entries[j].Key = fmt.Sprintf("%s:%d:%d", userID, acc.Version, j)
+		}
+		// Keep entries a failed copy left pending
+		acc.PendingLedger = append(acc.PendingLedger, entries...)
+		if isNew {
+			_, err = coll.InsertOne(ctx, acc)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+		} else {
+			var res *mongo.UpdateResult
+			res, err = coll.ReplaceOne(ctx, bson.M{"user_id": userID, "version": version}, acc)
+			if err == nil && res.MatchedCount == 0 {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("save credits: %w", err)
+		}
+
+		flushCreditLedger(ctx, acc)
+		return acc, nil
+	}
+	return nil, fmt.Errorf("save credits: too many concurrent updates")
+}
+
+// flushCreditLedger copies acc's pending ledger entries to the ledger and
+// clears them from the account, unless it has changed since. Failures are
+// logged; the entries stay pending for the next update.
+func flushCreditLedger(ctx context.Context, acc *models.CreditAccount) {
+	docs := make([]interface{}, len(acc.PendingLedger))
+	for j := range acc.PendingLedger {
+		docs[j] = acc.PendingLedger[j]
+	}
+	_, err := GetCollection(config.DBName, creditLedgerCollection).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		// Entries copied before are duplicates; anything else is a failure
+		err = nil
+		for _, we := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(we) {
+				err = bulkErr
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("[Credits] failed to write %d ledger entries for %s: %v\n", len(docs), acc.UserID, err)
+		return
+	}
+	_, err = GetCollection(config.DBName, creditAccountsCollection).UpdateOne(ctx,
+		bson.M{"user_id": acc.UserID, "version": acc.Version},
+		bson.M{"$unset": bson.M{"pending_ledger": ""}})
+	if err != nil {
+		fmt.Printf("[Credits] failed to clear pending ledger entries for %s: %v\n", acc.UserID, err)
+	}
+	acc.PendingLedger = nil
+}
+
+// refreshCreditAccount expires lots past their date and grants the plan's
+// allowance once per month (or when the plan changes to one with a bigger
+// allowance mid-month).
+func refreshCreditAccount(acc *models.CreditAccount, plan string, now time.Time) []models.CreditLedgerEntry {
+	var entries []models.CreditLedgerEntry
+	var expired []models.CreditLot
+	kept := acc.Lots[:0]
+	for _, lot := range acc.Lots {
+		if lot.ExpiresAt != nil && !now.Before(*lot.ExpiresAt) {
+			if lot.Remaining > 0 {
+				expired = append(expired, lot)
+			}
+			continue
+		}
+		kept = append(kept, lot)
+	}
+	acc.Lots = kept
+	balance := creditTotal(acc)
+	for _, lot := range expired {
+		balance += lot.Remaining
+	}
+	for _, lot := range expired {
+		balance -= lot.Remaining
+		entry := ledgerEntry(acc, models.LedgerExpire, lot, -lot.Remaining, "", "", now)
+		entry.Balance = balance
+		entries = append(entries, entry)
+	}
+
+	period := now.UTC().Format("2006-01")
+	allowance := models.MonthlyAllowanceForPlan(plan)
+	if acc.AllowancePeriod == period && models.MonthlyAllowanceForPlan(acc.AllowancePlan) >= allowance {
+		return entries
+	}
+	newPeriod := acc.AllowancePeriod != period
+	acc.AllowancePeriod = period
+	acc.AllowancePlan = plan
+	if allowance <= 0 {
+		return entries
+	}
+	if !newPeriod {
+		// Upgraded mid-month: replace the smaller allowance
+		for i := range acc.Lots {
+			if acc.Lots[i].Source == models.CreditSourceAllowance && acc.Lots[i].Remaining > 0 {
+				lot := acc.Lots[i]
+				acc.Lots[i].Remaining = 0
+				entries = append(entries, ledgerEntry(acc, models.LedgerExpire, acc.Lots[i], -lot.Remaining, "", "replaced by "+plan+" allowance", now))
+			}
+		}
+	}
+	y, m, _ := now.UTC().Date()
+	expires := time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+	lot := models.CreditLot{
+		ID:        primitive.NewObjectID().Hex(),
+		Source:    models.CreditSourceAllowance,
+		Units:     allowance,
+		Remaining: allowance,
+		ExpiresAt: &expires,
+		Ref:       "allowance:" + plan + ":" + period,
+		CreatedAt: now,
+	}
+	acc.Lots = append(acc.Lots, lot)
+	entries = append(entries, ledgerEntry(acc, models.LedgerGrant, lot, allowance, lot.Ref, plan+" monthly allowance", now))
+	return entries
+}
+
+// ledgerEntry records a change already applied to acc; Balance is acc's
+// total afterwards.
+func ledgerEntry(acc *models.CreditAccount, kind string, lot models.CreditLot, units int, ref, note string, now time.Time) models.CreditLedgerEntry {
+	return models.CreditLedgerEntry{
+		UserID:    acc.UserID,
+		Kind:      kind,
+		Source:    lot.Source,
+		LotID:     lot.ID,
+		Units:     units,
+		Balance:   creditTotal(acc),
+		Ref:       ref,
+		Note:      note,
+		CreatedAt: now,
+	}
+}
+
+func creditTotal(acc *models.CreditAccount) int {
+	total := 0
+	for _, lot := range acc.Lots {
+		total += lot.Remaining
+	}
+	return total
+}
+
+func findLot(acc *models.CreditAccount, id string) int {
+	for i := range acc.Lots {
+		if acc.Lots[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func dropEmptyLots(acc *models.CreditAccount) {
+	kept := acc.Lots[:0]
+	for _, lot := range acc.Lots {
+		if lot.Remaining > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	acc.Lots = kept
+}
+
+// ListCreditLedger returns the user's most recent ledger entries, newest
+// first.
+func ListCreditLedger(ctx context.Context, userID string, limit int64) ([]models.CreditLedgerEntry, error) {
+	cursor, err := GetCollection(config.DBName, creditLedgerCollection).Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.CreditLedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRefreshCreditAccount(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	monthStart := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+
+	// By default plus grants 100 credits a month and free none
+	tests := []struct {
+		name        string
+		acc         models.CreditAccount
+		plan        string
+		wantKinds   []string
+		wantBalance int
+	}{
+		{
+			name:        "first allowance",
+			plan:        models.PlanPlus,
+			wantKinds:   []string{models.LedgerGrant},
+			wantBalance: 100,
+		},
+		{
+			name:        "allowance already granted this month",
+			acc:         models.CreditAccount{AllowancePeriod: "2026-03", AllowancePlan: models.PlanPlus, Lots: []models.CreditLot{{Source: models.CreditSourceAllowance, Remaining: 40, ExpiresAt: &nextMonth}}},
+			plan:        models.PlanPlus,
+			wantBalance: 40,
+		},
+		{
+			name:        "new month expires the old allowance",
+			acc:         models.CreditAccount{AllowancePeriod: "2026-02", AllowancePlan: models.PlanPlus, Lots: []models.CreditLot{{Source: models.CreditSourceAllowance, Remaining: 30, ExpiresAt: &monthStart}}},
+			plan:        models.PlanPlus,
+			wantKinds:   []string{models.LedgerExpire, models.LedgerGrant},
+			wantBalance: 100,
+		},
+		{
+			name:        "expired pack on a plan without allowance",
+			acc:         models.CreditAccount{AllowancePeriod: "2026-03", AllowancePlan: models.PlanFree, Lots: []models.CreditLot{{Source: models.CreditSourcePack, Remaining: 5, ExpiresAt: &yesterday}, {Source: models.CreditSourcePromo, Remaining: 3}}},
+			plan:        models.PlanFree,
+			wantKinds:   []string{models.LedgerExpire},
+			wantBalance: 3,
+		},
+		{
+			name:        "upgrade mid-month",
+			acc:         models.CreditAccount{AllowancePeriod: "2026-03", AllowancePlan: models.PlanFree},
+			plan:        models.PlanPlus,
+			wantKinds:   []string{models.LedgerGrant},
+			wantBalance: 100,
+		},
+		{
+			name:        "downgrade mid-month keeps the allowance",
+			acc:         models.CreditAccount{AllowancePeriod: "2026-03", AllowancePlan: models.PlanPlus, Lots: []models.CreditLot{{Source: models.CreditSourceAllowance, Remaining: 60, ExpiresAt: &nextMonth}}},
+			plan:        models.PlanFree,
+			wantBalance: 60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := tt.acc
+			entries := refreshCreditAccount(&acc, tt.plan, now)
+
+			var kinds []string
+			for _, e := range entries {
+				kinds = append(kinds, e.Kind)
+			}
+			if !slices.Equal(kinds, tt.wantKinds) {
+				t.Errorf("entries = %v, want %v", kinds, tt.wantKinds)
+			}
+			if got := creditTotal(&acc); got != tt.wantBalance {
+				t.Errorf("balance = %d, want %d", got, tt.wantBalance)
+			}
+			if len(entries) > 0 && entries[len(entries)-1].Balance != tt.wantBalance {
+				t.Errorf("last entry balance = %d, want %d", entries[len(entries)-1].Balance, tt.wantBalance)
+			}
+			if acc.AllowancePeriod != "2026-03" {
+				t.Errorf("allowance period = %q, want 2026-03", acc.AllowancePeriod)
+			}
+			for _, lot := range acc.Lots {
+				if lot.Source == models.CreditSourceAllowance && lot.Remaining > 0 && !lot.ExpiresAt.Equal(nextMonth) {
+					t.Errorf("allowance expires %v, want %v", lot.ExpiresAt, nextMonth)
+				}
+			}
+		})
+	}
+}
+
+// loadCreditAccount reads userID's saved account.
+func loadCreditAccount(t *testing.T, userID string) models.CreditAccount {
+	t.Helper()
+	var acc models.CreditAccount
+	err := GetCollection(config.DBName, creditAccountsCollection).FindOne(context.Background(), bson.M{"user_id": userID}).Decode(&acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+// ledgerKeys returns the keys of userID's ledger entries, oldest first.
+func ledgerKeys(t *testing.T, userID string) []string {
+	t.Helper()
+	cur, err := GetCollection(config.DBName, creditLedgerCollection).Find(context.Background(),
+		bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "key", Value: 1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []models.CreditLedgerEntry
+	if err := cur.All(context.Background(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+func TestUpdateCreditAccountVersioning(t *testing.T) {
+	testMongo(t)
+	if err := EnsureCreditIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	grant := func(units int, ref string) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+		return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+			lot := models.CreditLot{ID: ref, Source: models.CreditSourcePromo, Units: units, Remaining: units, Ref: ref, CreatedAt: now}
+			acc.Lots = append(acc.Lots, lot)
+			return []models.CreditLedgerEntry{ledgerEntry(acc, models.LedgerGrant, lot, units, ref, "", now)}, nil
+		}
+	}
+
+	tests := []struct {
+		name string
+		// change is applied to an account that already holds 10 credits
+		// at version 1. A concurrent update is simulated by updating the
+		// account from inside it, before the save.
+		change      func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error)
+		wantErr     string
+		wantCalls   int
+		wantVersion int64
+		wantBalance int
+	}{
+		{
+			name: "change bumps the version",
+			change: func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+				return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+					*calls++
+					return grant(5, "b")(acc, now)
+				}
+			},
+			wantCalls:   1,
+			wantVersion: 2,
+			wantBalance: 15,
+		},
+		{
+			name: "no change keeps the version",
+			change: func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+				return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+					*calls++
+					return nil, nil
+				}
+			},
+			wantCalls:   1,
+			wantVersion: 1,
+			wantBalance: 10,
+		},
+		{
+			name: "failed change saves nothing",
+			change: func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+				return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+					*calls++
+					acc.Lots[0].Remaining = 0
+					return nil, ErrInsufficientCredits
+				}
+			},
+			wantErr:     ErrInsufficientCredits.Error(),
+			wantCalls:   1,
+			wantVersion: 1,
+			wantBalance: 10,
+		},
+		{
+			name: "concurrent update is retried on the new version",
+			change: func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+				return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+					*calls++
+					if *calls == 1 {
+						if _, err := updateCreditAccount(ctx, userID, models.PlanFree, grant(5, "concurrent")); err != nil {
+							return nil, err
+						}
+					}
+					return grant(7, "b")(acc, now)
+				}
+			},
+			wantCalls:   2,
+			wantVersion: 3,
+			wantBalance: 22,
+		},
+		{
+			name: "too many concurrent updates",
+			change: func(userID string, calls *int) func(*models.CreditAccount, time.Time) ([]models.CreditLedgerEntry, error) {
+				return func(acc *models.CreditAccount, now time.Time) ([]models.CreditLedgerEntry, error) {
+					*calls++
+					if _, err := updateCreditAccount(ctx, userID, models.PlanFree, grant(1, fmt.Sprintf("concurrent-%d", *calls))); err != nil {
+						return nil, err
+					}
+					return grant(7, "b")(acc, now)
+				}
+			},
+			wantErr:     "too many concurrent updates",
+			wantCalls:   creditUpdateRetries,
+			wantVersion: 1 + creditUpdateRetries,
+			wantBalance: 10 + creditUpdateRetries,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := "user:" + t.Name()
+			if _, err := updateCreditAccount(ctx, userID, models.PlanFree, grant(10, "a")); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := 0
+			_, err := updateCreditAccount(ctx, userID, models.PlanFree, tt.change(userID, &calls))
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("change called %d times, want %d", calls, tt.wantCalls)
+			}
+
+			acc := loadCreditAccount(t, userID)
+			if acc.Version != tt.wantVersion || creditTotal(&acc) != tt.wantBalance {
+				t.Errorf("version %d, balance %d; want %d, %d", acc.Version, creditTotal(&acc), tt.wantVersion, tt.wantBalance)
+			}
+			if len(acc.PendingLedger) != 0 {
+				t.Errorf("%d ledger entries left pending", len(acc.PendingLedger))
+			}
+			// One entry per saved version, keyed by it
+			var want []string
+			for v := int64(1); v <= acc.Version; v++ {
+				want = append(want, fmt.Sprintf("%s:%d:0", userID, v))
+			}
+			if got := ledgerKeys(t, userID); !slices.Equal(got, want) {
+				t.Errorf("ledger keys = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFlushCreditLedgerTwiceIsNoop(t *testing.T) {
+	testMongo(t)
+	if err := EnsureCreditIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	userID := "user:flush-twice"
+	if err := GrantCredits(ctx, userID, models.PlanFree, CreditGrant{Source: models.CreditSourcePromo, Units: 3, Ref: "promo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash after the copy but before the pending entries were cleared
+	acc := loadCreditAccount(t, userID)
+	acc.PendingLedger = []models.CreditLedgerEntry{{UserID: userID, Key: userID + ":1:0", Kind: models.LedgerGrant, Units: 3}}
+	if _, err := GetCollection(config.DBName, creditAccountsCollection).ReplaceOne(ctx, bson.M{"user_id": userID}, acc); err != nil {
+		t.Fatal(err)
+	}
+	flushCreditLedger(ctx, &acc)
+
+	if got := ledgerKeys(t, userID); !slices.Equal(got, []string{userID + ":1:0"}) {
+		t.Errorf("ledger keys = %v, want the entry once", got)
+	}
+	if acc := loadCreditAccount(t, userID); len(acc.PendingLedger) != 0 {
+		t.Errorf("%d ledger entries left pending", len(acc.PendingLedger))
+	}
+
+	// The grant's ref was applied, so granting it again does nothing
+	if err := GrantCredits(ctx, userID, models.PlanFree, CreditGrant{Source: models.CreditSourcePromo, Units: 3, Ref: "promo"}); err != nil {
+		t.Fatal(err)
+	}
+	if acc := loadCreditAccount(t, userID); creditTotal(&acc) != 3 {
+		t.Errorf("balance = %d after a repeated grant, want 3", creditTotal(&acc))
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/raushankrgupta/web-product-scraper/config"
 	"google.golang.org/api/option"
 )
 
@@ -75,35 +74,45 @@ func callGemini(ctx context.Context, model *genai.GenerativeModel, label string,
 				fmt.Printf("[Gemini] %s candidate blocked: finish_reason=%s\n", label, be.Candidate.FinishReason)
 			}
 		}
-		return nil, fmt.Errorf("failed to generate content: %v", err)
+		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
 
 	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
 		return nil, fmt.Errorf("no content generated")
 	}
 
+	// Prefer an image part; fall back to the first text part
+	var text []byte
 	for _, part := range resp.Candidates[0].Content.Parts {
 		switch p := part.(type) {
 		case genai.Text:
 			fmt.Printf("[Gemini] %s response type: TEXT (%d bytes)\n", label, len(p))
-			return []byte(p), nil
+			if text == nil {
+				text = []byte(p)
+			}
 		case genai.Blob:
 			fmt.Printf("[Gemini] %s response type: IMAGE (%d bytes, %s)\n", label, len(p.Data), p.MIMEType)
 			return p.Data, nil
-		default:
-			return []byte(fmt.Sprintf("%v", p)), nil
 		}
 	}
+	if text != nil {
+		return text, nil
+	}
 
 	return nil, fmt.Errorf("unexpected response format (empty content)")
 }
 
+// ErrSafetyBlocked marks a generation refused by a safety or moderation
+// filter. Gemini reports these as *genai.BlockedError instead.
+var ErrSafetyBlocked = errors.New("blocked by safety filter")
+
+// ErrNoImage is returned by the image generators when the model answered
+// with text only.
+var ErrNoImage = errors.New("model returned no image")
+
 func isSafetyBlock(err error) bool {
-	if err == nil {
-		return false
-	}
-	s := strings.ToLower(err.Error())
-	return strings.Contains(s, "blocked") || strings.Contains(s, "blockreason") || strings.Contains(s, "block_reason")
+	var be *genai.BlockedError
+	return errors.As(err, &be) || errors.Is(err, ErrSafetyBlocked)
 }
 
 // individualTryOnPrompt is the prompt used by the individual try-on
@@ -122,7 +131,10 @@ func isSafetyBlock(err error) bool {
 // well with the explicit "ignore the reference model's face/body" guidance.
 // If `terse` is true we emit a much shorter version used only as a retry
 // after a safety block — fewer words = fewer trigger surfaces.
-func individualTryOnPrompt(details, themeDescription string, terse bool) string {
+//
+// referencePhotos is the number of extra customer photos sent after IMAGE 1
+// (identity references); the terse retry never sends them.
+func individualTryOnPrompt(details, themeDescription string, referencePhotos int, terse bool) string {
 	if terse {
 		var sb strings.Builder
 		sb.WriteString("Fashion photo: the customer (image 1) wearing the garment from the reference photo(s). ")
@@ -137,6 +149,10 @@ func individualTryOnPrompt(details, themeDescription string, terse bool) string
 	sb.WriteString("IMAGE 1 — Customer:\n")
 	sb.WriteString("  Keep the customer's face, hair, skin tone, body shape, and pose exactly as shown.\n")
 	sb.WriteString("  Do not alter the customer's identity.\n\n")
+	if referencePhotos > 0 {
+		fmt.Fprintf(&sb, "IMAGES 2-%d — More photos of the same customer:\n", referencePhotos+1)
+		sb.WriteString("  Use them only to get the customer's face and body right. Keep the pose and framing of IMAGE 1.\n\n")
+	}
 	sb.WriteString("REMAINING IMAGES — Product reference:\n")
 	sb.WriteString("  These show the garment to be worn. If a model is shown wearing it, the model is only a visual reference for how the product looks.\n")
 	sb.WriteString("  Use the reference ONLY for the garment's color, pattern, fabric, cut, and details. Do not copy the reference model's face, body, or identity.\n\n")
@@ -170,7 +186,8 @@ func multiPersonTryOnPrompt(numPeople int, themeDescription string, terse bool)
 	fmt.Fprintf(&sb, "There are %d customers. For each customer I provide their photo followed by their garment reference image(s).\n\n", numPeople)
 	sb.WriteString("FOR EACH CUSTOMER:\n")
 	sb.WriteString("  Keep that customer's face, hair, skin tone, body shape, and pose exactly as shown.\n")
-	sb.WriteString("  Do not alter or merge the customers' identities.\n\n")
+	sb.WriteString("  Do not alter or merge the customers' identities.\n")
+	sb.WriteString("  A customer's photo may be followed by a second photo of the same customer, labelled as such. Use it only to get their face and body right.\n\n")
 	sb.WriteString("GARMENT REFERENCE IMAGES:\n")
 	sb.WriteString("  Show the garment to be worn by the preceding customer. If a model is shown wearing it, the model is only a visual reference for how the product looks.\n")
 	sb.WriteString("  Use the reference ONLY for the garment's color, pattern, fabric, cut, and details. Do not copy the reference model's face, body, or identity.\n\n")
@@ -183,32 +200,10 @@ func multiPersonTryOnPrompt(numPeople int, themeDescription string, terse bool)
 	return sb.String()
 }
 
-// GenerateTryOnImage generates a virtual try-on image using Gemini
-func GenerateTryOnImage(ctx context.Context, personImageURL string, productImages []string, dimensions string, personDetails string) ([]byte, error) {
-	if config.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY is not set")
-	}
-
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.GeminiAPIKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	defer client.Close()
-
-	model := client.GenerativeModel("gemini-3-pro-image-preview")
-	// Note: "gemini-nano-banana" or "gemini-3-pro-image-preview" mentioned in prompt might be placeholders or specific preview models.
-	// We'll use a standard capable model. If specifically "gemini-1.5-pro" or similar is needed for vision + text -> image (if supported directly or via description).
-	// Wait, the user asked for "gemini-3-pro-image-preview". I should probably check if that's a valid model or use a standard one.
-	// Given the prompt "gemini nano banana (gemini-3-pro-image-preview)", I'll stick to a known working model for now, or try to use the requested one if it's a valid string.
-	// For now, let's use "gemini-1.5-pro" as it's the current standard for multimodal.
-	// If the user specifically wants image GENERATION, we might need a specific model or tool.
-	// Standard Gemini models generate text. For image generation, we might need to use a different endpoint or model if available in this SDK.
-	// However, assuming the user implies a multimodal capability where we send images and get an image back (or a description to generate one).
-	// The prompt says "After we get results from gemini send it as api response".
-	// If the model returns an image, we need to handle that.
-	// The Go SDK for Gemini supports generating content.
-
-	// Let's construct the prompt.
+// productTryOnPrompt is the prompt of the legacy product try-on (POST
+// /try-on). personPhotos is how many photos of the person precede the
+// product images.
+func productTryOnPrompt(personDetails, dimensions string, personPhotos int) string {
 	prompt := fmt.Sprintf(`
 I want the cloths product images to be worn by the person's image provided.
 Use the dimensions to accurately demonstrate how this will look upon the user.
@@ -218,17 +213,83 @@ Show 100%% truth, do not change the person's image with new person's image in du
 Person Details: %s
 Dimensions: %s
 `, personDetails, dimensions)
+	if personPhotos > 1 {
+		prompt += fmt.Sprintf("The first %d images are photos of the same person. Dress the person as in the first photo; the others only show what they look like.\n", personPhotos)
+	}
+	return prompt
+}
+
+// GeminiGenerator is the ImageGenerator backed by the Gemini image models.
+type GeminiGenerator struct {
+	// Policy picks the model and API key of each attempt and retries
+	// transient failures. Nil uses DefaultGenerationPolicy.
+	Policy *GenerationPolicy
+}
+
+// generate runs parts through runGeminiPolicy under the generation
+// policy, failing attempts that return no image.
+func (g *GeminiGenerator) generate(ctx context.Context, label string, parts []genai.Part, retryParts func() []genai.Part) ([]byte, error) {
+	policy := g.Policy
+	if policy == nil {
+		policy = DefaultGenerationPolicy()
+	}
+	return runGeminiPolicy(ctx, policy, label, parts, retryParts, func(out []byte) error {
+		if !strings.HasPrefix(http.DetectContentType(out), "image/") {
+			return fmt.Errorf("%w: %.200s", ErrNoImage, out)
+		}
+		return nil
+	})
+}
+
+// runGeminiPolicy runs parts through runGemini under policy: each attempt
+// opens a client with the attempt's key and model, so a quota error on one
+// key or an outage of one model falls through to the next. check, when
+// set, rejects an output, failing its attempt.
+func runGeminiPolicy(ctx context.Context, policy *GenerationPolicy, label string, parts []genai.Part, retryParts func() []genai.Part, check func(out []byte) error) ([]byte, error) {
+	return policy.Run(ctx, label, func(ctx context.Context, modelName, apiKey string) ([]byte, error) {
+		if apiKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is not set")
+		}
+		client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+		}
+		defer client.Close()
+
+		model := client.GenerativeModel(modelName)
+		model.SafetySettings = permissiveSafetySettings()
+		out, err := runGemini(ctx, model, label, parts, retryParts)
+		if err == nil && check != nil {
+			if err := check(out); err != nil {
+				return nil, err
+			}
+		}
+		return out, err
+	})
+}
 
+// GenerateProductTryOn implements ImageGenerator.
+func (g *GeminiGenerator) GenerateProductTryOn(ctx context.Context, personImageURLs []string, productImages []string, dimensions string, personDetails string) ([]byte, error) {
 	// Fetch images
-	personImgData, err := fetchImage(personImageURL)
+	if len(personImageURLs) == 0 {
+		return nil, fmt.Errorf("no person image provided")
+	}
+	personImgData, err := fetchImage(personImageURLs[0])
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch person image: %v", err)
 	}
 
-	parts := []genai.Part{
-		genai.Text(prompt),
+	images := []genai.Part{
 		genai.ImageData("jpeg", personImgData), // Assuming JPEG for now, ideally detect type
 	}
+	for _, url := range personImageURLs[1:] {
+		if refData, err := fetchImage(url); err == nil {
+			images = append(images, genai.ImageData("jpeg", refData))
+		}
+	}
+	// The prompt counts the person photos actually attached, not requested
+	prompt := productTryOnPrompt(personDetails, dimensions, len(images))
+	parts := append([]genai.Part{genai.Text(prompt)}, images...)
 
 	for _, url := range productImages {
 		if url == "" {
@@ -240,36 +301,7 @@ Dimensions: %s
 		}
 	}
 
-	resp, err := model.GenerateContent(ctx, parts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no content generated")
-	}
-
-	// Check if we got an image back?
-	// Currently, Gemini API mainly returns text unless using specific image generation capabilities which might return a link or base64.
-	// If the model is a text-only model, this won't work for image generation.
-	// If the user expects an image, we might be using the wrong tool or model if we just expect "GenerateContent" to return an image directly without specific setup.
-	// BUT, for the sake of this task, we will assume the model returns the image data or we handle the text response.
-	// If the response contains an image part, we extract it.
-
-	for _, part := range resp.Candidates[0].Content.Parts {
-		switch p := part.(type) {
-		case genai.Text:
-			return []byte(p), nil
-		case genai.Blob:
-			return p.Data, nil
-		default:
-			errMsg := fmt.Sprintf("Received unexpected part type: %T", p)
-			fmt.Println(errMsg)
-			return []byte(fmt.Sprintf("%v", p)), nil
-		}
-	}
-
-	return nil, fmt.Errorf("unexpected response format (empty content)")
+	return g.generate(ctx, "product try-on", parts, nil)
 }
 
 func fetchImage(pathOrURL string) ([]byte, error) {
@@ -289,10 +321,12 @@ func fetchImage(pathOrURL string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
-func fetchImageLogged(label, url string) ([]byte, string, error) {
+// fetchImageLogged fetches an image and sniffs its type ("jpeg", "png" or
+// "webp"), logging the outcome under source, the backend fetching it.
+func fetchImageLogged(source, label, url string) ([]byte, string, error) {
 	data, err := fetchImage(url)
 	if err != nil {
-		fmt.Printf("[Gemini] FAILED to fetch %s image: %v (url prefix: %.80s...)\n", label, err, url)
+		fmt.Printf("[%s] FAILED to fetch %s image: %v (url prefix: %.80s...)\n", source, label, err, url)
 		return nil, "", err
 	}
 	mime := "jpeg"
@@ -303,51 +337,31 @@ func fetchImageLogged(label, url string) ([]byte, string, error) {
 			mime = "webp"
 		}
 	}
-	fmt.Printf("[Gemini] Fetched %s image OK (%d bytes, %s)\n", label, len(data), mime)
+	fmt.Printf("[%s] Fetched %s image OK (%d bytes, %s)\n", source, label, len(data), mime)
 	return data, mime, nil
 }
 
 // PersonTryOnData holds the presigned URLs and details for a person in a try-on session
 type PersonTryOnData struct {
-	Details        string
-	PersonImageURL string
-	TopURL         []string
-	BottomURL      []string
-	AccessoryURL   []string
-	DressURL       []string
-}
-
-// GenerateMultiPersonTryOnImage generates a multi-person virtual try-on image using Gemini.
-// `themeReferenceURL` is accepted but ignored (kept for caller signature parity).
-func GenerateMultiPersonTryOnImage(ctx context.Context, tryOnType string, themeImageURL, _, themeDescription string, people []PersonTryOnData) ([]byte, error) {
-	return generateMultiPersonTryOn(ctx, tryOnType+" try-on", themeImageURL, themeDescription, people)
+	Details            string
+	PersonImageURL     string
+	ReferenceImageURLs []string // Other photos of the same person, for identity only
+	TopURL             []string
+	BottomURL          []string
+	AccessoryURL       []string
+	DressURL           []string
 }
 
-// GenerateCoupleTryOnImage generates a virtual try-on image specifically structured for exactly 2 people (a couple).
-func GenerateCoupleTryOnImage(ctx context.Context, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
-	if len(people) != 2 {
-		return nil, fmt.Errorf("GenerateCoupleTryOnImage requires exactly 2 people")
-	}
-	return generateMultiPersonTryOn(ctx, "couple try-on", themeImageURL, themeDescription, people)
+// GenerateGroup implements ImageGenerator.
+func (g *GeminiGenerator) GenerateGroup(ctx context.Context, tryOnType, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
+	return g.generateMultiPersonTryOn(ctx, tryOnType+" try-on", themeImageURL, themeDescription, people)
 }
 
-func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
-	if config.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY is not set")
-	}
+func (g *GeminiGenerator) generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
 	if len(people) == 0 {
 		return nil, fmt.Errorf("no people provided")
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.GeminiAPIKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	defer client.Close()
-
-	model := client.GenerativeModel("gemini-3-pro-image-preview")
-	model.SafetySettings = permissiveSafetySettings()
-
 	type img struct {
 		mime string
 		data []byte
@@ -355,6 +369,7 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 	type personImgs struct {
 		details     string
 		person      *img
+		references  []img
 		tops        []img
 		bottoms     []img
 		dresses     []img
@@ -364,7 +379,7 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 	fetchAll := func(label string, urls []string) []img {
 		out := make([]img, 0, len(urls))
 		for _, u := range urls {
-			if b, mime, err := fetchImageLogged(label, u); err == nil {
+			if b, mime, err := fetchImageLogged("Gemini", label, u); err == nil {
 				out = append(out, img{mime: mime, data: b})
 			}
 		}
@@ -377,10 +392,11 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 		var pi personImgs
 		pi.details = p.Details
 		if p.PersonImageURL != "" {
-			if b, mime, err := fetchImageLogged(tag+"-photo", p.PersonImageURL); err == nil {
+			if b, mime, err := fetchImageLogged("Gemini", tag+"-photo", p.PersonImageURL); err == nil {
 				pi.person = &img{mime: mime, data: b}
 			}
 		}
+		pi.references = fetchAll(tag+"-reference", p.ReferenceImageURLs)
 		pi.tops = fetchAll(tag+"-top", p.TopURL)
 		pi.bottoms = fetchAll(tag+"-bottom", p.BottomURL)
 		pi.dresses = fetchAll(tag+"-dress", p.DressURL)
@@ -389,7 +405,7 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 	}
 	var themeImg *img
 	if themeImageURL != "" {
-		if b, mime, err := fetchImageLogged("theme-background", themeImageURL); err == nil {
+		if b, mime, err := fetchImageLogged("Gemini", "theme-background", themeImageURL); err == nil {
 			themeImg = &img{mime: mime, data: b}
 		}
 	}
@@ -409,14 +425,20 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 			}
 			if pi.person != nil {
 				parts = append(parts, genai.ImageData(pi.person.mime, pi.person.data))
+				if !terse {
+					for _, ref := range pi.references {
+						parts = append(parts, genai.Text(fmt.Sprintf("Second photo of %s (identity reference only):", tag)))
+						parts = append(parts, genai.ImageData(ref.mime, ref.data))
+					}
+				}
 			}
 			remaining := perPersonGarmentLimit
 			appendGarments := func(gs []img) {
-				for _, g := range gs {
+				for _, garment := range gs {
 					if remaining == 0 {
 						return
 					}
-					parts = append(parts, genai.ImageData(g.mime, g.data))
+					parts = append(parts, genai.ImageData(garment.mime, garment.data))
 					if remaining > 0 {
 						remaining--
 					}
@@ -445,24 +467,11 @@ func generateMultiPersonTryOn(ctx context.Context, label, themeImageURL, themeDe
 	}
 	fmt.Printf("[Gemini] %s: sending %d images in %d parts to model\n", label, imgCount, len(primary))
 
-	return runGemini(ctx, model, label, primary, retry)
+	return g.generate(ctx, label, primary, retry)
 }
 
-// GenerateIndividualTryOnImage generates a virtual try-on image specifically structured for exactly 1 person.
-func GenerateIndividualTryOnImage(ctx context.Context, themeImageURL, themeDescription string, person PersonTryOnData) ([]byte, error) {
-	if config.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY is not set")
-	}
-
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.GeminiAPIKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	defer client.Close()
-
-	model := client.GenerativeModel("gemini-3-pro-image-preview")
-	model.SafetySettings = permissiveSafetySettings()
-
+// GenerateIndividual implements ImageGenerator.
+func (g *GeminiGenerator) GenerateIndividual(ctx context.Context, themeImageURL, themeDescription string, person PersonTryOnData) ([]byte, error) {
 	// Resolve images up front so we can pass them to both the primary
 	// attempt and any retry without re-downloading.
 	type img struct {
@@ -471,26 +480,27 @@ func GenerateIndividualTryOnImage(ctx context.Context, themeImageURL, themeDescr
 	}
 	var personImg *img
 	if person.PersonImageURL != "" {
-		if b, mime, err := fetchImageLogged("person", person.PersonImageURL); err == nil {
+		if b, mime, err := fetchImageLogged("Gemini", "person", person.PersonImageURL); err == nil {
 			personImg = &img{mime: mime, data: b}
 		}
 	}
 	fetchAll := func(label string, urls []string) []img {
 		out := make([]img, 0, len(urls))
 		for _, u := range urls {
-			if b, mime, err := fetchImageLogged(label, u); err == nil {
+			if b, mime, err := fetchImageLogged("Gemini", label, u); err == nil {
 				out = append(out, img{mime: mime, data: b})
 			}
 		}
 		return out
 	}
+	references := fetchAll("person-reference", person.ReferenceImageURLs)
 	tops := fetchAll("top", person.TopURL)
 	bottoms := fetchAll("bottom", person.BottomURL)
 	dresses := fetchAll("dress", person.DressURL)
 	accessories := fetchAll("accessory", person.AccessoryURL)
 	var themeImg *img
 	if themeImageURL != "" {
-		if b, mime, err := fetchImageLogged("theme-background", themeImageURL); err == nil {
+		if b, mime, err := fetchImageLogged("Gemini", "theme-background", themeImageURL); err == nil {
 			themeImg = &img{mime: mime, data: b}
 		}
 	}
@@ -501,15 +511,22 @@ func GenerateIndividualTryOnImage(ctx context.Context, themeImageURL, themeDescr
 	}
 
 	buildParts := func(terse bool, garmentLimit int) []genai.Part {
-		parts := []genai.Part{genai.Text(individualTryOnPrompt(person.Details, themeDescription, terse))}
+		refs := references
+		if terse {
+			refs = nil
+		}
+		parts := []genai.Part{genai.Text(individualTryOnPrompt(person.Details, themeDescription, len(refs), terse))}
 		parts = append(parts, genai.ImageData(personImg.mime, personImg.data))
+		for _, ref := range refs {
+			parts = append(parts, genai.ImageData(ref.mime, ref.data))
+		}
 		remaining := garmentLimit
 		appendGarments := func(gs []img) {
-			for _, g := range gs {
+			for _, garment := range gs {
 				if remaining == 0 {
 					return
 				}
-				parts = append(parts, genai.ImageData(g.mime, g.data))
+				parts = append(parts, genai.ImageData(garment.mime, garment.data))
 				if remaining > 0 {
 					remaining--
 				}
@@ -527,8 +544,8 @@ func GenerateIndividualTryOnImage(ctx context.Context, themeImageURL, themeDescr
 	}
 
 	primary := buildParts(false, -1)
-	// Retry strategy: drop "Person Details", drop theme, keep only the first
-	// garment image, use the terse prompt. Lowest possible trigger surface
+	// Retry strategy: drop "Person Details", drop theme and identity
+	// references, keep only the first garment image, use the terse prompt. Lowest possible trigger surface
 	// while still giving the model the bare minimum to do the job.
 	retry := func() []genai.Part { return buildParts(true, 1) }
 
@@ -540,5 +557,5 @@ func GenerateIndividualTryOnImage(ctx context.Context, themeImageURL, themeDescr
 	}
 	fmt.Printf("[Gemini] Individual try-on: sending %d images in %d parts to model\n", imgCount, len(primary))
 
-	return runGemini(ctx, model, "individual try-on", primary, retry)
+	return g.generate(ctx, "individual try-on", primary, retry)
 }
@@ -0,0 +1,356 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"google.golang.org/api/googleapi"
+)
+
+// GenerationPolicy decides how an image generation is attempted:
+//
+//   - Models are tried in order. A model moves on to the next after
+//     MaxAttempts transient failures (5xx, timeouts), a non-retryable error,
+//     or when its circuit breaker is open.
+//   - Transient failures are retried on the same model after an exponential
+//     backoff with full jitter, capped at MaxBackoff.
+//   - A quota error (429) switches to the next API key right away; once
+//     every key is exhausted the next model is tried.
+//   - A safety block ends the chain: the other models share the classifier.
+//
+// A policy is shared by all requests, so breaker and key state carry over.
+type GenerationPolicy struct {
+	Models         []string
+	APIKeys        []string
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	AttemptTimeout time.Duration
+
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	key      int // index of the key to start with; advances on quota errors
+}
+
+// circuitBreaker counts a model's consecutive transient failures. Once it
+// reaches the threshold the model is skipped until openUntil. After that
+// the breaker is half-open: a single probe call is let through, and its
+// outcome closes the breaker or reopens it.
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool // a half-open probe is in flight
+}
+
+// GenerateFunc makes one generation call with the given model and key.
+type GenerateFunc func(ctx context.Context, model, apiKey string) ([]byte, error)
+
+var (
+	defaultPolicyOnce  sync.Once
+	defaultPolicy      *GenerationPolicy
+	analysisPolicyOnce sync.Once
+	analysisPolicy     *GenerationPolicy
+)
+
+// DefaultGenerationPolicy is the Gemini policy built from config.
+func DefaultGenerationPolicy() *GenerationPolicy {
+	defaultPolicyOnce.Do(func() {
+		modelNames := append([]string{config.GeminiImageModel}, config.GeminiFallbackModels...)
+		defaultPolicy = NewGenerationPolicy(modelNames, config.GeminiAPIKeys)
+	})
+	return defaultPolicy
+}
+
+// DefaultAnalysisPolicy is the Gemini policy for reading photos
+// (measurement estimates, people detection). It rotates the same keys as
+// DefaultGenerationPolicy but keeps its own breakers, so analysis calls
+// don't trip try-on generation or the other way round.
+func DefaultAnalysisPolicy() *GenerationPolicy {
+	analysisPolicyOnce.Do(func() {
+		analysisPolicy = NewGenerationPolicy([]string{config.GeminiImageModel}, config.GeminiAPIKeys)
+	})
+	return analysisPolicy
+}
+
+// NewGenerationPolicy returns a policy over modelNames and apiKeys with the
+// retry and breaker settings from config.
+func NewGenerationPolicy(modelNames, apiKeys []string) *GenerationPolicy {
+	if len(apiKeys) == 0 {
+		apiKeys = []string{""} // let the call report the missing key
+	}
+	return &GenerationPolicy{
+		Models:           modelNames,
+		APIKeys:          apiKeys,
+		MaxAttempts:      max(config.GenerationMaxAttempts, 1),
+		BaseBackoff:      config.GenerationBackoff,
+		MaxBackoff:       config.GenerationMaxBackoff,
+		AttemptTimeout:   config.GenerationAttemptTimeout,
+		BreakerThreshold: config.BreakerThreshold,
+		BreakerCooldown:  config.BreakerCooldown,
+		breakers:         map[string]*circuitBreaker{},
+	}
+}
+
+// Run calls generate under the policy and returns the first success. Every
+// attempt is added to the AttemptRecorder on ctx, if any. The error is the
+// last attempt's, so callers can still match "429" or "blocked".
+func (p *GenerationPolicy) Run(ctx context.Context, label string, generate GenerateFunc) ([]byte, error) {
+	var lastErr error
+	for _, model := range p.Models {
+		if !p.allow(model) {
+			fmt.Printf("[Generation] %s: skipping %s, circuit open\n", label, model)
+			recordAttempt(ctx, models.GenerationAttempt{Model: model, StartedAt: time.Now(), Outcome: models.AttemptCircuitOpen})
+			if lastErr == nil {
+				lastErr = fmt.Errorf("model %s is unavailable (circuit open)", model)
+			}
+			continue
+		}
+
+		keysTried := 0
+		for attempt := 0; attempt < p.MaxAttempts; {
+			keyIndex := p.currentKey()
+			out, err := p.attempt(ctx, label, model, keyIndex, generate)
+			if err == nil {
+				return out, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			outcome := classifyGenerationError(err)
+			if outcome == models.AttemptBlocked {
+				return nil, err
+			}
+			if outcome == models.AttemptQuota {
+				// Quota is per key: rotate without counting an attempt
+				// until every key has been tried on this model.
+				keysTried++
+				if keysTried < len(p.APIKeys) {
+					p.rotateKey(keyIndex)
+					continue
+				}
+				break
+			}
+			if outcome == models.AttemptFailed || p.isOpen(model) {
+				break
+			}
+			attempt++
+			if attempt < p.MaxAttempts {
+				if err := sleepContext(ctx, p.backoff(attempt)); err != nil {
+					return nil, lastErr
+				}
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no image models configured")
+	}
+	return nil, lastErr
+}
+
+// attempt makes one call, records it and updates the model's breaker.
+func (p *GenerationPolicy) attempt(ctx context.Context, label, model string, keyIndex int, generate GenerateFunc) ([]byte, error) {
+	attemptCtx := ctx
+	if p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	out, err := generate(attemptCtx, model, p.APIKeys[keyIndex])
+
+	a := models.GenerationAttempt{
+		Model:      model,
+		KeyIndex:   keyIndex,
+		StartedAt:  started,
+		DurationMS: time.Since(started).Milliseconds(),
+		Outcome:    models.AttemptSucceeded,
+	}
+	if err != nil {
+		a.Outcome = classifyGenerationError(err)
+		a.Error = err.Error()
+		fmt.Printf("[Generation] %s: %s (key %d) %s after %dms: %v\n", label, model, keyIndex, a.Outcome, a.DurationMS, err)
+	}
+	recordAttempt(ctx, a)
+
+	p.recordResult(model, a.Outcome)
+	return out, err
+}
+
+// allow reports whether model's breaker lets a call through. Once the
+// cooldown is over only the first caller gets through, as the probe.
+func (p *GenerationPolicy) allow(model string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.breakers[model]
+	if b == nil || b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// isOpen reports whether model's breaker is open, without claiming the
+// half-open probe.
+func (p *GenerationPolicy) isOpen(model string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.breakers[model]
+	return b != nil && time.Now().Before(b.openUntil)
+}
+
+// recordResult updates model's breaker with an attempt's outcome. Only
+// transient failures count against the model: quota errors belong to the
+// key, and safety blocks and bad requests to the input.
+func (p *GenerationPolicy) recordResult(model, outcome string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.breakers == nil {
+		p.breakers = map[string]*circuitBreaker{}
+	}
+	b := p.breakers[model]
+	if b == nil {
+		b = &circuitBreaker{}
+		p.breakers[model] = b
+	}
+	b.probing = false
+	if outcome == models.AttemptSucceeded {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	if outcome != models.AttemptTransient {
+		return
+	}
+	b.failures++
+	if p.BreakerThreshold > 0 && b.failures >= p.BreakerThreshold {
+		b.openUntil = time.Now().Add(p.BreakerCooldown)
+		fmt.Printf("[Generation] circuit open for %s after %d failures (cooldown %s)\n", model, b.failures, p.BreakerCooldown)
+	}
+}
+
+func (p *GenerationPolicy) currentKey() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.key % len(p.APIKeys)
+}
+
+// rotateKey moves past from, unless a concurrent request already did.
+func (p *GenerationPolicy) rotateKey(from int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.key%len(p.APIKeys) == from {
+		p.key = (from + 1) % len(p.APIKeys)
+	}
+}
+
+// backoff is the delay before retry n (1-based): a random duration up to
+// BaseBackoff * 2^(n-1), capped at MaxBackoff.
+func (p *GenerationPolicy) backoff(n int) time.Duration {
+	d := p.BaseBackoff << (n - 1)
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// classifyGenerationError maps an error to the attempt outcome that
+// decides what Run does next. It goes by the error's type and the API's
+// status code, never by the message.
+func classifyGenerationError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.AttemptTransient
+	}
+	if isSafetyBlock(err) {
+		return models.AttemptBlocked
+	}
+	if status, ok := generationStatus(err); ok {
+		switch {
+		case status == http.StatusTooManyRequests:
+			return models.AttemptQuota
+		case status == http.StatusRequestTimeout, status >= 500:
+			return models.AttemptTransient
+		}
+		return models.AttemptFailed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return models.AttemptTransient
+	}
+	return models.AttemptFailed
+}
+
+// generationStatus returns the HTTP status code of a Gemini or image API
+// error.
+func generationStatus(err error) (int, bool) {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code, true
+	}
+	var aerr *imageAPIError
+	if errors.As(err, &aerr) {
+		return aerr.Status, true
+	}
+	return 0, false
+}
+
+// AttemptRecorder collects the generation attempts made under a context.
+type AttemptRecorder struct {
+	mu       sync.Mutex
+	attempts []models.GenerationAttempt
+}
+
+type attemptRecorderKey struct{}
+
+// WithAttemptRecorder returns a context whose generation attempts are
+// collected in the returned recorder.
+func WithAttemptRecorder(ctx context.Context) (context.Context, *AttemptRecorder) {
+	rec := &AttemptRecorder{}
+	return context.WithValue(ctx, attemptRecorderKey{}, rec), rec
+}
+
+// Attempts returns a copy of the attempts recorded so far.
+func (r *AttemptRecorder) Attempts() []models.GenerationAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.GenerationAttempt(nil), r.attempts...)
+}
+
+func recordAttempt(ctx context.Context, a models.GenerationAttempt) {
+	if rec, ok := ctx.Value(attemptRecorderKey{}).(*AttemptRecorder); ok {
+		rec.mu.Lock()
+		rec.attempts = append(rec.attempts, a)
+		rec.mu.Unlock()
+	}
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+// call is one GenerateFunc invocation seen by a scripted generator.
+type call struct{ model, key string }
+
+// scriptedGenerate returns a GenerateFunc that answers each call with the
+// next of results (a nil error means success) and records the calls.
+func scriptedGenerate(results []error) (GenerateFunc, *[]call) {
+	var calls []call
+	return func(ctx context.Context, model, apiKey string) ([]byte, error) {
+		calls = append(calls, call{model, apiKey})
+		if len(calls) > len(results) {
+			return nil, fmt.Errorf("unexpected call %d", len(calls))
+		}
+		if err := results[len(calls)-1]; err != nil {
+			return nil, err
+		}
+		return []byte("image"), nil
+	}, &calls
+}
+
+func testPolicy(modelNames, apiKeys []string) *GenerationPolicy {
+	return &GenerationPolicy{
+		Models:           modelNames,
+		APIKeys:          apiKeys,
+		MaxAttempts:      3,
+		BreakerThreshold: 0,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func TestGenerationPolicyRun(t *testing.T) {
+	transient := &imageAPIError{Status: 503, Message: "unavailable"}
+	quota := &imageAPIError{Status: 429, Message: "quota"}
+	badRequest := &imageAPIError{Status: 400, Message: "bad request"}
+
+	tests := []struct {
+		name      string
+		models    []string
+		keys      []string
+		results   []error
+		wantErr   error
+		wantCalls []call
+	}{
+		{
+			name:      "first call succeeds",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1"},
+			results:   []error{nil},
+			wantCalls: []call{{"m1", "k1"}},
+		},
+		{
+			name:      "transient failures retry the same model",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1"},
+			results:   []error{transient, transient, nil},
+			wantCalls: []call{{"m1", "k1"}, {"m1", "k1"}, {"m1", "k1"}},
+		},
+		{
+			name:      "exhausted attempts fall back to the next model",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1"},
+			results:   []error{transient, transient, transient, nil},
+			wantCalls: []call{{"m1", "k1"}, {"m1", "k1"}, {"m1", "k1"}, {"m2", "k1"}},
+		},
+		{
+			name:      "quota rotates the key without using an attempt",
+			models:    []string{"m1"},
+			keys:      []string{"k1", "k2", "k3"},
+			results:   []error{quota, quota, nil},
+			wantCalls: []call{{"m1", "k1"}, {"m1", "k2"}, {"m1", "k3"}},
+		},
+		{
+			name:      "quota on every key moves to the next model",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1", "k2"},
+			results:   []error{quota, quota, nil},
+			wantCalls: []call{{"m1", "k1"}, {"m1", "k2"}, {"m2", "k2"}},
+		},
+		{
+			name:      "non-retryable error moves to the next model",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1"},
+			results:   []error{badRequest, nil},
+			wantCalls: []call{{"m1", "k1"}, {"m2", "k1"}},
+		},
+		{
+			name:      "safety block ends the chain",
+			models:    []string{"m1", "m2"},
+			keys:      []string{"k1"},
+			results:   []error{ErrSafetyBlocked},
+			wantErr:   ErrSafetyBlocked,
+			wantCalls: []call{{"m1", "k1"}},
+		},
+		{
+			name:      "last error is returned",
+			models:    []string{"m1"},
+			keys:      []string{"k1"},
+			results:   []error{transient, transient, badRequest},
+			wantErr:   badRequest,
+			wantCalls: []call{{"m1", "k1"}, {"m1", "k1"}, {"m1", "k1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generate, calls := scriptedGenerate(tt.results)
+			out, err := testPolicy(tt.models, tt.keys).Run(context.Background(), "test", generate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(out) != "image" {
+				t.Errorf("out = %q, want the generated image", out)
+			}
+			if !slices.Equal(*calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGenerationPolicyKeyRotationCarriesOver(t *testing.T) {
+	p := testPolicy([]string{"m1"}, []string{"k1", "k2"})
+	generate, calls := scriptedGenerate([]error{&imageAPIError{Status: 429}, nil, nil})
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.Run(context.Background(), "test", generate); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	want := []call{{"m1", "k1"}, {"m1", "k2"}, {"m1", "k2"}}
+	if !slices.Equal(*calls, want) {
+		t.Errorf("calls = %v, want the second run to start on k2: %v", *calls, want)
+	}
+}
+
+func TestGenerationPolicyBreaker(t *testing.T) {
+	transient := &imageAPIError{Status: 500}
+	p := testPolicy([]string{"m1", "m2"}, []string{"k1"})
+	p.MaxAttempts = 1
+	p.BreakerThreshold = 2
+
+	// Two transient failures on m1 open its breaker
+	generate, calls := scriptedGenerate([]error{transient, nil, transient, nil, nil})
+	for i := 0; i < 2; i++ {
+		if _, err := p.Run(context.Background(), "test", generate); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	ctx, rec := WithAttemptRecorder(context.Background())
+	if _, err := p.Run(ctx, "test", generate); err != nil {
+		t.Fatal(err)
+	}
+	want := []call{{"m1", "k1"}, {"m2", "k1"}, {"m1", "k1"}, {"m2", "k1"}, {"m2", "k1"}}
+	if !slices.Equal(*calls, want) {
+		t.Fatalf("calls = %v, want m1 skipped once open: %v", *calls, want)
+	}
+	if attempts := rec.Attempts(); len(attempts) != 2 || attempts[0].Outcome != models.AttemptCircuitOpen || attempts[0].Model != "m1" {
+		t.Errorf("attempts = %+v, want m1 recorded as circuit open", attempts)
+	}
+
+	// Once the cooldown is over a single probe goes through and closes it
+	p.breakers["m1"].openUntil = time.Now().Add(-time.Second)
+	if !p.allow("m1") {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	if p.allow("m1") {
+		t.Error("second caller allowed while the probe is in flight")
+	}
+	p.recordResult("m1", models.AttemptSucceeded)
+	if !p.allow("m1") || p.isOpen("m1") {
+		t.Error("breaker still open after a successful probe")
+	}
+}
+
+func TestClassifyGenerationError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, models.AttemptTransient},
+		{fmt.Errorf("wrapped: %w", ErrSafetyBlocked), models.AttemptBlocked},
+		{&imageAPIError{Status: 429}, models.AttemptQuota},
+		{&imageAPIError{Status: 408}, models.AttemptTransient},
+		{&imageAPIError{Status: 502}, models.AttemptTransient},
+		{&imageAPIError{Status: 400}, models.AttemptFailed},
+		{errors.New("429 in the message only"), models.AttemptFailed},
+	}
+	for _, tt := range tests {
+		if got := classifyGenerationError(tt.err); got != tt.want {
+			t.Errorf("classifyGenerationError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
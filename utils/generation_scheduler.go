@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the backlog is at capacity.
+	ErrQueueFull = errors.New("generation queue is full")
+	// ErrQueueTimeout is returned by Wait when no slot freed up within the
+	// scheduler's MaxWait.
+	ErrQueueTimeout = errors.New("timed out waiting in the generation queue")
+)
+
+// GenerationScheduler bounds how many image generations run at once across
+// the process. Waiting requests are served by plan priority (pro, plus,
+// free, guest), first come first served within a plan.
+type GenerationScheduler struct {
+	Limit    int           // concurrent generations
+	MaxQueue int           // waiting tickets before Enqueue refuses
+	MaxWait  time.Duration // longest a ticket may wait for a slot
+
+	mu      sync.Mutex
+	running int
+	waiting ticketHeap
+	seq     uint64
+}
+
+// Ticket is a place in the generation queue. Call Wait to get a slot and
+// Done to give it back.
+type Ticket struct {
+	s        *GenerationScheduler
+	priority int
+	seq      uint64
+	index    int // position in the heap, -1 once out of it
+	granted  chan struct{}
+	done     bool
+}
+
+// Scheduler is the process-wide GenerationScheduler, set up from config
+// by InitGenerationScheduler.
+var Scheduler = NewGenerationScheduler(4, 100, 3*time.Minute)
+
+// NewGenerationScheduler returns a scheduler running limit generations at
+// once.
+func NewGenerationScheduler(limit, maxQueue int, maxWait time.Duration) *GenerationScheduler {
+	return &GenerationScheduler{Limit: max(limit, 1), MaxQueue: maxQueue, MaxWait: maxWait}
+}
+
+// InitGenerationScheduler sets Scheduler from config.
+func InitGenerationScheduler() {
+	Scheduler = NewGenerationScheduler(config.GenerationConcurrency, config.GenerationQueueSize, config.GenerationMaxWait)
+}
+
+// Enqueue takes a ticket for a generation on behalf of plan. The slot is
+// granted right away if one is free.
+func (s *GenerationScheduler) Enqueue(plan string) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &Ticket{s: s, priority: models.PlanPriority(plan), index: -1, granted: make(chan struct{})}
+	if s.running < s.Limit && len(s.waiting) == 0 {
+		s.running++
+		close(t.granted)
+		return t, nil
+	}
+	if s.MaxQueue > 0 && len(s.waiting) >= s.MaxQueue {
+		return nil, ErrQueueFull
+	}
+	s.seq++
+	t.seq = s.seq
+	heap.Push(&s.waiting, t)
+	return t, nil
+}
+
+// Acquire enqueues on behalf of plan and waits for the slot, for work
+// done inline rather than as a try-on job. The caller must call Done on
+// the ticket.
+func (s *GenerationScheduler) Acquire(ctx context.Context, plan string) (*Ticket, error) {
+	t, err := s.Enqueue(plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Wait blocks until the ticket holds a slot. If ctx ends or MaxWait passes
+// first, the ticket leaves the queue and the error is returned.
+func (t *Ticket) Wait(ctx context.Context) error {
+	var timeout <-chan time.Time
+	if t.s.MaxWait > 0 {
+		timer := time.NewTimer(t.s.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-t.granted:
+		return nil
+	case <-ctx.Done():
+		return t.abandon(ctx.Err())
+	case <-timeout:
+		return t.abandon(ErrQueueTimeout)
+	}
+}
+
+// abandon takes a waiting ticket out of the queue. If the slot was granted
+// meanwhile it is handed on, and the wait still counts as failed.
+func (t *Ticket) abandon(err error) error {
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.index >= 0 {
+		heap.Remove(&s.waiting, t.index)
+	} else {
+		select {
+		case <-t.granted:
+			s.releaseLocked()
+		default:
+		}
+	}
+	t.done = true
+	return err
+}
+
+// Done releases the ticket's slot to the next waiter. It is safe to call
+// more than once, and after a failed Wait.
+func (t *Ticket) Done() {
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.index >= 0 { // never got a slot
+		heap.Remove(&s.waiting, t.index)
+		return
+	}
+	s.releaseLocked()
+}
+
+func (s *GenerationScheduler) releaseLocked() {
+	s.running--
+	for s.running < s.Limit && len(s.waiting) > 0 {
+		next := heap.Pop(&s.waiting).(*Ticket)
+		s.running++
+		close(next.granted)
+	}
+}
+
+// Position is the ticket's 1-based place in the queue, or 0 once it holds
+// (or has given up) a slot.
+func (t *Ticket) Position() int {
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.index < 0 {
+		return 0
+	}
+	pos := 1
+	for _, other := range s.waiting {
+		if other != t && other.before(t) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// Load returns how many generations are running and waiting.
+func (s *GenerationScheduler) Load() (running, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, len(s.waiting)
+}
+
+func (t *Ticket) before(o *Ticket) bool {
+	if t.priority != o.priority {
+		return t.priority > o.priority
+	}
+	return t.seq < o.seq
+}
+
+// ticketHeap is a container/heap of waiting tickets, highest priority first.
+type ticketHeap []*Ticket
+
+func (h ticketHeap) Len() int           { return len(h) }
+func (h ticketHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+func (h ticketHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ticketHeap) Push(x any) {
+	t := x.(*Ticket)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *ticketHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+// granted reports whether t holds a slot, without waiting.
+func granted(t *Ticket) bool {
+	select {
+	case <-t.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestGenerationSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		plans []string
+		want  []int // indexes into plans, in the order they get the slot
+	}{
+		{
+			name:  "by plan priority",
+			plans: []string{models.PlanGuest, models.PlanFree, models.PlanPro, models.PlanPlus},
+			want:  []int{2, 3, 1, 0},
+		},
+		{
+			name:  "first come first served within a plan",
+			plans: []string{models.PlanFree, models.PlanPro, models.PlanFree, models.PlanPro},
+			want:  []int{1, 3, 0, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGenerationScheduler(1, 0, 0)
+			holder, err := s.Enqueue(models.PlanFree)
+			if err != nil || !granted(holder) {
+				t.Fatalf("first ticket not granted right away: %v", err)
+			}
+
+			tickets := make([]*Ticket, len(tt.plans))
+			for i, plan := range tt.plans {
+				if tickets[i], err = s.Enqueue(plan); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for pos, i := range tt.want {
+				if got := tickets[i].Position(); got != pos+1 {
+					t.Errorf("ticket %d (%s) position = %d, want %d", i, tt.plans[i], got, pos+1)
+				}
+			}
+
+			prev := holder
+			for _, i := range tt.want {
+				prev.Done()
+				for j, other := range tickets {
+					if granted(other) != (j == i || other.done) {
+						t.Fatalf("after releasing, ticket %d granted = %v, want only ticket %d", j, granted(other), i)
+					}
+				}
+				if tickets[i].Position() != 0 {
+					t.Errorf("granted ticket %d still has a position", i)
+				}
+				prev = tickets[i]
+			}
+			prev.Done()
+			if running, waiting := s.Load(); running != 0 || waiting != 0 {
+				t.Errorf("load = %d running, %d waiting, want none", running, waiting)
+			}
+		})
+	}
+}
+
+func TestGenerationSchedulerQueueFull(t *testing.T) {
+	s := NewGenerationScheduler(1, 1, 0)
+	if _, err := s.Enqueue(models.PlanFree); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Enqueue(models.PlanFree); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Enqueue(models.PlanPro); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestGenerationSchedulerAbandon(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxWait time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "context canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "max wait passed",
+			maxWait: time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			wantErr: ErrQueueTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGenerationScheduler(1, 0, tt.maxWait)
+			holder, _ := s.Enqueue(models.PlanFree)
+			first, _ := s.Enqueue(models.PlanPro)
+			second, _ := s.Enqueue(models.PlanFree)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			if err := first.Wait(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if first.Position() != 0 || second.Position() != 1 {
+				t.Errorf("positions = %d, %d, want the abandoned ticket out of the queue", first.Position(), second.Position())
+			}
+
+			// The slot skips the abandoned ticket, and Done after a failed
+			// Wait is a no-op
+			holder.Done()
+			first.Done()
+			if granted(first) || !granted(second) {
+				t.Errorf("granted = %v, %v, want the slot to go to the next waiter", granted(first), granted(second))
+			}
+			if running, waiting := s.Load(); running != 1 || waiting != 0 {
+				t.Errorf("load = %d running, %d waiting, want 1 running", running, waiting)
+			}
+		})
+	}
+}
+
+func TestGenerationSchedulerAbandonAfterGrant(t *testing.T) {
+	s := NewGenerationScheduler(1, 0, 0)
+	holder, _ := s.Enqueue(models.PlanFree)
+	late, _ := s.Enqueue(models.PlanFree)
+	next, _ := s.Enqueue(models.PlanFree)
+
+	// The slot is granted just as the wait gives up: it must be handed on
+	// rather than leaked
+	holder.Done()
+	if err := late.abandon(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if !granted(next) {
+		t.Error("slot granted to the abandoned ticket wasn't handed on")
+	}
+	if running, _ := s.Load(); running != 1 {
+		t.Errorf("running = %d, want 1", running)
+	}
+}
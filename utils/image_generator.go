@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+)
+
+// ImageGenerator renders try-on images. Each call returns the encoded
+// image; a model that answers with text only fails with ErrNoImage.
+type ImageGenerator interface {
+	// GenerateIndividual dresses one person, optionally in a themed scene.
+	GenerateIndividual(ctx context.Context, themeImageURL, themeDescription string, person PersonTryOnData) ([]byte, error)
+	// GenerateGroup dresses two or more people in one image. tryOnType is
+	// the try-on type ("couple", "family", ...), used for logging.
+	GenerateGroup(ctx context.Context, tryOnType, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error)
+	// GenerateProductTryOn is the legacy product try-on. personImageURLs[0]
+	// is the photo to dress; any further entries are other photos of the
+	// same person, sent as identity references.
+	GenerateProductTryOn(ctx context.Context, personImageURLs []string, productImages []string, dimensions string, personDetails string) ([]byte, error)
+}
+
+// Image backends accepted in IMAGE_BACKEND.
+const (
+	ImageBackendGemini = "gemini"
+	ImageBackendOpenAI = "openai"
+	ImageBackendStub   = "stub"
+)
+
+// Generator is the ImageGenerator the try-on handlers use. It is set from
+// config by InitImageGenerator; replace it to run without a model.
+var Generator ImageGenerator = &GeminiGenerator{}
+
+// NewImageGenerator returns the generator for a backend name.
+func NewImageGenerator(backend string) (ImageGenerator, error) {
+	switch backend {
+	case "", ImageBackendGemini:
+		return &GeminiGenerator{Policy: DefaultGenerationPolicy()}, nil
+	case ImageBackendOpenAI:
+		return &OpenAIGenerator{
+			BaseURL: config.OpenAIBaseURL,
+			Policy:  NewGenerationPolicy([]string{config.OpenAIImageModel}, []string{config.OpenAIAPIKey}),
+		}, nil
+	case ImageBackendStub:
+		return StubGenerator{}, nil
+	}
+	return nil, fmt.Errorf("unknown image backend %q", backend)
+}
+
+// InitImageGenerator sets Generator from config.ImageBackend. The stub
+// backend also stubs the measurement Estimator and turns off people
+// detection in PhotoQualityAnalyzer, so nothing needs a model.
+func InitImageGenerator() error {
+	g, err := NewImageGenerator(config.ImageBackend)
+	if err != nil {
+		return err
+	}
+	Generator = g
+	if config.ImageBackend == ImageBackendStub {
+		Estimator = StubMeasurementEstimator{}
+		PhotoQualityAnalyzer = &PixelPhotoAnalyzer{}
+	}
+	fmt.Printf("Image backend: %s\n", config.ImageBackend)
+	return nil
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Normalized uploads are JPEGs no larger than MaxImageDimension on their
+// long side. Images over MaxImagePixels are rejected before decoding.
+const (
+	MaxImageDimension = 2048
+	MaxImagePixels    = 50_000_000
+	JPEGQuality       = 88
+)
+
+var (
+	// ErrNotAnImage is returned by NormalizeImage for data that isn't a
+	// supported image format.
+	ErrNotAnImage = errors.New("file is not a supported image (JPEG, PNG, GIF, WebP or HEIC)")
+	// ErrImageTooLarge is returned by NormalizeImage for images whose
+	// header declares more than MaxImagePixels.
+	ErrImageTooLarge = errors.New("image is too large (over 50 megapixels)")
+)
+
+// NormalizeUpload reads a multipart upload and runs it through
+// NormalizeImage.
+func NormalizeUpload(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeImage(data)
+}
+
+// NormalizeImage is the shared ingestion step for user uploads. It sniffs
+// the real format (ignoring the client's Content-Type), decodes JPEG, PNG,
+// GIF, WebP or HEIC, scales down to MaxImageDimension, applies the EXIF
+// orientation and re-encodes as JPEG. Re-encoding drops all metadata,
+// including GPS EXIF.
+func NormalizeImage(data []byte) ([]byte, error) {
+	format := sniffUploadFormat(data)
+	decodeConfig := func(r io.Reader) (image.Config, error) {
+		cfg, _, err := image.DecodeConfig(r)
+		return cfg, err
+	}
+	decode := func(r io.Reader) (image.Image, error) {
+		img, _, err := image.Decode(r)
+		return img, err
+	}
+	switch format {
+	case "heic":
+		// libheif applies the container's rotation itself
+		decodeConfig, decode = heic.DecodeConfig, heic.Decode
+	case "jpeg", "png", "gif", "webp":
+	default:
+		return nil, ErrNotAnImage
+	}
+
+	// Check the declared size first, so a decompression bomb is never
+	// decoded
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+
+	// Rotate after scaling, so the rotation only touches the small image
+	rgba := fitWithin(img, MaxImageDimension)
+	if format == "jpeg" {
+		rgba = applyOrientation(rgba, jpegOrientation(data))
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, rgba, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// JPEGFilename swaps name's extension for .jpg, to match normalized data.
+func JPEGFilename(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".jpg"
+}
+
+// sniffUploadFormat identifies data by its magic bytes.
+func sniffUploadFormat(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return "heic"
+		}
+	}
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return "jpeg"
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	}
+	return ""
+}
+
+// fitWithin copies img into an RGBA image, scaled down so neither side
+// exceeds maxSide.
+func fitWithin(img image.Image, maxSide int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+		return dst
+	}
+	if w >= h {
+		h = h * maxSide / w
+		w = maxSide
+	} else {
+		w = w * maxSide / h
+		h = maxSide
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// jpegOrientation returns the EXIF Orientation tag (1-8) of a JPEG, or 1
+// when there is none.
+func jpegOrientation(data []byte) int {
+	// Walk the markers up to the first APP1 "Exif" segment
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) { // start of scan
+			break
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 from IFD0 of a TIFF header.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < entries; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[off:off+2]) == 0x0112 {
+			if v := int(order.Uint16(tiff[off+8 : off+10])); v >= 1 && v <= 8 {
+				return v
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates / flips img so orientation becomes 1.
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+4*w]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 CW
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 CCW
+				dx, dy = y, w-1-x
+			}
+			o := dy*dst.Stride + 4*dx
+			copy(dst.Pix[o:o+4], src[4*x:4*x+4])
+		}
+	}
+	return dst
+}
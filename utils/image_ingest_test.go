@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// halvesImage is a w x h image, red on the left half and blue on the
+// right.
+func halvesImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+// jpegWithOrientation encodes img as a JPEG carrying an EXIF Orientation
+// tag in the given TIFF byte order ("II" or "MM").
+func jpegWithOrientation(t *testing.T, img image.Image, orientation int, byteOrder string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if byteOrder == "MM" {
+		order = binary.BigEndian
+	}
+	// TIFF header, then IFD0 with the one SHORT entry and no next IFD
+	tiff := []byte(byteOrder)
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0)
+	tiff = order.AppendUint32(tiff, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	// Right after the SOI marker
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// pngHeader is the start of a PNG declaring w x h, enough for
+// image.DecodeConfig.
+func pngHeader(w, h uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, w)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, h)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8-bit RGBA
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = binary.BigEndian.AppendUint32(out, 13)
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
+
+func isColor(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	near := func(v uint32, w uint8) bool {
+		d := int(v>>8) - int(w)
+		return d > -60 && d < 60
+	}
+	return near(r, want.R) && near(g, want.G) && near(b, want.B)
+}
+
+func TestNormalizeImageOrientation(t *testing.T) {
+	src := halvesImage(40, 20)
+
+	// where names the red half of the upright image
+	tests := []struct {
+		name        string
+		orientation int
+		byteOrder   string
+		wantW       int
+		wantH       int
+		where       string
+	}{
+		{name: "no rotation", orientation: 1, byteOrder: "II", wantW: 40, wantH: 20, where: "left"},
+		{name: "mirrored", orientation: 2, byteOrder: "II", wantW: 40, wantH: 20, where: "right"},
+		{name: "rotated 180", orientation: 3, byteOrder: "II", wantW: 40, wantH: 20, where: "right"},
+		{name: "rotated 90 CW", orientation: 6, byteOrder: "II", wantW: 20, wantH: 40, where: "top"},
+		{name: "rotated 90 CW, big-endian", orientation: 6, byteOrder: "MM", wantW: 20, wantH: 40, where: "top"},
+		{name: "rotated 90 CCW", orientation: 8, byteOrder: "MM", wantW: 20, wantH: 40, where: "bottom"},
+		{name: "invalid orientation ignored", orientation: 9, byteOrder: "II", wantW: 40, wantH: 20, where: "left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NormalizeImage(jpegWithOrientation(t, src, tt.orientation, tt.byteOrder))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jpegOrientation(out) != 1 {
+				t.Error("orientation tag kept in the output")
+			}
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := img.Bounds()
+			if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+
+			// Sample the middle of each half
+			var inRed, inBlue image.Point
+			switch tt.where {
+			case "left":
+				inRed, inBlue = image.Pt(b.Dx()/4, b.Dy()/2), image.Pt(3*b.Dx()/4, b.Dy()/2)
+			case "right":
+				inRed, inBlue = image.Pt(3*b.Dx()/4, b.Dy()/2), image.Pt(b.Dx()/4, b.Dy()/2)
+			case "top":
+				inRed, inBlue = image.Pt(b.Dx()/2, b.Dy()/4), image.Pt(b.Dx()/2, 3*b.Dy()/4)
+			case "bottom":
+				inRed, inBlue = image.Pt(b.Dx()/2, 3*b.Dy()/4), image.Pt(b.Dx()/2, b.Dy()/4)
+			}
+			if !isColor(img.At(inRed.X, inRed.Y), red) || !isColor(img.At(inBlue.X, inBlue.Y), blue) {
+				t.Errorf("red half isn't on the %s: %v at %v, %v at %v", tt.where, img.At(inRed.X, inRed.Y), inRed, img.At(inBlue.X, inBlue.Y), inBlue)
+			}
+		})
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	encodePNG := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+		wantW   int
+		wantH   int
+	}{
+		{name: "png re-encoded as jpeg", data: encodePNG(halvesImage(30, 10)), wantW: 30, wantH: 10},
+		{name: "scaled to the max dimension", data: encodePNG(halvesImage(MaxImageDimension*2, 512)), wantW: MaxImageDimension, wantH: 256},
+		{name: "tall image scaled by height", data: encodePNG(halvesImage(100, MaxImageDimension+100)), wantW: 100 * MaxImageDimension / (MaxImageDimension + 100), wantH: MaxImageDimension},
+		{name: "not an image", data: []byte("%PDF-1.7 not an image"), wantErr: ErrNotAnImage},
+		{name: "truncated image", data: pngHeader(10, 10), wantErr: ErrNotAnImage},
+		{name: "decompression bomb", data: pngHeader(10000, 10000), wantErr: ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NormalizeImage(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sniffUploadFormat(out) != "jpeg" {
+				t.Fatalf("output is %q, want jpeg", sniffUploadFormat(out))
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// MeasurementEstimateRequest is what an estimator gets to work from: a
+// full-body photo and the height the user entered, which sets the scale.
+type MeasurementEstimateRequest struct {
+	ImageURL string
+	HeightCM float64
+	Gender   string
+	Age      int
+}
+
+// MeasurementEstimate holds estimated circumferences in cm. Zero means the
+// estimator couldn't tell.
+type MeasurementEstimate struct {
+	Chest float64 `json:"chest_cm"`
+	Waist float64 `json:"waist_cm"`
+	Hips  float64 `json:"hips_cm"`
+}
+
+// MeasurementEstimator estimates body measurements from a person photo.
+type MeasurementEstimator interface {
+	EstimateMeasurements(ctx context.Context, req MeasurementEstimateRequest) (*MeasurementEstimate, error)
+}
+
+// MeasurementEstimatorFunc adapts a plain function to MeasurementEstimator,
+// e.g. to stub out Gemini.
+type MeasurementEstimatorFunc func(ctx context.Context, req MeasurementEstimateRequest) (*MeasurementEstimate, error)
+
+func (f MeasurementEstimatorFunc) EstimateMeasurements(ctx context.Context, req MeasurementEstimateRequest) (*MeasurementEstimate, error) {
+	return f(ctx, req)
+}
+
+// Estimator is the MeasurementEstimator the person handlers use. It is
+// set from config by InitImageGenerator; replace it to run without Gemini.
+var Estimator MeasurementEstimator = GeminiMeasurementEstimator{}
+
+// Plausible adult circumference bounds (cm); estimates outside are dropped.
+const (
+	minCircumferenceCM = 50
+	maxCircumferenceCM = 200
+)
+
+// GeminiMeasurementEstimator asks the Gemini image model to read chest,
+// waist and hips off the photo, scaled by the known height.
+type GeminiMeasurementEstimator struct {
+	// Policy picks the key and retries transient failures. Nil uses
+	// DefaultAnalysisPolicy.
+	Policy *GenerationPolicy
+}
+
+func (e GeminiMeasurementEstimator) EstimateMeasurements(ctx context.Context, req MeasurementEstimateRequest) (*MeasurementEstimate, error) {
+	if req.HeightCM <= 0 {
+		return nil, fmt.Errorf("height is required to estimate measurements")
+	}
+
+	imgData, mime, err := fetchImageLogged("Gemini", "person", req.ImageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch person image: %v", err)
+	}
+
+	prompt := fmt.Sprintf(`You are a tailor taking measurements from a photo for an online clothing size guide.
+The photo shows the customer standing. Their height is %.0f cm; use it to set the scale.
+Gender: %s. Age: %d.
+Estimate the chest, waist and hips circumferences in centimetres.
+Reply with only this JSON and no other text: {"chest_cm": <number>, "waist_cm": <number>, "hips_cm": <number>}
+Use 0 for any measurement you cannot see.`, req.HeightCM, req.Gender, req.Age)
+
+	policy := e.Policy
+	if policy == nil {
+		policy = DefaultAnalysisPolicy()
+	}
+	out, err := runGeminiPolicy(ctx, policy, "Measurement estimate", []genai.Part{genai.Text(prompt), genai.ImageData(mime, imgData)}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseMeasurementEstimate(string(out))
+}
+
+// StubMeasurementEstimator calls no model: it scales average adult
+// proportions by the height, so person creation with
+// estimate_measurements works offline. Used with IMAGE_BACKEND=stub.
+type StubMeasurementEstimator struct{}
+
+// Circumferences as fractions of height, for StubMeasurementEstimator.
+const (
+	stubChestRatio = 0.54
+	stubWaistRatio = 0.46
+	stubHipsRatio  = 0.56
+)
+
+func (StubMeasurementEstimator) EstimateMeasurements(ctx context.Context, req MeasurementEstimateRequest) (*MeasurementEstimate, error) {
+	if req.HeightCM <= 0 {
+		return nil, fmt.Errorf("height is required to estimate measurements")
+	}
+	return &MeasurementEstimate{
+		Chest: math.Round(req.HeightCM * stubChestRatio),
+		Waist: math.Round(req.HeightCM * stubWaistRatio),
+		Hips:  math.Round(req.HeightCM * stubHipsRatio),
+	}, nil
+}
+
+// parseMeasurementEstimate reads the JSON object out of the model's reply
+// (which may be wrapped in a code fence) and drops implausible values.
+func parseMeasurementEstimate(text string) (*MeasurementEstimate, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no measurements in model response")
+	}
+	var est MeasurementEstimate
+	if err := json.Unmarshal([]byte(text[start:end+1]), &est); err != nil {
+		return nil, fmt.Errorf("failed to parse model response: %v", err)
+	}
+	for _, v := range []*float64{&est.Chest, &est.Waist, &est.Hips} {
+		if *v < minCircumferenceCM || *v > maxCircumferenceCM {
+			*v = 0
+		}
+	}
+	if est.Chest == 0 && est.Waist == 0 && est.Hips == 0 {
+		return nil, fmt.Errorf("model returned no usable measurements")
+	}
+	return &est, nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+)
+
+// testMongo points Client and config.DBName at a scratch database on the
+// server in TEST_MONGO_URI, dropped when the test ends. Without it the
+// test is skipped.
+func testMongo(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI not set")
+	}
+	if Client == nil {
+		if err := ConnectMongo(uri); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbName := config.DBName
+	config.DBName = fmt.Sprintf("test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := Client.Database(config.DBName).Drop(ctx); err != nil {
+			t.Logf("drop %s: %v", config.DBName, err)
+		}
+		config.DBName = dbName
+	})
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+)
+
+// OpenAIGenerator is the ImageGenerator for an OpenAI-compatible image edit
+// API (POST {BaseURL}/images/edits). That API takes one prompt and a list
+// of images with no text between them, so the prompt ends with a legend of
+// what each image is.
+type OpenAIGenerator struct {
+	BaseURL string
+	// Policy supplies the model and API key of each attempt and retries
+	// transient failures. Nil uses OPENAI_IMAGE_MODEL and OPENAI_API_KEY.
+	Policy *GenerationPolicy
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+// openAIImage is one input image and its line in the prompt's legend.
+type openAIImage struct {
+	label string
+	url   string
+}
+
+// GenerateIndividual implements ImageGenerator.
+func (g *OpenAIGenerator) GenerateIndividual(ctx context.Context, themeImageURL, themeDescription string, person PersonTryOnData) ([]byte, error) {
+	images := []openAIImage{{"the customer", person.PersonImageURL}}
+	for _, u := range person.ReferenceImageURLs {
+		images = append(images, openAIImage{"another photo of the customer", u})
+	}
+	images = append(images, garmentImages("the customer", person)...)
+	if themeImageURL != "" {
+		images = append(images, openAIImage{"the background environment", themeImageURL})
+	}
+	prompt := individualTryOnPrompt(person.Details, themeDescription, len(person.ReferenceImageURLs), false)
+	return g.edit(ctx, "individual try-on", prompt, images)
+}
+
+// GenerateGroup implements ImageGenerator.
+func (g *OpenAIGenerator) GenerateGroup(ctx context.Context, tryOnType, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
+	if len(people) == 0 {
+		return nil, fmt.Errorf("no people provided")
+	}
+	var images []openAIImage
+	var details strings.Builder
+	for i, p := range people {
+		tag := fmt.Sprintf("customer %d", i+1)
+		images = append(images, openAIImage{tag, p.PersonImageURL})
+		for _, u := range p.ReferenceImageURLs {
+			images = append(images, openAIImage{"another photo of " + tag, u})
+		}
+		images = append(images, garmentImages(tag, p)...)
+		if p.Details != "" {
+			fmt.Fprintf(&details, "Customer %d details: %s\n", i+1, p.Details)
+		}
+	}
+	if themeImageURL != "" {
+		images = append(images, openAIImage{"the background environment", themeImageURL})
+	}
+	prompt := multiPersonTryOnPrompt(len(people), themeDescription, false) + details.String()
+	return g.edit(ctx, tryOnType+" try-on", prompt, images)
+}
+
+// GenerateProductTryOn implements ImageGenerator.
+func (g *OpenAIGenerator) GenerateProductTryOn(ctx context.Context, personImageURLs []string, productImages []string, dimensions string, personDetails string) ([]byte, error) {
+	if len(personImageURLs) == 0 {
+		return nil, fmt.Errorf("no person image provided")
+	}
+	var images []openAIImage
+	for i, u := range personImageURLs {
+		label := "the person"
+		if i > 0 {
+			label = "another photo of the person"
+		}
+		images = append(images, openAIImage{label, u})
+	}
+	for _, u := range productImages {
+		if u != "" {
+			images = append(images, openAIImage{"the product", u})
+		}
+	}
+	// The prompt counts the person photos actually attached, not requested
+	prompt := func(attached []openAIImage) string {
+		persons := 0
+		for _, im := range attached {
+			if slices.Contains(personImageURLs, im.url) {
+				persons++
+			}
+		}
+		return productTryOnPrompt(personDetails, dimensions, persons)
+	}
+	return g.editAttached(ctx, "product try-on", prompt, images)
+}
+
+// garmentImages lists a person's garment references in the order the
+// Gemini backend sends them.
+func garmentImages(owner string, p PersonTryOnData) []openAIImage {
+	var images []openAIImage
+	for _, group := range []struct {
+		kind string
+		urls []string
+	}{{"top", p.TopURL}, {"bottom", p.BottomURL}, {"dress", p.DressURL}, {"accessory", p.AccessoryURL}} {
+		for _, u := range group.urls {
+			images = append(images, openAIImage{fmt.Sprintf("a %s for %s", group.kind, owner), u})
+		}
+	}
+	return images
+}
+
+// edit fetches the images once and posts them with the prompt to the
+// image edit endpoint under the generation policy. Images that fail to
+// fetch are left out, as in the Gemini backend.
+func (g *OpenAIGenerator) edit(ctx context.Context, label, prompt string, images []openAIImage) ([]byte, error) {
+	return g.editAttached(ctx, label, func([]openAIImage) string { return prompt }, images)
+}
+
+// editAttached is edit with a prompt built from the images that were
+// actually fetched.
+func (g *OpenAIGenerator) editAttached(ctx context.Context, label string, buildPrompt func(attached []openAIImage) string, images []openAIImage) ([]byte, error) {
+	type file struct {
+		name string
+		mime string
+		data []byte
+	}
+	var files []file
+	var attached []openAIImage
+	var legend strings.Builder
+	legend.WriteString("\nThe images are, in order:\n")
+	for _, im := range images {
+		if im.url == "" {
+			continue
+		}
+		data, mime, err := fetchImageLogged("OpenAI", im.label, im.url)
+		if err != nil {
+			continue
+		}
+		files = append(files, file{fmt.Sprintf("image%d.%s", len(files)+1, mime), mime, data})
+		attached = append(attached, im)
+		fmt.Fprintf(&legend, "%d. %s\n", len(files), im.label)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no images fetched")
+	}
+	prompt := buildPrompt(attached) + legend.String()
+
+	policy := g.Policy
+	if policy == nil {
+		policy = NewGenerationPolicy([]string{config.OpenAIImageModel}, []string{config.OpenAIAPIKey})
+	}
+	return policy.Run(ctx, label, func(ctx context.Context, model, apiKey string) ([]byte, error) {
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+		}
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, f := range files {
+			// CreateFormFile would label every image application/octet-stream,
+			// which the image API rejects
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image[]"; filename="%s"`, f.name))
+			h.Set("Content-Type", "image/"+f.mime)
+			fw, err := mw.CreatePart(h)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := fw.Write(f.data); err != nil {
+				return nil, err
+			}
+		}
+		mw.WriteField("model", model)
+		mw.WriteField("prompt", prompt)
+		mw.WriteField("n", "1")
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(g.BaseURL, "/")+"/images/edits", &body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		client := g.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		fmt.Printf("[OpenAI] %s: sending %d images to %s\n", label, len(files), model)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call image API: %v", err)
+		}
+		defer resp.Body.Close()
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return parseOpenAIImage(label, resp.StatusCode, raw)
+	})
+}
+
+// imageAPIError is an error response from the image API. Its status lets
+// the generation policy classify it.
+type imageAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *imageAPIError) Error() string {
+	return fmt.Sprintf("image API error (status %d): %s", e.Status, e.Message)
+}
+
+// parseOpenAIImage decodes the first image of an image API response.
+func parseOpenAIImage(label string, status int, raw []byte) ([]byte, error) {
+	var result struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, &imageAPIError{Status: status, Message: fmt.Sprintf("%.200s", raw)}
+	}
+	if result.Error != nil {
+		// Moderation errors are mapped like Gemini safety blocks
+		if result.Error.Code == "moderation_blocked" {
+			return nil, fmt.Errorf("%s %w (moderation): %s", label, ErrSafetyBlocked, result.Error.Message)
+		}
+		return nil, &imageAPIError{Status: status, Message: result.Error.Message}
+	}
+	if len(result.Data) == 0 || result.Data[0].B64JSON == "" {
+		return nil, ErrNoImage
+	}
+	return base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+}
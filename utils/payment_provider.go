@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+)
+
+// Payment provider names, as set in BILLING_PROVIDER and used in webhook
+// URLs (/billing/webhook/{provider}).
+const (
+	PaymentProviderRazorpay = "razorpay"
+	PaymentProviderStripe   = "stripe"
+	PaymentProviderFake     = "fake"
+)
+
+// Billing event types, normalised across providers.
+const (
+	BillingSubscriptionUpdated  = "subscription.updated"  // created, renewed, past due or set to cancel
+	BillingSubscriptionCanceled = "subscription.canceled" // ended; the plan is removed
+	BillingPackPaid             = "pack.paid"
+)
+
+// ErrInvalidSignature is returned by VerifyWebhook for a payload whose
+// signature doesn't match.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// PaymentProvider creates checkouts at a payment provider and turns its
+// signed webhooks into BillingEvents.
+type PaymentProvider interface {
+	Name() string
+	// CreateCheckout starts a subscription (req.Plan) or a one-off credit
+	// pack purchase (req.PackID) and returns where to send the user.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error)
+	// VerifyWebhook checks the payload's signature and parses it. A nil
+	// event with no error is a valid event we don't act on.
+	VerifyWebhook(payload []byte, header http.Header) (*BillingEvent, error)
+	// CancelSubscription stops renewal; the plan stays until the period
+	// ends.
+	CancelSubscription(ctx context.Context, providerSubscriptionID string) error
+}
+
+// CheckoutRequest is a purchase to start. Exactly one of Plan and PackID
+// is set.
+type CheckoutRequest struct {
+	UserID     string
+	Email      string
+	Plan       string
+	PackID     string
+	SuccessURL string
+	CancelURL  string
+}
+
+// CheckoutSession is a started checkout.
+type CheckoutSession struct {
+	Provider string `json:"provider"`
+	ID       string `json:"session_id"`
+	URL      string `json:"url"`
+}
+
+// BillingEvent is a provider webhook event, normalised. UserID, Plan and
+// PackID come from the metadata set at checkout.
+type BillingEvent struct {
+	ID                     string    `json:"id"`
+	Type                   string    `json:"type"`
+	UserID                 string    `json:"user_id"`
+	ProviderSubscriptionID string    `json:"subscription_id,omitempty"`
+	Plan                   string    `json:"plan,omitempty"`
+	Status                 string    `json:"status,omitempty"` // models.Subscription*
+	CurrentPeriodEnd       time.Time `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd      *bool     `json:"cancel_at_period_end,omitempty"` // nil when the provider doesn't say
+	PackID                 string    `json:"pack_id,omitempty"`
+	PaymentID              string    `json:"payment_id,omitempty"`
+	// OccurredAt is when the provider created the event, used to drop
+	// subscription events delivered out of order. Zero when unknown.
+	OccurredAt time.Time `json:"occurred_at,omitempty"`
+}
+
+// Payments is the configured PaymentProvider, set by InitPaymentProvider.
+// It is nil while billing is off.
+var Payments PaymentProvider
+
+// NewPaymentProvider returns the provider for name.
+func NewPaymentProvider(name string) (PaymentProvider, error) {
+	switch name {
+	case PaymentProviderRazorpay:
+		return &RazorpayProvider{
+			KeyID:         config.RazorpayKeyID,
+			KeySecret:     config.RazorpayKeySecret,
+			WebhookSecret: config.RazorpayWebhookSecret,
+			Plans:         config.RazorpayPlans,
+		}, nil
+	case PaymentProviderStripe:
+		return &StripeProvider{
+			SecretKey:     config.StripeSecretKey,
+			WebhookSecret: config.StripeWebhookSecret,
+			Prices:        config.StripePrices,
+		}, nil
+	case PaymentProviderFake:
+		return &FakePaymentProvider{Secret: config.FakeBillingSecret}, nil
+	}
+	return nil, fmt.Errorf("unknown billing provider %q", name)
+}
+
+// InitPaymentProvider sets Payments from BILLING_PROVIDER, leaving it nil
+// when that is unset.
+func InitPaymentProvider() error {
+	if config.BillingProvider == "" {
+		fmt.Println("[Billing] BILLING_PROVIDER not set, checkout is disabled")
+		return nil
+	}
+	p, err := NewPaymentProvider(config.BillingProvider)
+	if err != nil {
+		return err
+	}
+	Payments = p
+	return nil
+}
+
+// hmacSHA256Hex is the hex HMAC-SHA256 of msg, as most providers sign
+// webhooks.
+func hmacSHA256Hex(secret string, msg []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureMatches compares hex signatures in constant time. An empty
+// secret never matches.
+func signatureMatches(secret, expected, provided string) bool {
+	return secret != "" && hmac.Equal([]byte(expected), []byte(provided))
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+func TestRazorpayVerifyWebhook(t *testing.T) {
+	const secret = "whsec_razorpay"
+	paid := []byte(`{"event":"payment_link.paid","payload":{"payment_link":{"entity":{"id":"plink_1","notes":{"user_id":"u1","pack_id":"pack_10"}}},"payment":{"entity":{"id":"pay_1"}}}}`)
+	halted := []byte(`{"event":"subscription.halted","created_at":1760000000,"payload":{"subscription":{"entity":{"id":"sub_1","status":"halted","current_end":1762000000,"notes":{"user_id":"u1","plan":"plus"}}}}}`)
+	created := []byte(`{"event":"subscription.authenticated","payload":{"subscription":{"entity":{"id":"sub_1","status":"authenticated"}}}}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		eventID   string
+		wantErr   error
+		want      *BillingEvent
+	}{
+		{
+			name:      "pack paid",
+			secret:    secret,
+			payload:   paid,
+			signature: hmacSHA256Hex(secret, paid),
+			eventID:   "evt_1",
+			want:      &BillingEvent{ID: "evt_1", Type: BillingPackPaid, UserID: "u1", PackID: "pack_10", PaymentID: "pay_1"},
+		},
+		{
+			name:      "subscription halted",
+			secret:    secret,
+			payload:   halted,
+			signature: hmacSHA256Hex(secret, halted),
+			eventID:   "evt_2",
+			want: &BillingEvent{
+				ID: "evt_2", Type: BillingSubscriptionUpdated, UserID: "u1", ProviderSubscriptionID: "sub_1", Plan: "plus",
+				Status: models.SubscriptionPaused, OccurredAt: time.Unix(1760000000, 0).UTC(), CurrentPeriodEnd: time.Unix(1762000000, 0).UTC(),
+			},
+		},
+		{
+			name:      "subscription not paid for yet",
+			secret:    secret,
+			payload:   created,
+			signature: hmacSHA256Hex(secret, created),
+		},
+		{
+			name:      "wrong secret",
+			secret:    secret,
+			payload:   paid,
+			signature: hmacSHA256Hex("other", paid),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "tampered body",
+			secret:    secret,
+			payload:   append([]byte(" "), paid...),
+			signature: hmacSHA256Hex(secret, paid),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "no secret configured",
+			payload:   paid,
+			signature: hmacSHA256Hex("", paid),
+			wantErr:   ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RazorpayProvider{WebhookSecret: tt.secret}
+			header := http.Header{}
+			header.Set("X-Razorpay-Signature", tt.signature)
+			if tt.eventID != "" {
+				header.Set("X-Razorpay-Event-Id", tt.eventID)
+			}
+			got, err := p.VerifyWebhook(tt.payload, header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			assertBillingEvent(t, got, tt.want)
+		})
+	}
+}
+
+func TestRazorpayVerifyWebhookEventIDFallback(t *testing.T) {
+	const secret = "whsec_razorpay"
+	payload := []byte(`{"event":"payment_link.paid","payload":{"payment_link":{"entity":{"id":"plink_1","notes":{"user_id":"u1","pack_id":"pack_10"}}}}}`)
+	p := &RazorpayProvider{WebhookSecret: secret}
+	header := http.Header{}
+	header.Set("X-Razorpay-Signature", hmacSHA256Hex(secret, payload))
+
+	first, err := p.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := p.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.ID != again.ID {
+		t.Errorf("redelivery ids = %q, %q, want the same non-empty id", first.ID, again.ID)
+	}
+	if first.PaymentID != "plink_1" {
+		t.Errorf("PaymentID = %q, want the link id without a payment", first.PaymentID)
+	}
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	const secret = "whsec_stripe"
+	now := time.Now().Unix()
+	paid := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","mode":"payment","payment_status":"paid","payment_intent":"pi_1","metadata":{"user_id":"u1","pack_id":"pack_10"}}}}`)
+	unpaid := []byte(`{"id":"evt_2","type":"checkout.session.completed","data":{"object":{"id":"cs_2","mode":"payment","payment_status":"unpaid","metadata":{"user_id":"u1","pack_id":"pack_10"}}}}`)
+	deleted := []byte(`{"id":"evt_3","type":"customer.subscription.deleted","created":1760000000,"data":{"object":{"id":"sub_1","status":"active","current_period_end":1762000000,"metadata":{"user_id":"u1","plan":"pro"}}}}`)
+
+	sign := func(ts int64, payload []byte, secret string) string {
+		t := strconv.FormatInt(ts, 10)
+		return fmt.Sprintf("t=%s,v1=%s", t, hmacSHA256Hex(secret, []byte(t+"."+string(payload))))
+	}
+	no := false
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		wantErr   error
+		want      *BillingEvent
+	}{
+		{
+			name:      "pack paid",
+			payload:   paid,
+			signature: sign(now, paid, secret),
+			want:      &BillingEvent{ID: "evt_1", Type: BillingPackPaid, UserID: "u1", PackID: "pack_10", PaymentID: "pi_1"},
+		},
+		{
+			name:      "unpaid session waits for async payment",
+			payload:   unpaid,
+			signature: sign(now, unpaid, secret),
+		},
+		{
+			name:      "subscription deleted",
+			payload:   deleted,
+			signature: sign(now, deleted, secret),
+			want: &BillingEvent{
+				ID: "evt_3", Type: BillingSubscriptionCanceled, UserID: "u1", ProviderSubscriptionID: "sub_1", Plan: "pro",
+				Status: models.SubscriptionCanceled, CancelAtPeriodEnd: &no,
+				OccurredAt: time.Unix(1760000000, 0).UTC(), CurrentPeriodEnd: time.Unix(1762000000, 0).UTC(),
+			},
+		},
+		{
+			name:      "one of several signatures matches",
+			payload:   paid,
+			signature: fmt.Sprintf("t=%d,v1=deadbeef,v1=%s", now, hmacSHA256Hex(secret, fmt.Appendf(nil, "%d.%s", now, paid))),
+			want:      &BillingEvent{ID: "evt_1", Type: BillingPackPaid, UserID: "u1", PackID: "pack_10", PaymentID: "pi_1"},
+		},
+		{
+			name:      "wrong secret",
+			payload:   paid,
+			signature: sign(now, paid, "other"),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "stale timestamp",
+			payload:   paid,
+			signature: sign(now-int64((10*time.Minute).Seconds()), paid, secret),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "missing timestamp",
+			payload:   paid,
+			signature: "v1=" + hmacSHA256Hex(secret, paid),
+			wantErr:   ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &StripeProvider{WebhookSecret: secret}
+			header := http.Header{}
+			header.Set("Stripe-Signature", tt.signature)
+			got, err := p.VerifyWebhook(tt.payload, header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			assertBillingEvent(t, got, tt.want)
+		})
+	}
+}
+
+func assertBillingEvent(t *testing.T, got, want *BillingEvent) {
+	t.Helper()
+	if (got == nil) != (want == nil) {
+		t.Fatalf("event = %+v, want %+v", got, want)
+	}
+	if got == nil {
+		return
+	}
+	if (got.CancelAtPeriodEnd == nil) != (want.CancelAtPeriodEnd == nil) ||
+		(got.CancelAtPeriodEnd != nil && *got.CancelAtPeriodEnd != *want.CancelAtPeriodEnd) {
+		t.Errorf("CancelAtPeriodEnd = %v, want %v", got.CancelAtPeriodEnd, want.CancelAtPeriodEnd)
+	}
+	g, w := *got, *want
+	g.CancelAtPeriodEnd, w.CancelAtPeriodEnd = nil, nil
+	if g != w {
+		t.Errorf("event = %+v, want %+v", g, w)
+	}
+}
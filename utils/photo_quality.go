@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Person photo quality thresholds.
+const (
+	MinPhotoShortSide = 480 // px
+	MinPhotoLongSide  = 640 // px
+	MinPhotoSharpness = 40  // variance of the Laplacian at sharpnessSampleSize
+	// sharpnessSampleSize is the long side the photo is sampled down to
+	// before measuring blur, so the score doesn't depend on resolution.
+	sharpnessSampleSize = 512
+)
+
+// Photo issue codes returned by CheckPersonPhoto.
+const (
+	PhotoIssueUnreadable     = "unreadable"
+	PhotoIssueLowResolution  = "low_resolution"
+	PhotoIssueBlurry         = "blurry"
+	PhotoIssueLandscape      = "landscape"
+	PhotoIssueNoPerson       = "no_person"
+	PhotoIssueMultiplePeople = "multiple_people"
+	PhotoIssueNotFullBody    = "not_full_body"
+)
+
+// PhotoIssue is one reason a person photo was rejected, with a message the
+// client can show as-is.
+type PhotoIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PhotoAnalysis is what an analyzer measured on a photo. PeopleChecked is
+// false when the person / framing detection didn't run, in which case
+// PersonCount and FullBody are meaningless.
+type PhotoAnalysis struct {
+	Width         int
+	Height        int
+	Sharpness     float64
+	PeopleChecked bool
+	PersonCount   int
+	FullBody      bool
+}
+
+// PhotoAnalyzer measures a decoded photo.
+type PhotoAnalyzer interface {
+	AnalyzePhoto(ctx context.Context, img image.Image, data []byte) (*PhotoAnalysis, error)
+}
+
+// PeopleDetector counts the people in a photo and says whether the (single)
+// person is in frame head to toe.
+type PeopleDetector interface {
+	DetectPeople(ctx context.Context, data []byte) (count int, fullBody bool, err error)
+}
+
+// PhotoQualityAnalyzer is the PhotoAnalyzer CheckPersonPhoto uses. It is
+// set from config by InitImageGenerator; replace it to run without Gemini.
+var PhotoQualityAnalyzer PhotoAnalyzer = &PixelPhotoAnalyzer{People: GeminiPeopleDetector{}}
+
+// People detection outcomes since start, see PeopleDetectionStats.
+var (
+	peopleDetections        atomic.Int64
+	peopleDetectionFailures atomic.Int64
+)
+
+// PeopleDetectionStats returns how many people detections ran since start
+// and how many of them failed, skipping the person and framing checks.
+func PeopleDetectionStats() (runs, failures int64) {
+	return peopleDetections.Load(), peopleDetectionFailures.Load()
+}
+
+// PixelPhotoAnalyzer measures size and sharpness itself and delegates
+// person detection to People, when set. Detection fails open: an error is
+// logged and counted, and only the person and framing checks are skipped,
+// so a Gemini outage doesn't block uploads.
+type PixelPhotoAnalyzer struct {
+	People PeopleDetector
+}
+
+func (a *PixelPhotoAnalyzer) AnalyzePhoto(ctx context.Context, img image.Image, data []byte) (*PhotoAnalysis, error) {
+	b := img.Bounds()
+	analysis := &PhotoAnalysis{
+		Width:     b.Dx(),
+		Height:    b.Dy(),
+		Sharpness: laplacianVariance(img),
+	}
+	if a.People != nil {
+		peopleDetections.Add(1)
+		count, fullBody, err := a.People.DetectPeople(ctx, data)
+		if err != nil {
+			failures := peopleDetectionFailures.Add(1)
+			fmt.Printf("[PhotoQuality] People detection failed (%d so far), person checks skipped: %v\n", failures, err)
+		} else {
+			analysis.PeopleChecked = true
+			analysis.PersonCount = count
+			analysis.FullBody = fullBody
+		}
+	}
+	return analysis, nil
+}
+
+// CheckPersonPhoto runs the quality gate on an uploaded person photo and
+// returns every problem found; an empty result means the photo is usable.
+func CheckPersonPhoto(ctx context.Context, data []byte) ([]PhotoIssue, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return []PhotoIssue{{PhotoIssueUnreadable, "The file isn't a supported image. Upload a JPEG, PNG, WebP or HEIC photo."}}, nil
+	}
+
+	a, err := PhotoQualityAnalyzer.AnalyzePhoto(ctx, img, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []PhotoIssue
+	short, long := a.Width, a.Height
+	if short > long {
+		short, long = long, short
+	}
+	if short < MinPhotoShortSide || long < MinPhotoLongSide {
+		issues = append(issues, PhotoIssue{PhotoIssueLowResolution, fmt.Sprintf("The photo is %dx%d. Use one at least %dx%d pixels.", a.Width, a.Height, MinPhotoShortSide, MinPhotoLongSide)})
+	}
+	if a.Sharpness < MinPhotoSharpness {
+		issues = append(issues, PhotoIssue{PhotoIssueBlurry, "The photo is blurry. Hold the camera steady, or ask someone to take it, in good light."})
+	}
+	if a.Width > a.Height {
+		issues = append(issues, PhotoIssue{PhotoIssueLandscape, "The photo is in landscape. Take it in portrait (upright) orientation."})
+	}
+	if a.PeopleChecked {
+		switch {
+		case a.PersonCount == 0:
+			issues = append(issues, PhotoIssue{PhotoIssueNoPerson, "No person found in the photo. Upload a photo of the person standing."})
+		case a.PersonCount > 1:
+			issues = append(issues, PhotoIssue{PhotoIssueMultiplePeople, fmt.Sprintf("Found %d people in the photo. Upload one with only this person in it.", a.PersonCount)})
+		case !a.FullBody:
+			issues = append(issues, PhotoIssue{PhotoIssueNotFullBody, "The photo is cropped. Stand back so the whole body, head to feet, is in frame."})
+		}
+	}
+	return issues, nil
+}
+
+// laplacianVariance is a standard blur measure: the variance of the
+// 4-neighbour Laplacian of the grayscale image. Sharp edges give large
+// values, blur gives small ones. The image is point-sampled down to
+// sharpnessSampleSize first.
+func laplacianVariance(img image.Image) float64 {
+	b := img.Bounds()
+	step := 1
+	if long := max(b.Dx(), b.Dy()); long > sharpnessSampleSize {
+		step = (long + sharpnessSampleSize - 1) / sharpnessSampleSize
+	}
+	w, h := b.Dx()/step, b.Dy()/step
+	if w < 3 || h < 3 {
+		return 0
+	}
+
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x*step, b.Min.Y+y*step).RGBA()
+			gray[y*w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 257
+		}
+	}
+
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			lap := gray[i-1] + gray[i+1] + gray[i-w] + gray[i+w] - 4*gray[i]
+			sum += lap
+			sumSq += lap * lap
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// GeminiPeopleDetector asks Gemini how many people the photo shows and
+// whether the person is fully in frame.
+type GeminiPeopleDetector struct {
+	// Policy picks the key and retries transient failures. Nil uses
+	// DefaultAnalysisPolicy.
+	Policy *GenerationPolicy
+}
+
+func (d GeminiPeopleDetector) DetectPeople(ctx context.Context, data []byte) (int, bool, error) {
+	prompt := `This photo was uploaded for a virtual clothing try-on.
+Count the people clearly visible in it (ignore people on posters or screens), and say whether the main person is shown head to feet.
+Reply with only this JSON and no other text: {"person_count": <number>, "full_body": <true|false>}`
+
+	policy := d.Policy
+	if policy == nil {
+		policy = DefaultAnalysisPolicy()
+	}
+	out, err := runGeminiPolicy(ctx, policy, "People detection", []genai.Part{genai.Text(prompt), genai.ImageData(sniffImageFormat(data), data)}, nil, nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	text := string(out)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return 0, false, fmt.Errorf("no detection in model response")
+	}
+	var result struct {
+		PersonCount int  `json:"person_count"`
+		FullBody    bool `json:"full_body"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &result); err != nil {
+		return 0, false, fmt.Errorf("failed to parse model response: %v", err)
+	}
+	return result.PersonCount, result.FullBody, nil
+}
+
+// sniffImageFormat returns the genai image format ("jpeg", "png", "webp")
+// for data, defaulting to jpeg.
+func sniffImageFormat(data []byte) string {
+	switch {
+	case len(data) > 4 && data[0] == 0x89 && data[1] == 0x50:
+		return "png"
+	case len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp"
+	}
+	return "jpeg"
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// savedCountsCollection keeps per-user counts of saved items, one document
+// per user id with a field per kind ("persons", "wardrobe"), so a plan's
+// cap is enforced with a single guarded update.
+const savedCountsCollection = "saved_counts"
+
+// ReserveSavedItem counts one more saved item of kind for userID unless
+// the user already has limit of them (0 is unlimited). It reports whether
+// the item was counted and, when it wasn't, how many are saved. A count
+// missing for the user is started from countSaved, so items saved before
+// counting began are included. Pair a reservation whose item isn't saved
+// with ReleaseSavedItem.
+func ReserveSavedItem(ctx context.Context, userID, kind string, limit int, countSaved func(context.Context) (int64, error)) (bool, int64, error) {
+	coll := GetCollection(config.DBName, savedCountsCollection)
+	if err := startSavedCount(ctx, coll, userID, kind, countSaved); err != nil {
+		return false, 0, err
+	}
+
+	filter := bson.M{"_id": userID}
+	if limit > 0 {
+		filter[kind] = bson.M{"$lt": limit}
+	}
+	res, err := coll.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{kind: 1}})
+	if err != nil {
+		return false, 0, fmt.Errorf("count saved %s: %w", kind, err)
+	}
+	if res.MatchedCount == 1 {
+		return true, 0, nil
+	}
+
+	var counts map[string]int64
+	err = coll.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"_id": 0, kind: 1})).Decode(&counts)
+	if err != nil {
+		return false, 0, fmt.Errorf("load saved %s: %w", kind, err)
+	}
+	return false, counts[kind], nil
+}
+
+// ReleaseSavedItem counts one saved item of kind less for userID, after a
+// delete or a reservation whose item wasn't saved.
+func ReleaseSavedItem(ctx context.Context, userID, kind string) error {
+	_, err := GetCollection(config.DBName, savedCountsCollection).UpdateOne(ctx,
+		bson.M{"_id": userID, kind: bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{kind: -1}},
+	)
+	return err
+}
+
+// startSavedCount sets the user's count of kind from countSaved when it
+// isn't set yet. When two requests race, the first one's count is kept.
+func startSavedCount(ctx context.Context, coll *mongo.Collection, userID, kind string, countSaved func(context.Context) (int64, error)) error {
+	err := coll.FindOne(ctx, bson.M{"_id": userID, kind: bson.M{"$exists": true}}).Err()
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("load saved %s: %w", kind, err)
+	}
+
+	n, err := countSaved(ctx)
+	if err != nil {
+		return fmt.Errorf("count saved %s: %w", kind, err)
+	}
+	_, err = coll.UpdateOne(ctx,
+		bson.M{"_id": userID, kind: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{kind: n}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("start saved %s count: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	plansCollection = "plans"
+	// planRefreshInterval is how often the cached plans are re-read, so an
+	// edit made through another instance takes effect here too.
+	planRefreshInterval = time.Minute
+)
+
+// InitPlanEntitlements seeds any missing plan with its defaults, loads the
+// plans into the cache and keeps it refreshed until stop is done. Until
+// the first load succeeds the defaults are used. Nothing is refreshed when
+// seeding fails.
+func InitPlanEntitlements(stop context.Context) error {
+	ctx, cancel := context.WithTimeout(stop, 10*time.Second)
+	defer cancel()
+
+	coll := GetCollection(config.DBName, plansCollection)
+	now := time.Now()
+	for _, e := range models.DefaultPlanEntitlements() {
+		e.UpdatedAt = now
+		_, err := coll.UpdateOne(ctx, bson.M{"_id": e.Plan}, bson.M{"$setOnInsert": e}, options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("failed to seed plan %s: %w", e.Plan, err)
+		}
+	}
+
+	go refreshPlanEntitlements(stop)
+	return LoadPlanEntitlements(ctx)
+}
+
+// refreshPlanEntitlements reloads the cached plans every
+// planRefreshInterval until stop is done.
+func refreshPlanEntitlements(stop context.Context) {
+	ticker := time.NewTicker(planRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(stop, 10*time.Second)
+			if err := LoadPlanEntitlements(ctx); err != nil {
+				fmt.Printf("[Plans] refresh failed: %v\n", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// LoadPlanEntitlements reads the plans collection into the cache.
+func LoadPlanEntitlements(ctx context.Context) error {
+	cursor, err := GetCollection(config.DBName, plansCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var plans []models.PlanEntitlements
+	if err := cursor.All(ctx, &plans); err != nil {
+		return err
+	}
+	valid := plans[:0]
+	for _, e := range plans {
+		if err := e.Validate(); err != nil {
+			fmt.Printf("[Plans] ignoring plan %s: %v\n", e.Plan, err)
+			continue
+		}
+		valid = append(valid, e)
+	}
+	models.SetPlanEntitlements(valid)
+	return nil
+}
+
+// SavePlanEntitlements replaces a plan's entitlements and reloads the
+// cache. Other instances pick the change up on their next refresh.
+func SavePlanEntitlements(ctx context.Context, e models.PlanEntitlements) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e.UpdatedAt = time.Now()
+	_, err := GetCollection(config.DBName, plansCollection).ReplaceOne(ctx, bson.M{"_id": e.Plan}, e, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return LoadPlanEntitlements(ctx)
+}
@@ -2,12 +2,15 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/raushankrgupta/web-product-scraper/config"
 	"github.com/raushankrgupta/web-product-scraper/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -18,12 +21,16 @@ func utcDateString() string {
 }
 
 // QuotaStatus describes a user's try-on usage for the current UTC day.
+// Limit, Used, Reserved and Remaining are quota units; Costs lists what a
+// try-on is charged.
 type QuotaStatus struct {
-	Plan      string `json:"plan"`
-	Limit     int    `json:"limit"`     // 0 == unlimited
-	Used      int    `json:"used"`
-	Remaining int    `json:"remaining"` // -1 == unlimited
-	Date      string `json:"date"`
+	Plan      string         `json:"plan"`
+	Limit     int            `json:"limit"` // 0 == unlimited
+	Used      int            `json:"used"`
+	Reserved  int            `json:"reserved"`  // held by try-ons in progress, not yet in Used
+	Remaining int            `json:"remaining"` // -1 == unlimited
+	Date      string         `json:"date"`
+	Costs     map[string]int `json:"costs"`
 }
 
 // GetTryOnQuotaStatus returns the current day's usage for `userKey`. The key
@@ -43,9 +50,16 @@ func GetTryOnQuotaStatus(ctx context.Context, userKey, plan string) (QuotaStatus
 		q.Count = 0
 	}
 
+	reserved := 0
+	for _, r := range q.Reservations {
+		if time.Since(r.CreatedAt) < reservationTTL {
+			reserved += max(r.Units, 1)
+		}
+	}
+
 	remaining := -1
 	if limit > 0 {
-		remaining = limit - q.Count
+		remaining = limit - q.Count - reserved
 		if remaining < 0 {
 			remaining = 0
 		}
@@ -55,15 +69,20 @@ func GetTryOnQuotaStatus(ctx context.Context, userKey, plan string) (QuotaStatus
 		Plan:      plan,
 		Limit:     limit,
 		Used:      q.Count,
+		Reserved:  reserved,
 		Remaining: remaining,
 		Date:      date,
+		Costs: map[string]int{
+			"per_person": models.UnitsPerPerson,
+			"theme":      models.UnitsPerTheme,
+		},
 	}, nil
 }
 
-// IncrementTryOnQuota atomically increments today's counter for `userKey`,
-// creating the document if missing. Should only be called after a successful
-// try-on so we don't bill the user for failed generations.
-func IncrementTryOnQuota(ctx context.Context, userKey string) error {
+// IncrementTryOnQuota atomically adds `units` to today's counter for
+// `userKey`, creating the document if missing. Should only be called after a
+// successful try-on so we don't bill the user for failed generations.
+func IncrementTryOnQuota(ctx context.Context, userKey string, units int) error {
 	coll := GetCollection(config.DBName, "tryon_quota")
 	date := utcDateString()
 
@@ -71,7 +90,7 @@ func IncrementTryOnQuota(ctx context.Context, userKey string) error {
 		ctx,
 		bson.M{"user_id": userKey, "date": date},
 		bson.M{
-			"$inc": bson.M{"count": 1},
+			"$inc": bson.M{"count": units},
 			"$set": bson.M{"updated_at": time.Now()},
 		},
 		options.Update().SetUpsert(true),
@@ -81,3 +100,172 @@ func IncrementTryOnQuota(ctx context.Context, userKey string) error {
 	}
 	return nil
 }
+
+// reservationTTL is how long a reservation holds quota. It outlasts the
+// slowest try-on, so an older one was left behind by a crash and is
+// dropped by the next ReserveTryOnQuota.
+const reservationTTL = 15 * time.Minute
+
+// ErrQuotaExceeded is returned by ReserveTryOnQuota when the day's limit
+// (used plus in progress) is reached.
+var ErrQuotaExceeded = errors.New("daily try-on limit reached")
+
+// QuotaReservation holds a try-on's units until Commit or Release: Units
+// against the day's quota, the rest already spent from credits. A
+// reservation with no ID (the quota lookup failed open, or the day's quota
+// wasn't used) commits its Units as a plain increment.
+type QuotaReservation struct {
+	UserKey string
+	Plan    string
+	Date    string
+	ID      string
+	Units   int
+	Credits *CreditUse // refunded on Release
+}
+
+// EnsureQuotaIndexes creates the unique (user_id, date) index that
+// ReserveTryOnQuota relies on to keep one document per day.
+func EnsureQuotaIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := GetCollection(config.DBName, "tryon_quota").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// ReserveTryOnQuota takes `units` for a try-on by `userKey`: today's free
+// units first, then credits for whatever they don't cover. Guests have no
+// credits. Returns ErrQuotaExceeded when both together fall short.
+func ReserveTryOnQuota(ctx context.Context, userKey, plan string, units int) (*QuotaReservation, error) {
+	res, err := reserveDailyQuota(ctx, userKey, plan, units)
+	if !errors.Is(err, ErrQuotaExceeded) || plan == models.PlanGuest {
+		return res, err
+	}
+
+	// Use what's left of the day, if anything, and credits for the rest
+	res = &QuotaReservation{UserKey: userKey, Plan: plan, Date: utcDateString()}
+	if status, err := GetTryOnQuotaStatus(ctx, userKey, plan); err == nil && status.Remaining > 0 && status.Remaining < units {
+		if daily, err := reserveDailyQuota(ctx, userKey, plan, status.Remaining); err == nil {
+			res = daily
+		}
+	}
+	ref := res.ID
+	if ref == "" {
+		ref = primitive.NewObjectID().Hex()
+	}
+	res.Credits, err = ConsumeCredits(ctx, userKey, plan, units-res.Units, ref)
+	if err != nil {
+		if relErr := res.Release(ctx); relErr != nil {
+			fmt.Printf("[Quota] %v for %s\n", relErr, userKey)
+		}
+		if errors.Is(err, ErrInsufficientCredits) {
+			return nil, ErrQuotaExceeded
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// reserveDailyQuota atomically takes `units` of today's quota for
+// `userKey`: used plus reserved must stay within the plan's limit, so
+// parallel requests can't overshoot it. Returns ErrQuotaExceeded when
+// fewer than `units` are left.
+func reserveDailyQuota(ctx context.Context, userKey, plan string, units int) (*QuotaReservation, error) {
+	coll := GetCollection(config.DBName, "tryon_quota")
+	date := utcDateString()
+	now := time.Now()
+	filter := bson.M{"user_id": userKey, "date": date}
+
+	// Make sure today's document exists, dropping reservations abandoned
+	// by a crash
+	_, err := coll.UpdateOne(ctx, filter, bson.M{
+		"$setOnInsert": bson.M{"count": 0},
+		"$pull":        bson.M{"reservations": bson.M{"created_at": bson.M{"$lt": now.Add(-reservationTTL)}}},
+	}, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) { // a parallel upsert won
+		return nil, fmt.Errorf("reserve quota: %w", err)
+	}
+
+	res := &QuotaReservation{UserKey: userKey, Plan: plan, Date: date, ID: primitive.NewObjectID().Hex(), Units: units}
+	cond := bson.M{"user_id": userKey, "date": date}
+	if limit := models.DailyLimitForPlan(plan); limit > 0 {
+		// count + reserved units + units <= limit
+		reserved := bson.M{"$reduce": bson.M{
+			"input":        bson.M{"$ifNull": bson.A{"$reservations", bson.A{}}},
+			"initialValue": 0,
+			"in":           bson.M{"$add": bson.A{"$$value", bson.M{"$ifNull": bson.A{"$$this.units", 1}}}},
+		}}
+		cond["$expr"] = bson.M{"$lte": bson.A{
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$count", 0}}, reserved, units}},
+			limit,
+		}}
+	}
+	result, err := coll.UpdateOne(ctx, cond, bson.M{
+		"$push": bson.M{"reservations": models.QuotaReservationEntry{ID: res.ID, Units: units, CreatedAt: now}},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reserve quota: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrQuotaExceeded
+	}
+	return res, nil
+}
+
+// Commit turns the reservation into used units. Credits were spent when
+// reserved, so only the day's units are left to count.
+func (r *QuotaReservation) Commit(ctx context.Context) error {
+	if r.Units <= 0 {
+		return nil
+	}
+	if r.ID == "" {
+		return IncrementTryOnQuota(ctx, r.UserKey, r.Units)
+	}
+	coll := GetCollection(config.DBName, "tryon_quota")
+	result, err := coll.UpdateOne(ctx,
+		bson.M{"user_id": r.UserKey, "date": r.Date, "reservations.id": r.ID},
+		bson.M{
+			"$pull": bson.M{"reservations": bson.M{"id": r.ID}},
+			"$inc":  bson.M{"count": r.Units},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("commit quota: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		// The reservation outlived reservationTTL and was dropped; the
+		// try-on still happened, so count it
+		_, err = coll.UpdateOne(ctx,
+			bson.M{"user_id": r.UserKey, "date": r.Date},
+			bson.M{"$inc": bson.M{"count": r.Units}, "$set": bson.M{"updated_at": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("commit quota: %w", err)
+		}
+	}
+	return nil
+}
+
+// Release gives the reserved units back, refunding any credits.
+func (r *QuotaReservation) Release(ctx context.Context) error {
+	if r.ID != "" {
+		_, err := GetCollection(config.DBName, "tryon_quota").UpdateOne(ctx,
+			bson.M{"user_id": r.UserKey, "date": r.Date},
+			bson.M{"$pull": bson.M{"reservations": bson.M{"id": r.ID}}},
+		)
+		if err != nil {
+			return fmt.Errorf("release quota: %w", err)
+		}
+	}
+	if r.Credits != nil {
+		if err := RefundCredits(ctx, r.UserKey, r.Plan, r.Credits); err != nil {
+			return fmt.Errorf("refund credits: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// seedQuota writes today's quota document for userKey with used units
+// counted and the given reservations held.
+func seedQuota(t *testing.T, userKey string, used int, reservations ...models.QuotaReservationEntry) {
+	t.Helper()
+	if reservations == nil {
+		reservations = []models.QuotaReservationEntry{}
+	}
+	_, err := GetCollection(config.DBName, "tryon_quota").InsertOne(context.Background(), bson.M{
+		"user_id":      userKey,
+		"date":         utcDateString(),
+		"count":        used,
+		"reservations": reservations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReserveDailyQuota(t *testing.T) {
+	testMongo(t)
+	fresh := time.Now()
+	stale := time.Now().Add(-2 * reservationTTL)
+
+	// The free plan allows 5 units a day, pro is unlimited
+	tests := []struct {
+		name     string
+		plan     string
+		used     int
+		held     []models.QuotaReservationEntry
+		units    int
+		wantErr  error
+		wantHeld int // units reserved afterwards
+	}{
+		{name: "first of the day", plan: models.PlanFree, units: 2, wantHeld: 2},
+		{name: "fills the limit", plan: models.PlanFree, used: 2, held: []models.QuotaReservationEntry{{ID: "a", Units: 1, CreatedAt: fresh}}, units: 2, wantHeld: 3},
+		{name: "reservations count against the limit", plan: models.PlanFree, used: 2, held: []models.QuotaReservationEntry{{ID: "a", Units: 2, CreatedAt: fresh}}, units: 2, wantErr: ErrQuotaExceeded, wantHeld: 2},
+		{name: "stale reservations are dropped", plan: models.PlanFree, used: 2, held: []models.QuotaReservationEntry{{ID: "a", Units: 3, CreatedAt: stale}}, units: 3, wantHeld: 3},
+		{name: "more than the limit", plan: models.PlanFree, units: 6, wantErr: ErrQuotaExceeded},
+		{name: "unlimited plan", plan: models.PlanPro, used: 100, units: 10, wantHeld: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			userKey := "user:" + t.Name()
+			if tt.used > 0 || tt.held != nil {
+				seedQuota(t, userKey, tt.used, tt.held...)
+			}
+
+			res, err := reserveDailyQuota(ctx, userKey, tt.plan, tt.units)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (res.ID == "" || res.Units != tt.units) {
+				t.Errorf("reservation = %+v, want an id and %d units", res, tt.units)
+			}
+			status, err := GetTryOnQuotaStatus(ctx, userKey, tt.plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Used != tt.used || status.Reserved != tt.wantHeld {
+				t.Errorf("used %d, reserved %d; want %d, %d", status.Used, status.Reserved, tt.used, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestQuotaReservationCommitRelease(t *testing.T) {
+	testMongo(t)
+	ctx := context.Background()
+	userKey := "user:commit-release"
+
+	check := func(step string, wantUsed, wantReserved int) {
+		t.Helper()
+		status, err := GetTryOnQuotaStatus(ctx, userKey, models.PlanFree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Used != wantUsed || status.Reserved != wantReserved {
+			t.Errorf("%s: used %d, reserved %d; want %d, %d", step, status.Used, status.Reserved, wantUsed, wantReserved)
+		}
+	}
+
+	committed, err := reserveDailyQuota(ctx, userKey, models.PlanFree, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	released, err := reserveDailyQuota(ctx, userKey, models.PlanFree, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("reserved", 0, 5)
+
+	if err := committed.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("committed", 2, 3)
+
+	if err := released.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("released", 2, 0)
+
+	// A reservation dropped as stale still counts when committed
+	dropped, err := reserveDailyQuota(ctx, userKey, models.PlanFree, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetCollection(config.DBName, "tryon_quota").UpdateOne(ctx,
+		bson.M{"user_id": userKey, "date": dropped.Date},
+		bson.M{"$pull": bson.M{"reservations": bson.M{"id": dropped.ID}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropped.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("committed after drop", 3, 0)
+
+	// Without an id (failed open) Commit is a plain increment
+	if err := (&QuotaReservation{UserKey: userKey, Plan: models.PlanFree, Units: 2}).Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("committed without id", 5, 0)
+}
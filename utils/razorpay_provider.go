@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+const (
+	razorpayAPIBase = "https://api.razorpay.com/v1"
+	// razorpayBillingCycles is how many renewals a subscription is created
+	// for; Razorpay requires a finite count.
+	razorpayBillingCycles = 120
+)
+
+// RazorpayProvider is the PaymentProvider for Razorpay. Plans are Razorpay
+// subscriptions (Plans maps plan to Razorpay plan id); packs are payment
+// links priced from models.CreditPacks.
+type RazorpayProvider struct {
+	KeyID         string
+	KeySecret     string
+	WebhookSecret string
+	Plans         map[string]string
+	Client        *http.Client // defaults to http.DefaultClient
+}
+
+// Name implements PaymentProvider.
+func (p *RazorpayProvider) Name() string { return PaymentProviderRazorpay }
+
+// CreateCheckout implements PaymentProvider.
+func (p *RazorpayProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error) {
+	var created struct {
+		ID       string `json:"id"`
+		ShortURL string `json:"short_url"`
+	}
+
+	if req.Plan != "" {
+		planID := p.Plans[req.Plan]
+		if planID == "" {
+			return nil, fmt.Errorf("razorpay: no plan configured for %q", req.Plan)
+		}
+		err := p.call(ctx, "/subscriptions", map[string]interface{}{
+			"plan_id":         planID,
+			"total_count":     razorpayBillingCycles,
+			"customer_notify": 1,
+			"notes":           map[string]string{"user_id": req.UserID, "plan": req.Plan},
+		}, &created)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		pack := models.FindCreditPack(req.PackID)
+		if pack == nil {
+			return nil, fmt.Errorf("razorpay: unknown pack %q", req.PackID)
+		}
+		body := map[string]interface{}{
+			"amount":          pack.PriceCents,
+			"currency":        pack.Currency,
+			"description":     fmt.Sprintf("%d try-on credits", pack.Units),
+			"notes":           map[string]string{"user_id": req.UserID, "pack_id": pack.ID},
+			"callback_url":    req.SuccessURL,
+			"callback_method": "get",
+		}
+		if req.Email != "" {
+			body["customer"] = map[string]string{"email": req.Email}
+		}
+		if err := p.call(ctx, "/payment_links", body, &created); err != nil {
+			return nil, err
+		}
+	}
+	return &CheckoutSession{Provider: p.Name(), ID: created.ID, URL: created.ShortURL}, nil
+}
+
+// VerifyWebhook implements PaymentProvider. Razorpay sends the hex
+// HMAC-SHA256 of the body in X-Razorpay-Signature.
+func (p *RazorpayProvider) VerifyWebhook(payload []byte, header http.Header) (*BillingEvent, error) {
+	if !signatureMatches(p.WebhookSecret, hmacSHA256Hex(p.WebhookSecret, payload), header.Get("X-Razorpay-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		Event     string `json:"event"`
+		CreatedAt int64  `json:"created_at"`
+		Payload   struct {
+			Subscription struct {
+				Entity struct {
+					ID         string            `json:"id"`
+					Status     string            `json:"status"`
+					CurrentEnd int64             `json:"current_end"`
+					Notes      map[string]string `json:"notes"`
+				} `json:"entity"`
+			} `json:"subscription"`
+			PaymentLink struct {
+				Entity struct {
+					ID    string            `json:"id"`
+					Notes map[string]string `json:"notes"`
+				} `json:"entity"`
+			} `json:"payment_link"`
+			Payment struct {
+				Entity struct {
+					ID string `json:"id"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("razorpay webhook: %w", err)
+	}
+
+	// Redeliveries carry the same event id
+	eventID := header.Get("X-Razorpay-Event-Id")
+	if eventID == "" {
+		sum := sha256.Sum256(payload)
+		eventID = hex.EncodeToString(sum[:])
+	}
+
+	switch event.Event {
+	case "payment_link.paid":
+		link := event.Payload.PaymentLink.Entity
+		paymentID := event.Payload.Payment.Entity.ID
+		if paymentID == "" {
+			paymentID = link.ID
+		}
+		return &BillingEvent{
+			ID:        eventID,
+			Type:      BillingPackPaid,
+			UserID:    link.Notes["user_id"],
+			PackID:    link.Notes["pack_id"],
+			PaymentID: paymentID,
+		}, nil
+
+	case "subscription.activated", "subscription.charged", "subscription.resumed", "subscription.updated",
+		"subscription.pending", "subscription.halted", "subscription.paused",
+		"subscription.cancelled", "subscription.completed":
+		sub := event.Payload.Subscription.Entity
+		status := razorpaySubscriptionStatus(sub.Status)
+		if status == "" {
+			return nil, nil // created or authenticated: not paid for yet
+		}
+		ev := &BillingEvent{
+			ID:                     eventID,
+			Type:                   BillingSubscriptionUpdated,
+			UserID:                 sub.Notes["user_id"],
+			ProviderSubscriptionID: sub.ID,
+			Plan:                   sub.Notes["plan"],
+			Status:                 status,
+		}
+		if event.CreatedAt > 0 {
+			ev.OccurredAt = time.Unix(event.CreatedAt, 0).UTC()
+		}
+		if sub.CurrentEnd > 0 {
+			ev.CurrentPeriodEnd = time.Unix(sub.CurrentEnd, 0).UTC()
+		}
+		if status == models.SubscriptionCanceled {
+			ev.Type = BillingSubscriptionCanceled
+		}
+		return ev, nil
+	}
+	return nil, nil
+}
+
+// CancelSubscription implements PaymentProvider.
+func (p *RazorpayProvider) CancelSubscription(ctx context.Context, providerSubscriptionID string) error {
+	return p.call(ctx, "/subscriptions/"+url.PathEscape(providerSubscriptionID)+"/cancel",
+		map[string]interface{}{"cancel_at_cycle_end": 1}, nil)
+}
+
+// razorpaySubscriptionStatus maps a Razorpay status to ours, or "" for
+// one that doesn't change the plan yet. Halted means retries ran out, but
+// like paused it can still be resumed.
+func razorpaySubscriptionStatus(status string) string {
+	switch status {
+	case "active":
+		return models.SubscriptionActive
+	case "pending":
+		return models.SubscriptionPastDue
+	case "halted", "paused":
+		return models.SubscriptionPaused
+	case "cancelled", "completed", "expired":
+		return models.SubscriptionCanceled
+	}
+	return ""
+}
+
+// call POSTs body as JSON with basic auth.
+func (p *RazorpayProvider) call(ctx context.Context, path string, body, out interface{}) error {
+	if p.KeyID == "" || p.KeySecret == "" {
+		return fmt.Errorf("razorpay: RAZORPAY_KEY_ID and RAZORPAY_KEY_SECRET must be set")
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, razorpayAPIBase+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.KeyID, p.KeySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("razorpay: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		json.Unmarshal(respBody, &apiErr)
+		return fmt.Errorf("razorpay: %s: %s", resp.Status, apiErr.Error.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
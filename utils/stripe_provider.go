@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/models"
+)
+
+const (
+	stripeAPIBase = "https://api.stripe.com/v1"
+	// stripeSignatureTolerance is how old a webhook's timestamp may be, to
+	// stop replays.
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// StripeProvider is the PaymentProvider for Stripe Checkout. Plans are
+// recurring prices (Prices maps plan to price id); packs are one-off
+// payments priced from models.CreditPacks.
+type StripeProvider struct {
+	SecretKey     string
+	WebhookSecret string
+	Prices        map[string]string
+	Client        *http.Client // defaults to http.DefaultClient
+}
+
+// stripeSubscription is the part of a Stripe subscription object we read.
+type stripeSubscription struct {
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// Name implements PaymentProvider.
+func (p *StripeProvider) Name() string { return PaymentProviderStripe }
+
+// CreateCheckout implements PaymentProvider.
+func (p *StripeProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.UserID)
+	form.Set("metadata[user_id]", req.UserID)
+	if req.Email != "" {
+		form.Set("customer_email", req.Email)
+	}
+	form.Set("line_items[0][quantity]", "1")
+
+	if req.Plan != "" {
+		price := p.Prices[req.Plan]
+		if price == "" {
+			return nil, fmt.Errorf("stripe: no price configured for plan %q", req.Plan)
+		}
+		form.Set("mode", "subscription")
+		form.Set("line_items[0][price]", price)
+		form.Set("metadata[plan]", req.Plan)
+		form.Set("subscription_data[metadata][user_id]", req.UserID)
+		form.Set("subscription_data[metadata][plan]", req.Plan)
+	} else {
+		pack := models.FindCreditPack(req.PackID)
+		if pack == nil {
+			return nil, fmt.Errorf("stripe: unknown pack %q", req.PackID)
+		}
+		form.Set("mode", "payment")
+		form.Set("line_items[0][price_data][currency]", strings.ToLower(pack.Currency))
+		form.Set("line_items[0][price_data][unit_amount]", strconv.Itoa(pack.PriceCents))
+		form.Set("line_items[0][price_data][product_data][name]", fmt.Sprintf("%d try-on credits", pack.Units))
+		form.Set("metadata[pack_id]", pack.ID)
+	}
+
+	var session struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := p.call(ctx, http.MethodPost, "/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &CheckoutSession{Provider: p.Name(), ID: session.ID, URL: session.URL}, nil
+}
+
+// VerifyWebhook implements PaymentProvider. Stripe signs "{t}.{payload}"
+// and sends "t=...,v1=..." in the Stripe-Signature header.
+func (p *StripeProvider) VerifyWebhook(payload []byte, header http.Header) (*BillingEvent, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > stripeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+	expected := hmacSHA256Hex(p.WebhookSecret, []byte(timestamp+"."+string(payload)))
+	valid := false
+	for _, sig := range signatures {
+		valid = valid || signatureMatches(p.WebhookSecret, expected, sig)
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("stripe webhook: %w", err)
+	}
+
+	switch event.Type {
+	// A delayed payment method completes the session unpaid and succeeds
+	// later
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		var session struct {
+			ID            string            `json:"id"`
+			Mode          string            `json:"mode"`
+			PaymentStatus string            `json:"payment_status"`
+			PaymentIntent string            `json:"payment_intent"`
+			Metadata      map[string]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, fmt.Errorf("stripe webhook: %w", err)
+		}
+		// Subscriptions are handled by their own events, and an unpaid
+		// session by its async_payment_succeeded
+		if session.Mode != "payment" || session.PaymentStatus != "paid" {
+			return nil, nil
+		}
+		paymentID := session.PaymentIntent
+		if paymentID == "" {
+			paymentID = session.ID
+		}
+		return &BillingEvent{
+			ID:        event.ID,
+			Type:      BillingPackPaid,
+			UserID:    session.Metadata["user_id"],
+			PackID:    session.Metadata["pack_id"],
+			PaymentID: paymentID,
+		}, nil
+
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+			return nil, fmt.Errorf("stripe webhook: %w", err)
+		}
+		status := stripeSubscriptionStatus(sub.Status)
+		if event.Type == "customer.subscription.deleted" {
+			status = models.SubscriptionCanceled
+		}
+		if status == "" {
+			return nil, nil // incomplete: the first payment hasn't gone through
+		}
+		periodEnd := sub.CurrentPeriodEnd
+		if periodEnd == 0 && len(sub.Items.Data) > 0 {
+			periodEnd = sub.Items.Data[0].CurrentPeriodEnd
+		}
+		ev := &BillingEvent{
+			ID:                     event.ID,
+			Type:                   BillingSubscriptionUpdated,
+			UserID:                 sub.Metadata["user_id"],
+			ProviderSubscriptionID: sub.ID,
+			Plan:                   sub.Metadata["plan"],
+			Status:                 status,
+			CancelAtPeriodEnd:      &sub.CancelAtPeriodEnd,
+		}
+		if event.Created > 0 {
+			ev.OccurredAt = time.Unix(event.Created, 0).UTC()
+		}
+		if periodEnd > 0 {
+			ev.CurrentPeriodEnd = time.Unix(periodEnd, 0).UTC()
+		}
+		if status == models.SubscriptionCanceled {
+			ev.Type = BillingSubscriptionCanceled
+		}
+		return ev, nil
+	}
+	return nil, nil
+}
+
+// CancelSubscription implements PaymentProvider.
+func (p *StripeProvider) CancelSubscription(ctx context.Context, providerSubscriptionID string) error {
+	form := url.Values{}
+	form.Set("cancel_at_period_end", "true")
+	return p.call(ctx, http.MethodPost, "/subscriptions/"+url.PathEscape(providerSubscriptionID), form, nil)
+}
+
+// stripeSubscriptionStatus maps a Stripe status to ours, or "" for one
+// that doesn't change the plan yet.
+func stripeSubscriptionStatus(status string) string {
+	switch status {
+	case "active", "trialing":
+		return models.SubscriptionActive
+	case "past_due":
+		return models.SubscriptionPastDue
+	case "paused":
+		return models.SubscriptionPaused
+	case "canceled", "unpaid", "incomplete_expired":
+		return models.SubscriptionCanceled
+	}
+	return ""
+}
+
+func (p *StripeProvider) call(ctx context.Context, method, path string, form url.Values, out interface{}) error {
+	if p.SecretKey == "" {
+		return fmt.Errorf("stripe: STRIPE_SECRET_KEY is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, stripeAPIBase+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("stripe: %s: %s", resp.Status, apiErr.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// Size of the stub's output and of its right-hand garment column.
+const (
+	stubHeight      = 1024
+	stubColumnWidth = 256
+)
+
+// StubGenerator is an ImageGenerator that calls no model: it composites the
+// inputs, each person's photo side by side with their garments stacked in
+// a column on the right. The output depends only on the inputs, so it
+// suits local development without model credentials.
+type StubGenerator struct{}
+
+// GenerateIndividual implements ImageGenerator.
+func (StubGenerator) GenerateIndividual(ctx context.Context, themeImageURL, themeDescription string, person PersonTryOnData) ([]byte, error) {
+	return stubComposite([]PersonTryOnData{person})
+}
+
+// GenerateGroup implements ImageGenerator.
+func (StubGenerator) GenerateGroup(ctx context.Context, tryOnType, themeImageURL, themeDescription string, people []PersonTryOnData) ([]byte, error) {
+	if len(people) == 0 {
+		return nil, fmt.Errorf("no people provided")
+	}
+	return stubComposite(people)
+}
+
+// GenerateProductTryOn implements ImageGenerator.
+func (StubGenerator) GenerateProductTryOn(ctx context.Context, personImageURLs []string, productImages []string, dimensions string, personDetails string) ([]byte, error) {
+	if len(personImageURLs) == 0 {
+		return nil, fmt.Errorf("no person image provided")
+	}
+	return stubComposite([]PersonTryOnData{{PersonImageURL: personImageURLs[0], TopURL: productImages}})
+}
+
+// stubComposite lays out one panel per person. A panel is the person's
+// photo scaled to stubHeight plus a stubColumnWidth column of garments.
+func stubComposite(people []PersonTryOnData) ([]byte, error) {
+	type panel struct {
+		person   image.Image
+		garments []image.Image
+		width    int
+	}
+	panels := make([]panel, 0, len(people))
+	total := 0
+	for i, p := range people {
+		person, err := stubDecode(p.PersonImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch person %d image: %v", i+1, err)
+		}
+		pn := panel{person: person}
+		for _, urls := range [][]string{p.TopURL, p.BottomURL, p.DressURL, p.AccessoryURL} {
+			for _, u := range urls {
+				if g, err := stubDecode(u); err == nil {
+					pn.garments = append(pn.garments, g)
+				}
+			}
+		}
+		b := person.Bounds()
+		pn.width = max(b.Dx()*stubHeight/max(b.Dy(), 1), 1)
+		if len(pn.garments) > 0 {
+			pn.width += stubColumnWidth
+		}
+		total += pn.width
+		panels = append(panels, pn)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, total, stubHeight))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	x := 0
+	for _, pn := range panels {
+		personWidth := pn.width
+		if len(pn.garments) > 0 {
+			personWidth -= stubColumnWidth
+		}
+		draw.ApproxBiLinear.Scale(dst, image.Rect(x, 0, x+personWidth, stubHeight), pn.person, pn.person.Bounds(), draw.Src, nil)
+		if n := len(pn.garments); n > 0 {
+			cell := stubHeight / n
+			for i, g := range pn.garments {
+				r := image.Rect(x+personWidth, i*cell, x+pn.width, (i+1)*cell)
+				draw.ApproxBiLinear.Scale(dst, r, g, g.Bounds(), draw.Src, nil)
+			}
+		}
+		x += pn.width
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+func stubDecode(url string) (image.Image, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no image")
+	}
+	data, err := fetchImage(url)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raushankrgupta/web-product-scraper/config"
+	"github.com/raushankrgupta/web-product-scraper/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	subscriptionsCollection = "subscriptions"
+	planChangesCollection   = "plan_changes"
+	billingEventsCollection = "billing_events"
+)
+
+// ErrBadBillingEvent wraps errors in an event that retrying won't fix,
+// such as a missing user id or an unknown pack.
+var ErrBadBillingEvent = errors.New("unusable billing event")
+
+// EnsureBillingIndexes creates the unique indexes that keep one
+// subscription per provider id and handle each webhook event once.
+func EnsureBillingIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := GetCollection(config.DBName, subscriptionsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "provider_subscription_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = GetCollection(config.DBName, billingEventsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "event_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// ApplyBillingEvent acts on a verified webhook event from provider: it
+// grants a paid pack's credits, or records a subscription change and
+// moves the user to the plan their subscriptions now give them. An event
+// is recorded as handled only once applied, so provider retries are safe
+// and a failed attempt is retried. Two deliveries racing may both apply
+// it, which is harmless: grants dedupe by payment and subscription
+// updates are ordered.
+func ApplyBillingEvent(ctx context.Context, provider string, ev *BillingEvent) error {
+	if _, err := primitive.ObjectIDFromHex(ev.UserID); err != nil {
+		return fmt.Errorf("%w: %s has no valid user_id", ErrBadBillingEvent, ev.ID)
+	}
+
+	events := GetCollection(config.DBName, billingEventsCollection)
+	handled, err := events.CountDocuments(ctx, bson.M{"provider": provider, "event_id": ev.ID})
+	if err != nil {
+		return fmt.Errorf("check billing event: %w", err)
+	}
+	if handled > 0 {
+		return nil
+	}
+
+	switch ev.Type {
+	case BillingPackPaid:
+		err = grantPack(ctx, provider, ev)
+	case BillingSubscriptionUpdated, BillingSubscriptionCanceled:
+		err = applySubscriptionEvent(ctx, provider, ev)
+	default:
+		err = fmt.Errorf("%w: unknown type %q", ErrBadBillingEvent, ev.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = events.InsertOne(ctx, models.BillingEventRecord{
+		Provider:  provider,
+		EventID:   ev.ID,
+		Type:      ev.Type,
+		UserID:    ev.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		fmt.Printf("[Billing] failed to record %s event %s: %v\n", provider, ev.ID, err)
+	}
+	return nil
+}
+
+func grantPack(ctx context.Context, provider string, ev *BillingEvent) error {
+	pack := models.FindCreditPack(ev.PackID)
+	if pack == nil {
+		return fmt.Errorf("%w: %s has unknown pack %q", ErrBadBillingEvent, ev.ID, ev.PackID)
+	}
+	user, err := findUser(ctx, ev.UserID)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().AddDate(0, 0, pack.ValidDays)
+	return GrantCredits(ctx, ev.UserID, user.PlanOrDefault(), CreditGrant{
+		Source:    models.CreditSourcePack,
+		Units:     pack.Units,
+		ExpiresAt: &expires,
+		Ref:       provider + ":" + ev.PaymentID,
+		Note:      "purchased " + pack.ID,
+	})
+}
+
+func applySubscriptionEvent(ctx context.Context, provider string, ev *BillingEvent) error {
+	if ev.Plan != "" && ev.Plan != models.PlanPlus && ev.Plan != models.PlanPro {
+		return fmt.Errorf("%w: %s has unknown plan %q", ErrBadBillingEvent, ev.ID, ev.Plan)
+	}
+	coll := GetCollection(config.DBName, subscriptionsCollection)
+	filter := bson.M{"provider": provider, "provider_subscription_id": ev.ProviderSubscriptionID}
+
+	var existing models.Subscription
+	err := coll.FindOne(ctx, filter).Decode(&existing)
+	if err == nil && existing.LastEventAt != nil && !ev.OccurredAt.IsZero() && ev.OccurredAt.Before(*existing.LastEventAt) {
+		// Older than an event already applied
+		return nil
+	}
+	if err == nil && existing.Status == models.SubscriptionCanceled && ev.Status != models.SubscriptionCanceled &&
+		(existing.CurrentPeriodEnd == nil || !ev.CurrentPeriodEnd.After(*existing.CurrentPeriodEnd)) {
+		// An update delivered after the cancellation it preceded
+		return nil
+	}
+	if err == nil && existing.UserID != ev.UserID {
+		return fmt.Errorf("%w: %s is for a subscription of another user", ErrBadBillingEvent, ev.ID)
+	}
+
+	now := time.Now()
+	set := bson.M{"status": ev.Status, "updated_at": now}
+	if ev.Plan != "" {
+		set["plan"] = ev.Plan
+	}
+	if !ev.CurrentPeriodEnd.IsZero() {
+		set["current_period_end"] = ev.CurrentPeriodEnd
+	}
+	if ev.CancelAtPeriodEnd != nil {
+		set["cancel_at_period_end"] = *ev.CancelAtPeriodEnd
+	}
+	if !ev.OccurredAt.IsZero() {
+		set["last_event_at"] = ev.OccurredAt
+	}
+	if ev.Status == models.SubscriptionCanceled {
+		set["canceled_at"] = now
+	}
+	_, err = coll.UpdateOne(ctx, filter, bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"user_id": ev.UserID, "created_at": now},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("save subscription: %w", err)
+	}
+
+	err = SyncUserPlan(ctx, ev.UserID, models.PlanChange{
+		Reason:         ev.Type,
+		Provider:       provider,
+		SubscriptionID: ev.ProviderSubscriptionID,
+		EventID:        ev.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if ev.Status == models.SubscriptionActive {
+		cancelSupersededSubscriptions(ctx, ev.UserID, provider, ev.ProviderSubscriptionID)
+	}
+	return nil
+}
+
+// cancelSupersededSubscriptions stops renewal of the user's live
+// subscriptions to a lower plan than the active one (provider,
+// providerSubscriptionID), as left behind by an upgrade. They keep
+// granting until their period ends. Failures are logged.
+func cancelSupersededSubscriptions(ctx context.Context, userID, provider, providerSubscriptionID string) {
+	subs, err := ListSubscriptions(ctx, userID)
+	if err != nil {
+		fmt.Printf("[Billing] failed to check superseded subscriptions of %s: %v\n", userID, err)
+		return
+	}
+	var current *models.Subscription
+	for i := range subs {
+		if subs[i].Provider == provider && subs[i].ProviderSubscriptionID == providerSubscriptionID {
+			current = &subs[i]
+		}
+	}
+	if current == nil {
+		return
+	}
+	for _, s := range subs {
+		if !s.GrantsPlan() || s.CancelAtPeriodEnd || models.PlanRank(s.Plan) >= models.PlanRank(current.Plan) {
+			continue
+		}
+		p, err := NewPaymentProvider(s.Provider)
+		if err == nil {
+			err = p.CancelSubscription(ctx, s.ProviderSubscriptionID)
+		}
+		if err == nil {
+			err = MarkSubscriptionCanceling(ctx, s.ID)
+		}
+		if err != nil {
+			fmt.Printf("[Billing] failed to cancel superseded %s subscription %s of %s: %v\n", s.Provider, s.ProviderSubscriptionID, userID, err)
+			continue
+		}
+		fmt.Printf("[Billing] %s subscription %s of %s set to cancel after upgrade to %s\n", s.Provider, s.ProviderSubscriptionID, userID, current.Plan)
+	}
+}
+
+// SyncUserPlan sets User.Plan to the best plan among the user's live
+// subscriptions, or free when none is left, and records the change with
+// the details in `change`. Users who never subscribed (e.g. a plan set by
+// hand) are left alone.
+func SyncUserPlan(ctx context.Context, userID string, change models.PlanChange) error {
+	subs, err := ListSubscriptions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	plan := models.PlanFree
+	for _, s := range subs {
+		if s.GrantsPlan() && models.PlanRank(s.Plan) > models.PlanRank(plan) {
+			plan = s.Plan
+		}
+	}
+
+	user, err := findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.PlanOrDefault() == plan {
+		return nil
+	}
+	now := time.Now()
+	_, err = GetCollection(config.DBName, "users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"plan": plan, "updated_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("update plan: %w", err)
+	}
+
+	change.UserID = userID
+	change.From = user.PlanOrDefault()
+	change.To = plan
+	change.CreatedAt = now
+	if _, err := GetCollection(config.DBName, planChangesCollection).InsertOne(ctx, change); err != nil {
+		fmt.Printf("[Billing] failed to record plan change for %s: %v\n", userID, err)
+	}
+	fmt.Printf("[Billing] %s plan %s -> %s (%s)\n", userID, change.From, plan, change.Reason)
+	return nil
+}
+
+// ListSubscriptions returns the user's subscriptions, newest first.
+func ListSubscriptions(ctx context.Context, userID string) ([]models.Subscription, error) {
+	cursor, err := GetCollection(config.DBName, subscriptionsCollection).Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load subscriptions: %w", err)
+	}
+	subs := []models.Subscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("load subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// CurrentSubscription returns the user's live subscription with the best
+// plan, or nil.
+func CurrentSubscription(ctx context.Context, userID string) (*models.Subscription, error) {
+	subs, err := ListSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var best *models.Subscription
+	for i := range subs {
+		if subs[i].GrantsPlan() && (best == nil || models.PlanRank(subs[i].Plan) > models.PlanRank(best.Plan)) {
+			best = &subs[i]
+		}
+	}
+	return best, nil
+}
+
+// MarkSubscriptionCanceling records that the subscription won't renew.
+func MarkSubscriptionCanceling(ctx context.Context, id primitive.ObjectID) error {
+	_, err := GetCollection(config.DBName, subscriptionsCollection).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"cancel_at_period_end": true, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+func findUser(ctx context.Context, userID string) (*models.User, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := GetCollection(config.DBName, "users").FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		return nil, fmt.Errorf("load user %s: %w", userID, err)
+	}
+	return &user, nil
+}
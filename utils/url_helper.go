@@ -5,13 +5,25 @@ import (
 	"time"
 )
 
-// ResolveShortenedURL follows redirects to find the final URL
 // ResolveShortenedURL follows redirects to find the final URL
 func ResolveShortenedURL(url string) (string, error) {
+	chain, err := ResolveURLChain(url)
+	if err != nil {
+		return url, err
+	}
+	return chain[len(chain)-1], nil
+}
+
+// ResolveURLChain follows redirects like ResolveShortenedURL but returns
+// every hop, starting with the input URL and ending with the final URL. The
+// chain always has at least one entry, even on error.
+func ResolveURLChain(url string) ([]string, error) {
+	chain := []string{url}
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Keep following redirects
+			chain = append(chain, req.URL.String())
 			return nil
 		},
 	}
@@ -19,7 +31,7 @@ func ResolveShortenedURL(url string) (string, error) {
 	// Use GET directly. HEAD is often blocked or treated suspiciously by anti-bot systems.
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return url, err
+		return chain, err
 	}
 
 	// Mimic a real browser
@@ -31,9 +43,12 @@ func ResolveShortenedURL(url string) (string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return url, err
+		return chain, err
 	}
 	defer resp.Body.Close()
 
-	return resp.Request.URL.String(), nil
+	if final := resp.Request.URL.String(); final != chain[len(chain)-1] {
+		chain = append(chain, final)
+	}
+	return chain, nil
 }
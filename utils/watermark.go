@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// watermarkText is stamped on images generated for plans with
+// PlanEntitlements.Watermark.
+const watermarkText = "TryOnFusion"
+
+// WatermarkImage stamps watermarkText in the bottom-right corner of an
+// image on a translucent band, about a quarter of the image wide, and
+// returns it as JPEG.
+func WatermarkImage(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("watermark: %w", err)
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+
+	// Render the text at the font's native size, then scale it up
+	face := basicfont.Face7x13
+	textWidth := font.MeasureString(face, watermarkText).Ceil()
+	pad := 3
+	label := image.NewRGBA(image.Rect(0, 0, textWidth+2*pad, face.Height+2*pad))
+	draw.Draw(label, label.Bounds(), image.NewUniform(color.NRGBA{0, 0, 0, 96}), image.Point{}, draw.Src)
+	d := &font.Drawer{
+		Dst:  label,
+		Src:  image.NewUniform(color.NRGBA{255, 255, 255, 200}),
+		Face: face,
+		Dot:  fixed.P(pad, pad+face.Ascent),
+	}
+	d.DrawString(watermarkText)
+
+	scale := max(dst.Bounds().Dx()/4/label.Bounds().Dx(), 1)
+	w, h := label.Bounds().Dx()*scale, label.Bounds().Dy()*scale
+	margin := max(dst.Bounds().Dx()/50, 4)
+	at := image.Rect(dst.Bounds().Dx()-w-margin, dst.Bounds().Dy()-h-margin, dst.Bounds().Dx()-margin, dst.Bounds().Dy()-margin)
+	draw.NearestNeighbor.Scale(dst, at, label, label.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("watermark: %w", err)
+	}
+	return buf.Bytes(), nil
+}